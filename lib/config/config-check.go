@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"msh/lib/errco"
+)
+
+// CheckOnly is true if msh was started to validate config and exit (-check)
+var CheckOnly bool = false
+
+// loadCheckOnly sets CheckOnly if -check start argument is specified.
+// It's scanned before flags parsing since msh files must not be written by a config check.
+func loadCheckOnly(args []string) {
+	for _, arg := range args {
+		switch strings.TrimLeft(arg, "-") {
+		case "check", "check=true", "check=1":
+			if strings.HasPrefix(arg, "-") {
+				CheckOnly = true
+			}
+		}
+	}
+}
+
+// checkProblems are the errors and config check warnings logged during config check
+var checkProblems []*errco.MshLog
+
+// startCheck starts recording errors and config check warnings
+func startCheck() {
+	errco.SetLogHook(func(logMsh *errco.MshLog) {
+		if logMsh.Typ != errco.TYPE_ERR && logMsh.Cod != errco.ERROR_CONFIG_CHECK {
+			return
+		}
+
+		// the same problem might be logged more than once
+		for _, p := range checkProblems {
+			if p.Cod == logMsh.Cod && fmt.Sprintf(p.Mex, p.Arg...) == fmt.Sprintf(logMsh.Mex, logMsh.Arg...) {
+				return
+			}
+		}
+
+		checkProblems = append(checkProblems, logMsh)
+	})
+}
+
+// checkStartCommand checks that the start server command is valid and has no unresolved placeholder
+func (c *Configuration) checkStartCommand() {
+	command, logMsh := c.BuildCommandStartServer()
+	if logMsh != nil {
+		logMsh.Log(true)
+		return
+	}
+
+	for _, arg := range command {
+		if strings.HasPrefix(arg, "<") && strings.HasSuffix(arg, ">") {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "unresolved placeholder in start server command: %s", arg)
+		}
+	}
+}
+
+// CheckSummary prints the problems found during config check and returns the msh exit code
+// (0 if no problem was found, 1 otherwise)
+func CheckSummary() int {
+	errco.SetLogHook(nil)
+
+	// not using errco.NewLogln since log time is not needed
+	if len(checkProblems) == 0 {
+		fmt.Println("msh config check: OK")
+		return 0
+	}
+
+	fmt.Printf("msh config check: %d problem(s) found\n", len(checkProblems))
+	for _, p := range checkProblems {
+		fmt.Printf("- %-5s [%06x] %s\n", p.Typ, p.Cod, fmt.Sprintf(p.Mex, p.Arg...))
+	}
+
+	return 1
+}
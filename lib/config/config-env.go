@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"strconv"
+
+	"msh/lib/errco"
+)
+
+// envOverride maps an environment variable to the config field it overrides
+type envOverride struct {
+	name  string
+	field interface{} // *string, *int, *int64, *bool
+}
+
+// envOverrides returns the environment variables that can override config fields
+func (c *Configuration) envOverrides() []envOverride {
+	return []envOverride{
+		{"MSH_SERVER_FOLDER", &c.Server.Folder},
+		{"MSH_SERVER_FILE", &c.Server.FileName},
+		{"MSH_SERVER_TYPE", &c.Server.Type},
+		{"MSH_SERVER_EDITION", &c.Server.Edition},
+		{"MSH_SERVER_CONTAINER", &c.Server.Container},
+		{"MSH_RCON_PORT", &c.Server.RconPort},
+		{"MSH_RCON_PASSWORD", &c.Server.RconPassword},
+		{"MSH_START_PARAM", &c.Commands.StartServerParam},
+		{"MSH_ALLOW_KILL", &c.Commands.StopServerAllowKill},
+		{"MSH_DEBUG", &c.Msh.Debug},
+		{"MSH_LOG_FORMAT", &c.Msh.LogFormat},
+		{"MSH_TEMPLATE", &c.Msh.Template},
+		{"MSH_LISTEN_PORT", &c.Msh.MshPort},
+		{"MSH_QUERY_PORT", &c.Msh.MshPortQuery},
+		{"MSH_PORT_RANGE", &c.Msh.MshPortRange},
+		{"MSH_ENABLE_QUERY", &c.Msh.EnableQuery},
+		{"MSH_TIMEOUT", &c.Msh.TimeBeforeStoppingEmptyServer},
+		{"MSH_SUSPEND_ALLOW", &c.Msh.SuspendAllow},
+		{"MSH_HIBERNATION_MODE", &c.Msh.HibernationMode},
+		{"MSH_INFO_HIBERNATION", &c.Msh.InfoHibernation},
+		{"MSH_INFO_STARTING", &c.Msh.InfoStarting},
+		{"MSH_WHITELIST_IMPORT", &c.Msh.WhitelistImport},
+		{"MSH_NOTIFY_UPDATE", &c.Msh.NotifyUpdate},
+		{"MSH_NOTIFY_MESSAGE", &c.Msh.NotifyMessage},
+	}
+}
+
+// loadEnv overrides config fields with the set environment variables.
+// Invalid values are ignored.
+func (c *Configuration) loadEnv() {
+	for _, o := range c.envOverrides() {
+		value, ok := os.LookupEnv(o.name)
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch f := o.field.(type) {
+		case *string:
+			*f = value
+		case *int:
+			var v int
+			if v, err = strconv.Atoi(value); err == nil {
+				*f = v
+			}
+		case *int64:
+			var v int64
+			if v, err = strconv.ParseInt(value, 10, 64); err == nil {
+				*f = v
+			}
+		case *bool:
+			var v bool
+			if v, err = strconv.ParseBool(value); err == nil {
+				*f = v
+			}
+		}
+
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "ignoring invalid environment variable %s=%s", o.name, value)
+			continue
+		}
+
+		// value is not logged as it might be a secret
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "config overridden by environment variable %s", o.name)
+	}
+}
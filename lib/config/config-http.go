@@ -0,0 +1,125 @@
+package config
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// outboundProxy is the proxy used by msh outbound http connections (nil to use environment proxy settings)
+var outboundProxy *url.URL
+
+// HttpClient returns an http client for msh outbound connections (update check, webhooks, metrics push).
+//
+// If Msh.SocksProxy or Msh.HttpProxy is set, connections go through it (SocksProxy takes precedence),
+// except for hosts matching NO_PROXY environment variable.
+// Otherwise HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables are used.
+func HttpClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if outboundProxy != nil {
+		proxy := outboundProxy
+		noProxy := os.Getenv("NO_PROXY")
+		if noProxy == "" {
+			noProxy = os.Getenv("no_proxy")
+		}
+
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if noProxyMatch(noProxy, req.URL.Host) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// loadOutboundProxy parses Msh.SocksProxy/Msh.HttpProxy and sets outboundProxy
+func (c *Configuration) loadOutboundProxy() *errco.MshLog {
+	outboundProxy = nil
+
+	switch {
+	case c.Msh.SocksProxy != "":
+		raw := c.Msh.SocksProxy
+		if !strings.Contains(raw, "://") {
+			raw = "socks5://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "socks5" && u.Scheme != "socks5h") || u.Host == "" {
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "SocksProxy \"%s\" is invalid (format: socks5://[user:pass@]host:port)", c.Msh.SocksProxy)
+		}
+		outboundProxy = u
+
+	case c.Msh.HttpProxy != "":
+		u, err := url.Parse(c.Msh.HttpProxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "HttpProxy \"%s\" is invalid (format: http://[user:pass@]host:port)", c.Msh.HttpProxy)
+		}
+		outboundProxy = u
+
+	default:
+		return nil
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "outbound connections proxy: %s://%s", outboundProxy.Scheme, outboundProxy.Host)
+
+	return nil
+}
+
+// noProxyMatch returns true if host (host or host:port) matches noProxy list.
+//
+// noProxy is a comma separated list of:
+// "*" (all hosts), hostnames (matching subdomains too), ".domain" suffixes, "host:port", IPs and CIDRs.
+func noProxyMatch(noProxy, host string) bool {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.ToLower(hostname)
+	ip := net.ParseIP(hostname)
+
+	for _, e := range strings.Split(noProxy, ",") {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if e == "*" {
+			return true
+		}
+
+		// CIDR
+		if _, ipNet, err := net.ParseCIDR(e); err == nil {
+			if ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		// entry with port matches only that port
+		eHost, ePort := e, ""
+		if h, p, err := net.SplitHostPort(e); err == nil {
+			eHost, ePort = h, p
+		}
+		if ePort != "" && ePort != port {
+			continue
+		}
+
+		eHost = strings.TrimPrefix(eHost, "*")
+		switch {
+		case eHost == hostname:
+			return true
+		case strings.HasPrefix(eHost, ".") && strings.HasSuffix(hostname, eHost):
+			return true
+		case !strings.HasPrefix(eHost, ".") && net.ParseIP(eHost) == nil && strings.HasSuffix(hostname, "."+eHost):
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"net"
+	"strings"
+
+	"msh/lib/errco"
+)
+
+var (
+	allowedNets []*net.IPNet // allowedNets contains the parsed Msh.AllowedIPs (empty to allow every address, protected by compiledM)
+	blockedNets []*net.IPNet // blockedNets contains the parsed Msh.BlockedIPs (protected by compiledM)
+)
+
+// IpWakeAllowed returns true if the client address is allowed to warm ms
+// (not in BlockedIPs and in AllowedIPs, if specified)
+func IpWakeAllowed(clientAddress string) bool {
+	ip := net.ParseIP(strings.Trim(clientAddress, "[]"))
+	if ip == nil {
+		return false
+	}
+
+	compiledM.RLock()
+	defer compiledM.RUnlock()
+
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(allowedNets) == 0 {
+		return true
+	}
+	for _, n := range allowedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseIpNets parses a list of CIDRs or ip addresses (IPv4 and IPv6).
+// Invalid elements are logged and ignored.
+func parseIpNets(list []string, field string) []*net.IPNet {
+	nets := []*net.IPNet{}
+
+	for _, e := range list {
+		// single ip address
+		if !strings.Contains(e, "/") {
+			if ip := net.ParseIP(e); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "%s element \"%s\" is not a valid ip address or CIDR, ignoring it", field, e)
+			continue
+		}
+		nets = append(nets, n)
+	}
+
+	return nets
+}
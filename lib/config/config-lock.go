@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/opsys"
+)
+
+const lockFileName string = "msh.lock"
+
+// lockAcquired is true when msh lock file was written by this msh instance
+var lockAcquired bool = false
+
+// acquireLock writes msh lock file (owner pid and msh id) in minecraft server folder.
+// If the lock file is owned by a running process an error is returned and msh should not manage the minecraft server.
+// Stale lock files (owner process not running) are reclaimed.
+func (c *Configuration) acquireLock() *errco.MshLog {
+	lockFilePath := filepath.Join(c.Server.Folder, lockFileName)
+
+	// check if lock file is owned by an other running msh instance
+	if lockData, err := os.ReadFile(lockFilePath); err == nil {
+		var l *model.MshLock = &model.MshLock{}
+		switch err = json.Unmarshal(lockData, l); {
+		case err != nil:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_LOCK, "msh lock file is corrupted, reclaiming it (%s)", err.Error())
+		case l.Pid != os.Getpid() && opsys.ProcAlive(l.Pid):
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOCK, "minecraft server is already managed by an other msh instance (pid: %d, lock file: %s)", l.Pid, lockFilePath)
+		default:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_LOCK, "reclaiming stale msh lock file (pid: %d)", l.Pid)
+		}
+	}
+
+	lockData, err := json.Marshal(&model.MshLock{Pid: os.Getpid(), MshId: c.Msh.ID})
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONFIG_LOCK, err.Error())
+	}
+
+	logMsh := WritePersistFile(lockFilePath, lockData)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	lockAcquired = true
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "acquired msh lock file: %s", lockFilePath)
+
+	return nil
+}
+
+// ReleaseLock removes msh lock file from minecraft server folder (only if acquired by this msh instance)
+func ReleaseLock() {
+	if !lockAcquired {
+		return
+	}
+
+	err := os.Remove(filepath.Join(ConfigRuntime().Server.Folder, lockFileName))
+	if err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_LOCK, "could not remove msh lock file (%s)", err.Error())
+		return
+	}
+
+	lockAcquired = false
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "released msh lock file")
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+
+	"msh/lib/errco"
+)
+
+// configMigration upgrades the config file data (groups "Server", "Commands", "Msh") by one config version.
+//
+// To change the config file format, append a migration to configMigrations:
+// configMigrations[i] upgrades the config file from version i to version i+1.
+type configMigration func(raw map[string]map[string]interface{})
+
+// configMigrations are the ordered config file migrations
+var configMigrations = []configMigration{
+	// 0 -> 1: config files without ConfigVersion don't have the fields whose zero value is not the default
+	func(raw map[string]map[string]interface{}) {
+		setDefault(raw, "Server", "Type", "java")
+		setDefault(raw, "Msh", "HibernationMode", "stop")
+		setDefault(raw, "Msh", "VerifyBackend", true)
+		setDefault(raw, "Msh", "OnServerOom", "alert")
+		setDefault(raw, "Msh", "SessionSummaryLevel", 1)
+	},
+	// 1 -> 2: Msh.StartingDisplay is moved to Msh.Ping.StartingDisplay
+	func(raw map[string]map[string]interface{}) {
+		display, ok := raw["Msh"]["StartingDisplay"]
+		if !ok {
+			return
+		}
+		delete(raw["Msh"], "StartingDisplay")
+
+		ping, ok := raw["Msh"]["Ping"].(map[string]interface{})
+		if !ok {
+			ping = map[string]interface{}{}
+			raw["Msh"]["Ping"] = ping
+		}
+		if _, ok := ping["StartingDisplay"]; !ok {
+			ping["StartingDisplay"] = display
+		}
+	},
+}
+
+// configVersion is the current config file version
+var configVersion = len(configMigrations)
+
+// migrateConfig upgrades the config file data to the current config version.
+// Returns the upgraded config file data and true if a migration was applied.
+func migrateConfig(data []byte) ([]byte, bool, *errco.MshLog) {
+	raw := map[string]map[string]interface{}{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, false, errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
+	}
+	for _, group := range []string{"Server", "Commands", "Msh"} {
+		if raw[group] == nil {
+			raw[group] = map[string]interface{}{}
+		}
+	}
+
+	version := 0
+	if v, ok := raw["Msh"]["ConfigVersion"].(float64); ok {
+		version = int(v)
+	}
+
+	switch {
+	case version == configVersion:
+		return data, false, nil
+	case version > configVersion:
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "config version (%d) is newer than the supported one (%d), some fields might be ignored", version, configVersion)
+		return data, false, nil
+	}
+
+	for ; version < configVersion; version++ {
+		configMigrations[version](raw)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "config file migrated to version %d", version+1)
+	}
+	raw["Msh"]["ConfigVersion"] = configVersion
+
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return nil, false, errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
+	}
+
+	return data, true, nil
+}
+
+// setDefault sets a config field only if it's missing from the config file
+func setDefault(raw map[string]map[string]interface{}, group, field string, value interface{}) {
+	if _, ok := raw[group][field]; !ok {
+		raw[group][field] = value
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"time"
@@ -22,7 +23,7 @@ import (
 	"msh/lib/utility"
 )
 
-const instanceFile string = "msh.instance"
+const instanceFileName string = "msh.instance"
 const CFLAG string = "/*\\"
 
 type MshInstanceV model.MshInstanceV
@@ -30,6 +31,8 @@ type MshInstanceV0 model.MshInstanceV0
 
 // MshID returns msh id. A new istance is created if not healthy/not existent.
 func MshID() string {
+	instanceFile := filepath.Join(MshHome, instanceFileName)
+
 	// if msh instance does not exist, generate a new one
 	_, err := os.Stat(instanceFile)
 	if errors.Is(err, os.ErrNotExist) {
@@ -90,18 +93,31 @@ func MshID() string {
 
 // newMshInstance generates a new instance file and returns a new mshid
 func newMshInstance(mshIDrecord string) string {
+	instanceFile := filepath.Join(MshHome, instanceFileName)
+
+	// config check must not write msh files
+	if CheckOnly {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "config check: msh instance file not written")
+		if utility.Entropy(mshIDrecord) >= 150 {
+			return mshIDrecord
+		}
+		return genMshId()
+	}
+
 	var i *MshInstanceV0 = &MshInstanceV0{}
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "generating new msh instance")
 
 	// touch instance file (to know in advance file id)
-	f, err := os.Create(instanceFile)
-	if err != nil {
-		log.Fatalln(err.Error())
+	// (if it can't be written, the generated mshid is used without being persisted)
+	logMsh := WritePersistFile(instanceFile, []byte{})
+	if logMsh != nil {
+		logMsh.Log(true)
 	}
-	_ = f.Close()
+	persisted := logMsh == nil
 
 	// generate instance parameters
+	var err error
 	i.V = 0                                   // set instance file version
 	i.CFlag = CFLAG                           // set copy flag to CFLAG
 	i.MId, err = machineid.ProtectedID("msh") // get machine id
@@ -112,9 +128,11 @@ func newMshInstance(mshIDrecord string) string {
 	if err != nil {
 		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_MSHID, err.Error())
 	}
-	i.FId, err = opsys.FileId(instanceFile) // get instance file id
-	if err != nil {
-		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_MSHID, err.Error())
+	if persisted {
+		i.FId, err = opsys.FileId(instanceFile) // get instance file id
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_MSHID, err.Error())
+		}
 	}
 	// try to use mshID old record
 	i.MshId = mshIDrecord
@@ -135,10 +153,15 @@ func newMshInstance(mshIDrecord string) string {
 	// replace CFLAG with NULL char to prevent accidental copy of msh.instance
 	instanceData = bytes.ReplaceAll(instanceData, []byte(CFLAG), []byte{0})
 
+	if !persisted {
+		return i.MshId
+	}
+
 	// write to instance file
-	err = os.WriteFile(instanceFile, instanceData, 0644)
-	if err != nil {
-		log.Fatalln(err.Error())
+	logMsh = WritePersistFile(instanceFile, instanceData)
+	if logMsh != nil {
+		logMsh.Log(true)
+		return i.MshId
 	}
 
 	// instance health check at birth
@@ -154,6 +177,8 @@ func newMshInstance(mshIDrecord string) string {
 
 // ok verify that msh instance V0 is healthy
 func (i *MshInstanceV0) okV0() bool {
+	instanceFile := filepath.Join(MshHome, instanceFileName)
+
 	// check that instance exists
 	if i == nil {
 		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONFIG_MSHID, "msh instance struct not loaded")
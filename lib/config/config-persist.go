@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// persist contains the state of msh config/state files persistence
+var persist = struct {
+	m        sync.Mutex
+	readOnly bool // if true, msh does not attempt to write config/state files
+}{}
+
+// WritePersistFile writes data to a msh config/state file applying OnPersistError policy:
+//
+// - warn: the error is returned as a warning
+//
+// - alert: the error is returned and reported in servstats so that users are notified
+//
+// - readonly: the error is returned and msh stops writing config/state files until a write probe succeeds
+func WritePersistFile(path string, data []byte) *errco.MshLog {
+	persist.m.Lock()
+	defer persist.m.Unlock()
+
+	if persist.readOnly {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_PERSIST, "msh is in readonly mode, not writing %s", path)
+	}
+
+	err := writeFileAtomic(path, data)
+	if err == nil {
+		return nil
+	}
+
+	switch ConfigRuntime().Msh.OnPersistError {
+	case "alert":
+		logMsh := errco.NewLog(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_CONFIG_PERSIST, "could not write %s: %s", path, err.Error())
+		servstats.Stats.PersistError = logMsh
+		return logMsh
+
+	case "readonly":
+		logMsh := errco.NewLog(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_CONFIG_PERSIST, "could not write %s, switching to readonly mode: %s", path, err.Error())
+		servstats.Stats.PersistError = logMsh
+		persist.readOnly = true
+		go persistProbe()
+		return logMsh
+
+	default: // "warn"
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_PERSIST, "could not write %s: %s", path, err.Error())
+	}
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory of path and renames it over path,
+// so that path is never left partially written (ex: disk full).
+// The file is readable only by the owner (config file might contain secrets).
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// persistProbe periodically tries to write a probe file in msh home directory.
+// When the write succeeds, readonly mode is disabled.
+// [goroutine]
+func persistProbe() {
+	probeFilePath := filepath.Join(MshHome, ".msh-probe")
+
+	for range time.NewTicker(time.Minute).C {
+		if err := os.WriteFile(probeFilePath, []byte{}, 0644); err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_PERSIST, "write probe failed, msh stays in readonly mode: %s", err.Error())
+			continue
+		}
+		_ = os.Remove(probeFilePath)
+
+		persist.m.Lock()
+		persist.readOnly = false
+		servstats.Stats.PersistError = nil
+		persist.m.Unlock()
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "write probe succeeded, msh exits readonly mode")
+
+		return
+	}
+}
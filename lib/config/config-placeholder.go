@@ -0,0 +1,80 @@
+package config
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// placeholderRegex matches an escaped angle bracket ("\<", "\>") or a placeholder ("<Server.Version>")
+var placeholderRegex = regexp.MustCompile(`\\[<>]|<([A-Za-z][\w.]*)>`)
+
+// unknownPlaceholders contains the unknown placeholders already logged
+var unknownPlaceholders sync.Map
+
+// ResolvePlaceholders replaces the placeholders in a template (start command, msh info texts) with their values:
+//
+// <Server.FileName>, <Server.Version>, <Commands.StartServerParam>, <Msh.ID>,
+// <motd> (server.properties motd), <PlayerCount>, <TimeUntilHibernate> (seconds, "-" if not scheduled).
+//
+// "\<" and "\>" are replaced with literal angle brackets.
+// Unknown placeholders are left intact.
+func ResolvePlaceholders(template string) string {
+	return ConfigRuntime().resolvePlaceholders(template)
+}
+
+// resolvePlaceholders replaces the placeholders in a template with the values of c (see ResolvePlaceholders)
+func (c *Configuration) resolvePlaceholders(template string) string {
+	return placeholderRegex.ReplaceAllStringFunc(template, func(m string) string {
+		// escaped angle bracket
+		if m[0] == '\\' {
+			return m[1:]
+		}
+
+		switch name := m[1 : len(m)-1]; name {
+		case "Server.FileName":
+			return c.Server.FileName
+		case "Server.Version":
+			return c.Server.Version
+		case "Commands.StartServerParam":
+			return c.Commands.StartServerParam
+		case "Msh.ID":
+			return c.Msh.ID
+		case "motd":
+			return ServMotd
+		case "PlayerCount":
+			return strconv.Itoa(servstats.Stats.ConnCount)
+		case "TimeUntilHibernate":
+			if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.ConnCount > 0 || !servstats.Stats.FreezeTime.After(time.Now()) {
+				return "-"
+			}
+			return strconv.Itoa(int(time.Until(servstats.Stats.FreezeTime).Round(time.Second).Seconds()))
+		default:
+			if _, logged := unknownPlaceholders.LoadOrStore(name, true); !logged {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_CHECK, "unknown placeholder %s left unchanged", m)
+			}
+			return m
+		}
+	})
+}
+
+// BuildCommand splits a command into arguments resolving placeholders
+// (<Commands.StartServerParam> is split into multiple arguments).
+func (c *Configuration) BuildCommand(commandStr string) []string {
+	var command = []string{}
+	for _, ss := range strings.Fields(commandStr) {
+		switch ss {
+		case "<Commands.StartServerParam>":
+			command = append(command, strings.Fields(c.Commands.StartServerParam)...)
+		default:
+			command = append(command, c.resolvePlaceholders(ss))
+		}
+	}
+
+	return command
+}
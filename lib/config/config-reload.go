@@ -0,0 +1,199 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// configWatchInterval is the interval at which the config file is checked for changes
+const configWatchInterval = 5 * time.Second
+
+// hotFields are the config fields that are applied by ReloadConfig while msh is running.
+// Changes to the other fields (ex: MshPort, Server.Folder) require a msh restart.
+var hotFields = map[string]bool{
+	"Server.StopConfirmRegex":           true,
+	"Server.StartupDoneRegex":           true,
+	"Server.ReadyCommand":               true,
+	"Commands.StartServerParam":         true,
+	"Commands.StopServer":               true,
+	"Commands.StopServerAllowKill":      true,
+	"Commands.PreStart":                 true,
+	"Commands.PostStop":                 true,
+	"Commands.JoinWelcome":              true,
+	"Msh.Debug":                         true,
+	"Msh.LogFormat":                     true,
+	"Msh.EnableLegacyPing":              true,
+	"Msh.HttpOnMcPortResponse":          true,
+	"Msh.TimeBeforeStoppingEmptyServer": true,
+	"Msh.MinUptimeBeforeStop":           true,
+	"Msh.MinHibernationSeconds":         true,
+	"Msh.ShutdownTimeout":               true,
+	"Msh.HibernationWarnSeconds":        true,
+	"Msh.WarnOnlinePlayers":             true,
+	"Msh.HibernateOnMemPercent":         true,
+	"Msh.SuspendStopAfter":              true,
+	"Msh.StartupTimeout":                true,
+	"Msh.StartupJoinTimeout":            true,
+	"Msh.CancelStartIfEmpty":            true,
+	"Msh.VerifyBackend":                 true,
+	"Msh.InfoHibernation":               true,
+	"Msh.InfoStarting":                  true,
+	"Msh.InfoStartingProgress":          true,
+	"Msh.DiscordWebhookUrl":             true,
+	"Msh.OnPlayerJoin":                  true,
+	"Msh.OnPlayerLeave":                 true,
+	"Msh.NotifyRetryMinutes":            true,
+	"Msh.MaxConnectionsPerIp":           true,
+	"Msh.MaxConnsPerMinute":             true,
+	"Msh.AcceptProxyProtocol":           true,
+	"Msh.SendProxyProtocol":             true,
+	"Msh.KickIdlePlayersAfter":          true,
+	"Msh.OnServerOom":                   true,
+	"Msh.RestartOnCrash":                true,
+	"Msh.MaxRestartAttempts":            true,
+	"Msh.Whitelist":                     true,
+	"Msh.WhitelistRconRefresh":          true,
+	"Msh.RespectWhitelist":              true,
+	"Msh.WhitelistKickMessage":          true,
+	"Msh.AllowedIPs":                    true,
+	"Msh.BlockedIPs":                    true,
+	"Msh.WakeDeniedMessage":             true,
+	"Msh.ProtocolRewrite":               true,
+	"Msh.ConsoleTriggers":               true,
+	"Msh.Ping":                          true,
+	"Msh.StatusResponse":                true,
+	"Msh.SessionSummaryLevel":           true,
+	"Msh.Schedule":                      true,
+}
+
+var (
+	// reloadM prevents concurrent config reloads
+	reloadM sync.Mutex
+
+	// configFileModTime is the modification time (unix nanoseconds) of the config file when it was last loaded/saved by msh
+	// (written by WatchConfig and by config saves)
+	configFileModTime atomic.Int64
+
+	// overriddenFields are the config fields overridden by environment variables or flags at startup
+	overriddenFields map[string]bool
+)
+
+// ReloadConfig reloads the config file and applies the changed hot fields to the runtime config.
+// A warning is logged for each changed field that requires a msh restart.
+//
+// If the config file can't be loaded (ex: malformed json), the running config is kept.
+func ReloadConfig() *errco.MshLog {
+	reloadM.Lock()
+	defer reloadM.Unlock()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "reloading config file...")
+
+	newDefault := &Configuration{}
+	logMsh := newDefault.loadDefault()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	newRuntime := &Configuration{}
+	*newRuntime = *ConfigRuntime()
+
+	applyReload(ConfigDefault(), newDefault, newRuntime)
+
+	// check reloaded values
+	newRuntime.checkRuntime()
+	errco.DebugLvl = errco.LogLvl(newRuntime.Msh.Debug)
+	errco.SetLogFormat(newRuntime.Msh.LogFormat)
+
+	configDefault.Store(newDefault)
+	configRuntime.Store(newRuntime)
+
+	return nil
+}
+
+// applyReload sets the hot fields changed between oldDef and newDef config files in the run config.
+// Fields overridden by environment variables or flags are kept.
+// Returns the applied fields.
+func applyReload(oldDef, newDef, run *Configuration) []string {
+	var applied []string
+
+	for _, field := range diffFields(oldDef, newDef) {
+		switch {
+		case !hotFields[field]:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "%s changed: restart msh to apply it", field)
+		case overriddenFields[field]:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "%s changed: not applied as it's overridden by an environment variable or flag", field)
+		default:
+			configField(run, field).Set(configField(newDef, field))
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%s reloaded", field)
+			applied = append(applied, field)
+		}
+	}
+
+	return applied
+}
+
+// diffFields compares config groups (Server, Commands, Msh) field by field
+// and returns the fields ("Group.Field") that differ between a and b
+func diffFields(a, b *Configuration) []string {
+	var fields []string
+
+	va := reflect.ValueOf(&a.Configuration).Elem()
+	vb := reflect.ValueOf(&b.Configuration).Elem()
+	for g := 0; g < va.NumField(); g++ {
+		group := va.Type().Field(g).Name
+		for f := 0; f < va.Field(g).NumField(); f++ {
+			if !reflect.DeepEqual(va.Field(g).Field(f).Interface(), vb.Field(g).Field(f).Interface()) {
+				fields = append(fields, group+"."+va.Field(g).Type().Field(f).Name)
+			}
+		}
+	}
+
+	return fields
+}
+
+// configField returns the value of a config field ("Group.Field")
+func configField(c *Configuration, field string) reflect.Value {
+	group, name, _ := strings.Cut(field, ".")
+	return reflect.ValueOf(&c.Configuration).Elem().FieldByName(group).FieldByName(name)
+}
+
+// WatchConfig reloads the config file when it's modified.
+// (the config file modification time is polled as msh has no file notification dependency)
+//
+// [goroutine]
+func WatchConfig() {
+	configFilePath := filepath.Join(MshHome, configFileName)
+
+	for range time.NewTicker(configWatchInterval).C {
+		fi, err := os.Stat(configFilePath)
+		if err != nil {
+			continue
+		}
+
+		// the config file was not modified since it was last loaded/saved by msh
+		if modTime := fi.ModTime().UnixNano(); configFileModTime.Swap(modTime) == modTime {
+			continue
+		}
+
+		logMsh := ReloadConfig()
+		if logMsh != nil {
+			logMsh.Log(true)
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "config file could not be reloaded, keeping the running config")
+		}
+	}
+}
+
+// updateConfigFileModTime stores the config file modification time
+// (so that msh config saves don't trigger a reload)
+func updateConfigFileModTime() {
+	if fi, err := os.Stat(filepath.Join(MshHome, configFileName)); err == nil {
+		configFileModTime.Store(fi.ModTime().UnixNano())
+	}
+}
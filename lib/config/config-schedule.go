@@ -0,0 +1,89 @@
+package config
+
+import (
+	"strings"
+	"time"
+
+	"msh/lib/model"
+)
+
+// weekdays maps the schedule day names to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ScheduleAllowed returns true if t is inside one of the schedule windows
+// (or if no schedule window is specified).
+func (c *Configuration) ScheduleAllowed(t time.Time) bool {
+	if len(c.Msh.Schedule.Windows) == 0 {
+		return true
+	}
+
+	for _, w := range c.Msh.Schedule.Windows {
+		if inScheduleWindow(w, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inScheduleWindow returns true if t is inside the schedule window.
+// A window with End before Start crosses midnight and belongs to the day in which it starts.
+func inScheduleWindow(w model.ScheduleWindow, t time.Time) bool {
+	days, start, end, ok := parseScheduleWindow(w)
+	if !ok {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	today := days[t.Weekday()]
+	yesterday := days[(t.Weekday()+6)%7]
+
+	if start < end {
+		return today && now >= start && now < end
+	}
+
+	// window crossing midnight
+	return (today && now >= start) || (yesterday && now < end)
+}
+
+// parseScheduleWindow returns the days, start and end minutes of a schedule window.
+// Returns false if the window is invalid.
+func parseScheduleWindow(w model.ScheduleWindow) (map[time.Weekday]bool, int, int, bool) {
+	days := map[time.Weekday]bool{}
+	if len(w.Days) == 0 {
+		for _, d := range weekdays {
+			days[d] = true
+		}
+	}
+	for _, name := range w.Days {
+		d, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, 0, 0, false
+		}
+		days[d] = true
+	}
+
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+
+	startMin, endMin := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if startMin == endMin {
+		return nil, 0, 0, false
+	}
+
+	return days, startMin, endMin, true
+}
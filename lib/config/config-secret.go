@@ -0,0 +1,182 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/denisbrodbeck/machineid"
+
+	"msh/lib/errco"
+)
+
+// secretPrefix marks the config values encrypted by msh
+const secretPrefix string = "msh-enc:"
+
+// secretFields returns the config fields that are encrypted in the config file
+func (c *Configuration) secretFields() map[string]*string {
+	return map[string]*string{
+		"Server.RconPassword":   &c.Server.RconPassword,
+		"Msh.ApiToken":          &c.Msh.ApiToken,
+		"Msh.DiscordWebhookUrl": &c.Msh.DiscordWebhookUrl,
+	}
+}
+
+// decryptSecrets decrypts the secret fields loaded from the config file.
+// If a secret field is in plaintext, the config is saved again to encrypt it.
+func (c *Configuration) decryptSecrets() *errco.MshLog {
+	var key []byte
+
+	for name, field := range c.secretFields() {
+		if *field == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(*field, secretPrefix) {
+			// plaintext value written by the user: encrypt it with the next save
+			configDefaultSave = true
+			continue
+		}
+
+		if key == nil {
+			var err error
+			if key, err = secretKey(); err != nil {
+				return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "could not decrypt %s, machine id not available: %s", name, err.Error())
+			}
+		}
+
+		plain, err := decryptSecret(key, *field)
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD,
+				"could not decrypt %s: encrypted config values are bound to the machine that saved them (was the config file copied from another machine?), replace it with its plaintext value", name)
+		}
+		*field = plain
+	}
+
+	return nil
+}
+
+// encryptSecrets encrypts the secret fields before the config is written to the config file.
+// If the key is not available, secret fields are kept in plaintext.
+func (c *Configuration) encryptSecrets() {
+	var key []byte
+
+	for name, field := range c.secretFields() {
+		if *field == "" || strings.HasPrefix(*field, secretPrefix) {
+			continue
+		}
+
+		if key == nil {
+			var err error
+			if key, err = secretKey(); err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_SAVE, "machine id not available, secret config fields are saved in plaintext: %s", err.Error())
+				return
+			}
+		}
+
+		enc, err := encryptSecret(key, *field)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_SAVE, "could not encrypt %s, saving it in plaintext: %s", name, err.Error())
+			continue
+		}
+		*field = enc
+	}
+}
+
+// EncryptValue encrypts a value persisted by msh in a state file (ex: webhook urls of queued notifications).
+// If the key is not available, the value is returned in plaintext.
+func EncryptValue(plain string) string {
+	key, err := secretKey()
+	if err != nil {
+		return plain
+	}
+
+	enc, err := encryptSecret(key, plain)
+	if err != nil {
+		return plain
+	}
+
+	return enc
+}
+
+// DecryptValue decrypts a value returned by EncryptValue (plaintext values are returned as they are)
+func DecryptValue(value string) (string, error) {
+	if !strings.HasPrefix(value, secretPrefix) {
+		return value, nil
+	}
+
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+
+	return decryptSecret(key, value)
+}
+
+// secretKey returns the key used to encrypt config secrets (derived from the machine id)
+func secretKey() ([]byte, error) {
+	mId, err := machineid.ProtectedID("msh")
+	if err != nil {
+		return nil, err
+	}
+
+	key := sha256.Sum256([]byte("msh-config-secret:" + mId))
+
+	return key[:], nil
+}
+
+// encryptSecret encrypts plain with AES-GCM and returns it as secretPrefix + base64(nonce + ciphertext)
+func encryptSecret(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	data := gcm.Seal(nonce, nonce, []byte(plain), nil)
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// decryptSecret decrypts a value returned by encryptSecret
+func decryptSecret(key []byte, value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted value too short")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+// newGCM returns an AES-GCM cipher for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"msh/lib/errco"
+)
+
+// serverTemplate contains the defaults of a minecraft server type
+type serverTemplate struct {
+	startServer      string // Commands.StartServer
+	stopConfirmRegex string // Server.StopConfirmRegex
+	startupTimeout   int    // Msh.StartupTimeout
+}
+
+// serverTemplates contains the built-in templates selectable with Msh.Template
+var serverTemplates map[string]serverTemplate = map[string]serverTemplate{
+	"vanilla": {
+		startServer:      "java <Commands.StartServerParam> -jar <Server.FileName> nogui",
+		stopConfirmRegex: defaultStopConfirmRegex,
+		startupTimeout:   300,
+	},
+	"paper": {
+		startServer:      "java <Commands.StartServerParam> -jar <Server.FileName> nogui",
+		stopConfirmRegex: defaultStopConfirmRegex,
+		startupTimeout:   300,
+	},
+	"fabric": {
+		startServer:      "java <Commands.StartServerParam> -jar <Server.FileName> nogui",
+		stopConfirmRegex: defaultStopConfirmRegex,
+		startupTimeout:   600,
+	},
+	"forge": {
+		startServer:      "java <Commands.StartServerParam> -jar <Server.FileName> nogui",
+		stopConfirmRegex: defaultStopConfirmRegex,
+		startupTimeout:   900, // modded servers take longer to start
+	},
+}
+
+// applyTemplate fills the config fields left empty by the user with the defaults of Msh.Template.
+// Fields set by the user are not modified.
+func (c *Configuration) applyTemplate() {
+	if c.Msh.Template == "" {
+		return
+	}
+
+	t, ok := serverTemplates[c.Msh.Template]
+	if !ok {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "server template \"%s\" is unknown (vanilla - paper - fabric - forge), no template applied", c.Msh.Template)
+		return
+	}
+
+	if c.Commands.StartServer == "" {
+		c.Commands.StartServer = t.startServer
+	}
+	if c.Server.StopConfirmRegex == "" {
+		c.Server.StopConfirmRegex = t.stopConfirmRegex
+	}
+	if c.Msh.StartupTimeout == 0 {
+		c.Msh.StartupTimeout = t.startupTimeout
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "applied server template: %s", c.Msh.Template)
+}
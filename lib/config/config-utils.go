@@ -3,44 +3,84 @@ package config
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"msh/lib/errco"
 	"msh/lib/model"
+	"msh/lib/servstats"
 	"msh/lib/utility"
 )
 
+// javaVersionRegex matches the java version line of 'java -version' output.
+// (lines added by wrappers/JVM warnings such as "Picked up _JAVA_OPTIONS: ..." don't match)
+var javaVersionRegex = regexp.MustCompile(`(?i)\b(?:java|openjdk)\s+(?:version\s+)?"?(\d+(?:[._]\d+)*)`)
+
+// envVarRegex matches environment variables in paths (ex: "$HOME", "${HOME}")
+var envVarRegex = regexp.MustCompile(`\$(\{\w+\}|\w+)`)
+
+// winEnvVarRegex matches windows environment variables in paths (ex: "%APPDATA%")
+var winEnvVarRegex = regexp.MustCompile(`%(\w+)%`)
+
+// serverFileModTime is the modification time of the server JAR file when version info was last loaded
+var serverFileModTime time.Time
+
+// msWhitelist caches the minecraft server whitelist.json file.
+// The cache is refreshed when the file modification time changes.
+// Player names received through rcon are added to the whitelist.json ones.
+var msWhitelist struct {
+	mu      sync.Mutex
+	modTime time.Time
+	list    []model.MSWhitelist
+	rcon    []string
+}
+
 // IsWhitelist checks if the parameters are in config whitelist.
 // (Currently this function accepts as arguments the client request packet and the client address)
+//
+// Minecraft server whitelist.json is used if WhitelistImport is enabled or if white-list=true in server.properties.
 func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *errco.MshLog {
 	var foundMatch bool = false
 
+	// minecraft server whitelist is imported if enabled in msh config or in minecraft server config
+	wlImport := c.Msh.WhitelistImport
+	if !wlImport {
+		if msConfigWhitelist, logMsh := c.ParsePropertiesBool("white-list"); logMsh == nil && msConfigWhitelist {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server whitelist enabled by server.properties")
+			wlImport = true
+		}
+	}
+
 	// check if at least one whitelist type is enabled
-	if !c.Msh.WhitelistImport && len(c.Msh.Whitelist) == 0 {
+	if !wlImport && len(c.Msh.Whitelist) == 0 {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "whitelist not enabled at all")
 		return nil
 	}
 
 	// check whitelist from minecraft server config
-	if c.Msh.WhitelistImport {
-		var wl []model.MSWhitelist
-
-		// read from file whitelist.json file
+	if wlImport {
 		// load minecraft server whitelist
 		// check elements of minecraft server whitelist against request packet
-		if data, err := os.ReadFile(filepath.Join(c.Server.Folder, "whitelist.json")); err != nil {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file file can't be read")
-		} else if err = json.Unmarshal(data, &wl); err != nil {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file format error")
+		if wl, logMsh := c.loadMSWhitelist(); logMsh != nil {
+			logMsh.Log(true)
 		} else {
 			for _, e := range wl {
 				// nameLen contains [ lenght of name + name ] (to increase safety)
@@ -92,14 +132,130 @@ func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *err
 	}
 }
 
+// WakeWhitelisted returns false if RespectWhitelist is enabled and the player is not in minecraft server whitelist.json.
+// Wakes are allowed if whitelisting is disabled in server.properties or if whitelist.json can't be loaded.
+func (c *Configuration) WakeWhitelisted(player string) bool {
+	if !c.Msh.RespectWhitelist {
+		return true
+	}
+
+	if msConfigWhitelist, logMsh := c.ParsePropertiesBool("white-list"); logMsh != nil || !msConfigWhitelist {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server whitelist not enabled by server.properties, wake allowed")
+		return true
+	}
+
+	wl, logMsh := c.loadMSWhitelist()
+	if logMsh != nil {
+		logMsh.Log(true)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server whitelist not available, wake allowed")
+		return true
+	}
+
+	return whitelistContains(wl, player)
+}
+
+// whitelistContains returns true if the player name is in the minecraft server whitelist (case insensitive)
+func whitelistContains(wl []model.MSWhitelist, player string) bool {
+	if player == "" {
+		return false
+	}
+
+	for _, e := range wl {
+		if strings.EqualFold(e.Name, player) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadMSWhitelist returns the minecraft server whitelist.
+// whitelist.json file is read again only if it was modified since the last read.
+func (c *Configuration) loadMSWhitelist() ([]model.MSWhitelist, *errco.MshLog) {
+	msWhitelist.mu.Lock()
+	defer msWhitelist.mu.Unlock()
+
+	wlFilePath := filepath.Join(c.Server.Folder, "whitelist.json")
+
+	fileInfo, err := os.Stat(wlFilePath)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file can't be read")
+	}
+
+	// whitelist.json was not modified since last read
+	if fileInfo.ModTime().Equal(msWhitelist.modTime) {
+		return mergeRconWhitelist(msWhitelist.list, msWhitelist.rcon), nil
+	}
+
+	var wl []model.MSWhitelist
+
+	// read from file whitelist.json file
+	if data, err := os.ReadFile(wlFilePath); err != nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file can't be read")
+	} else if err = json.Unmarshal(data, &wl); err != nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file format error")
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "loaded whitelist.json (%d players)", len(wl))
+
+	msWhitelist.modTime = fileInfo.ModTime()
+	msWhitelist.list = wl
+
+	return mergeRconWhitelist(msWhitelist.list, msWhitelist.rcon), nil
+}
+
+// SetRconWhitelist sets the minecraft server whitelist player names received through rcon
+func SetRconWhitelist(names []string) {
+	msWhitelist.mu.Lock()
+	defer msWhitelist.mu.Unlock()
+
+	msWhitelist.rcon = names
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "refreshed whitelist through rcon (%d players)", len(names))
+}
+
+// mergeRconWhitelist returns the whitelist.json players plus the rcon player names not in whitelist.json
+func mergeRconWhitelist(list []model.MSWhitelist, rcon []string) []model.MSWhitelist {
+	if len(rcon) == 0 {
+		return list
+	}
+
+	merged := append([]model.MSWhitelist{}, list...)
+rconLoop:
+	for _, name := range rcon {
+		for _, e := range list {
+			if strings.EqualFold(e.Name, name) {
+				continue rconLoop
+			}
+		}
+		merged = append(merged, model.MSWhitelist{Name: name})
+	}
+
+	return merged
+}
+
 // loadIcon tries to load user specified server icon (base-64 encoded and compressed).
 // The default icon is loaded by default
 func (c *Configuration) loadIcon() *errco.MshLog {
 	// set default server icon
 	ServerIcon = defaultServerIcon
 
+	// load remote server icon
+	if strings.HasPrefix(c.Msh.IconPath, "http://") || strings.HasPrefix(c.Msh.IconPath, "https://") {
+		icon, logMsh := loadRemoteIcon(c.Msh.IconPath)
+		if logMsh == nil {
+			ServerIcon = icon
+			return nil
+		}
+		// log and continue with the local icons
+		logMsh.Log(true)
+	}
+
 	// get the path of the user specified server icon
 	userIconPaths := []string{}
+	if c.Msh.IconPath != "" && !strings.Contains(c.Msh.IconPath, "://") {
+		userIconPaths = append(userIconPaths, c.Msh.IconPath)
+	}
 	userIconPaths = append(userIconPaths, filepath.Join(c.Server.Folder, "server-icon-frozen.png"))
 	userIconPaths = append(userIconPaths, filepath.Join(c.Server.Folder, "server-icon-frozen.jpg"))
 
@@ -159,6 +315,103 @@ func (c *Configuration) loadIcon() *errco.MshLog {
 	return nil
 }
 
+// loadRemoteIcon returns the base64 encoded server icon downloaded from url.
+// The icon must be a 64x64 png: it's cached in msh home so that it's downloaded only once.
+func loadRemoteIcon(url string) (string, *errco.MshLog) {
+	// the cache file name depends on the url so that a changed url is downloaded again
+	urlHash := sha256.Sum256([]byte(url))
+	cacheFile := filepath.Join(MshHome, fmt.Sprintf("msh-icon-%x.png", urlHash[:6]))
+
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		if logMsh := checkRemoteIcon(data); logMsh == nil {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "loaded server icon from cache %s", cacheFile)
+			return base64.RawStdEncoding.EncodeToString(data), nil
+		}
+	}
+
+	res, err := HttpClient(10 * time.Second).Get(url)
+	if err != nil {
+		return "", errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ICON_LOAD, "could not download server icon: %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ICON_LOAD, "could not download server icon: %s", res.Status)
+	}
+
+	// a 64x64 png is much smaller than 1 MB
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ICON_LOAD, "could not download server icon: %s", err.Error())
+	}
+
+	if logMsh := checkRemoteIcon(data); logMsh != nil {
+		return "", logMsh.AddTrace()
+	}
+
+	if logMsh := WritePersistFile(cacheFile, data); logMsh != nil {
+		logMsh.Log(true)
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "downloaded server icon from %s", url)
+
+	return base64.RawStdEncoding.EncodeToString(data), nil
+}
+
+// checkRemoteIcon returns nil if data is a 64x64 png image
+func checkRemoteIcon(data []byte) *errco.MshLog {
+	imgConf, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ICON_LOAD, "server icon is not a png image: %s", err.Error())
+	}
+	if imgConf.Width != 64 || imgConf.Height != 64 {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ICON_LOAD, "server icon must be 64x64 (got %dx%d)", imgConf.Width, imgConf.Height)
+	}
+
+	return nil
+}
+
+// RefreshVersionInfo reloads minecraft server version and protocol from the server JAR file
+// and saves them to config file if they changed.
+//
+// If force is false, version info is reloaded only if the server JAR file was modified.
+func RefreshVersionInfo(force bool) *errco.MshLog {
+	fi, err := os.Stat(filepath.Join(ConfigRuntime().Server.Folder, ConfigRuntime().Server.FileName))
+	if err != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_VERSION_LOAD, err.Error())
+	}
+
+	// server JAR file was not modified
+	if !force && fi.ModTime().Equal(serverFileModTime) {
+		return nil
+	}
+	serverFileModTime = fi.ModTime()
+
+	version, protocol, logMsh := ConfigRuntime().getVersionInfo()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	} else if version == "" || protocol == -1 {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_VERSION_LOAD, "version (%s) and protocol (%d) are invalid", version, protocol)
+	}
+
+	if version == ConfigRuntime().Server.Version && protocol == ConfigRuntime().Server.Protocol {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server version and protocol did not change (%s - %d)", version, protocol)
+		return nil
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server version and protocol updated: %s - %d", version, protocol)
+
+	ConfigRuntime().Server.Version, ConfigRuntime().Server.Protocol = version, protocol
+	ConfigDefault().Server.Version, ConfigDefault().Server.Protocol = version, protocol
+
+	logMsh = ConfigDefault().Save()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
 // getVersionInfo reads version.json from the server JAR file
 // and returns minecraft server version and protocol.
 //
@@ -201,6 +454,170 @@ func (c *Configuration) getVersionInfo() (string, int, *errco.MshLog) {
 	return "", -1, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_VERSION_LOAD, "minecraft server version and protocol could not be extracted from version.json")
 }
 
+// loadServerProperties loads ServMaxPlayers and ServMotd from server.properties.
+// If server.properties can't be read, the current values are kept.
+func (c *Configuration) loadServerProperties() {
+	data, err := os.ReadFile(filepath.Join(c.Server.Folder, "server.properties"))
+	if err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "server.properties can't be read, max players and motd not loaded")
+		return
+	}
+
+	if v, ok := propertiesValue(string(data), "max-players"); ok {
+		if maxPlayers, err := strconv.Atoi(v); err == nil {
+			ServMaxPlayers = maxPlayers
+		}
+	}
+	if v, ok := propertiesValue(string(data), "motd"); ok {
+		ServMotd = v
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server max players: %d, motd: %s", ServMaxPlayers, ServMotd)
+}
+
+// propertiesValue returns the unescaped value of a key in java properties data
+// (unlike ParsePropertiesString, whitespaces inside the value are kept)
+func propertiesValue(data, key string) (string, bool) {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		k, v, found := strings.Cut(line, "=")
+		if !found || strings.TrimSpace(k) != key {
+			continue
+		}
+
+		// unescape java properties value ("\u00a7", "\:", "\=", "\\")
+		v = strings.TrimSpace(v)
+		var b strings.Builder
+		for i := 0; i < len(v); i++ {
+			if v[i] != '\\' || i+1 == len(v) {
+				b.WriteByte(v[i])
+				continue
+			}
+			i++
+			switch {
+			case v[i] == 'u' && i+4 < len(v):
+				if r, err := strconv.ParseUint(v[i+1:i+5], 16, 32); err == nil {
+					b.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+				b.WriteString("\\u")
+			case v[i] == 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(v[i])
+			}
+		}
+
+		return b.String(), true
+	}
+
+	return "", false
+}
+
+// expandPaths expands "~" and environment variables in the path config fields
+func (c *Configuration) expandPaths() {
+	for _, p := range []*string{&c.Server.Folder, &c.Server.FileName, &c.Msh.LogFile, &c.Msh.StatsFile} {
+		*p = expandPath(*p)
+	}
+
+	// IconPath might be an url
+	if !strings.HasPrefix(c.Msh.IconPath, "http://") && !strings.HasPrefix(c.Msh.IconPath, "https://") {
+		c.Msh.IconPath = expandPath(c.Msh.IconPath)
+	}
+}
+
+// expandPath replaces a leading "~" with the user home directory and
+// substitutes environment variables ("$VAR", "${VAR}" and "%VAR%" on windows).
+// Undefined environment variables are kept as they are.
+func expandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		} else {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONFIG_LOAD, "could not expand ~ in %s: %s", path, err.Error())
+		}
+	}
+
+	path = envVarRegex.ReplaceAllStringFunc(path, func(m string) string {
+		if v, ok := os.LookupEnv(strings.Trim(m[1:], "{}")); ok {
+			return v
+		}
+		return m
+	})
+
+	if runtime.GOOS == "windows" {
+		path = winEnvVarRegex.ReplaceAllStringFunc(path, func(m string) string {
+			if v, ok := os.LookupEnv(m[1 : len(m)-1]); ok {
+				return v
+			}
+			return m
+		})
+	}
+
+	return path
+}
+
+// parseHostPort parses a host optionally followed by a port.
+// Accepted formats: "127.0.0.1", "127.0.0.1:25565", "::1", "[::1]", "[::1]:25565", "example.com", "example.com:25565".
+// Returns the host (without brackets), the port (0 if not specified) and false if addr is invalid.
+func parseHostPort(addr string) (string, int, bool) {
+	addr = strings.TrimSpace(addr)
+
+	var host, port string
+	switch {
+	case strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]"):
+		// bracketed ipv6 literal without port
+		host = addr[1 : len(addr)-1]
+	case strings.Count(addr, ":") > 1 && !strings.HasPrefix(addr, "["):
+		// ipv6 literal without brackets (can't include a port)
+		host = addr
+	case strings.Contains(addr, ":"):
+		var err error
+		host, port, err = net.SplitHostPort(addr)
+		if err != nil {
+			return "", 0, false
+		}
+	default:
+		host = addr
+	}
+
+	if host == "" || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+		return "", 0, false
+	}
+
+	if port == "" {
+		return host, 0, true
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return "", 0, false
+	}
+
+	return host, p, true
+}
+
+// loadTargets returns the backend addresses: the primary address followed by the valid targets.
+// Invalid targets are skipped with a warning.
+func loadTargets(primary string, targets []model.Target) []string {
+	addrs := []string{primary}
+
+	for n, t := range targets {
+		host, _, ok := parseHostPort(t.Host)
+		if !ok || t.Port < 1 || t.Port > 65535 {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "failover target %d (%s:%d) is invalid, skipped", n, t.Host, t.Port)
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(t.Port)))
+	}
+
+	return addrs
+}
+
 // ParsePropertiesString reads server.properties file and returns the requested variable
 func (c *Configuration) ParsePropertiesString(key string) (string, *errco.MshLog) {
 	data, err := os.ReadFile(filepath.Join(c.Server.Folder, "server.properties"))
@@ -279,3 +696,219 @@ func (c *Configuration) ParsePropertiesBool(key string) (bool, *errco.MshLog) {
 
 	return false, errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "key (%s) not found while parsing server.properties", key)
 }
+
+// parseJavaVersion parses the output (stdout and stderr) of 'java -version'.
+// Returns the version line, the parsed java version and true if a version line was found.
+//
+// The first line matching javaVersionRegex is used (ex: `openjdk version "17.0.2" 2022-01-18`).
+// Legacy versions "1.x" are converted to major version x.
+func parseJavaVersion(out string) (string, model.JavaVersion, bool) {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+
+		m := javaVersionRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		jv := model.JavaVersion{Full: m[1]}
+		parts := strings.FieldsFunc(m[1], func(r rune) bool { return r == '.' || r == '_' })
+		jv.Major, _ = strconv.Atoi(parts[0])
+		if jv.Major == 1 && len(parts) > 1 {
+			jv.Major, _ = strconv.Atoi(parts[1])
+		}
+
+		return line, jv, true
+	}
+
+	return "", model.JavaVersion{}, false
+}
+
+// javaBinary returns the java binary used by the start command and true if the start command runs java directly.
+// If the start command runs something else (ex: a wrapper script), "java" (on PATH) and false are returned.
+func (c *Configuration) javaBinary() (string, bool) {
+	command, _ := c.BuildCommandStartServer()
+	if len(command) == 0 {
+		return "java", false
+	}
+
+	switch strings.ToLower(filepath.Base(command[0])) {
+	case "java", "java.exe", "javaw.exe":
+		return command[0], true
+	default:
+		return "java", false
+	}
+}
+
+// checkJavaCompat sets a major error if the start command java is older than the one required by ms version.
+// If the start command does not run java directly, the java on PATH might not be the one used by ms:
+// a warning is logged instead.
+// If java or ms version are unknown, the check is skipped.
+func (c *Configuration) checkJavaCompat() {
+	if JavaVersion.Major == 0 {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "java version unknown, java compatibility check skipped")
+		return
+	}
+
+	minJava, ok := minJavaMajor(c.Server.Version, c.Server.Protocol)
+	if !ok {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft version unknown (%s, protocol %d), java compatibility check skipped", c.Server.Version, c.Server.Protocol)
+		return
+	}
+
+	if JavaVersion.Major < minJava {
+		if _, direct := c.javaBinary(); !direct {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft %s requires Java %d, found Java %d on PATH (start command does not run java directly)", c.Server.Version, minJava, JavaVersion.Major)
+			return
+		}
+		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft %s requires Java %d, found Java %d", c.Server.Version, minJava, JavaVersion.Major)
+		servstats.Stats.SetMajorError(logMsh)
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "java %d is compatible with minecraft %s (requires java %d)", JavaVersion.Major, c.Server.Version, minJava)
+}
+
+// minJavaMajor returns the minimum java major version required by a minecraft version.
+// The version ("1.x.y") is used if it can be parsed, otherwise the protocol is used
+// (snapshot protocols are not considered). Returns false if both are unknown.
+//
+// 1.20.5+ requires java 21, 1.18+ java 17, 1.17 java 16, older versions java 8.
+func minJavaMajor(version string, protocol int) (int, bool) {
+	parts := strings.Split(strings.TrimSpace(version), ".")
+	if len(parts) >= 2 && parts[0] == "1" {
+		minor, err := strconv.Atoi(parts[1])
+		if err == nil {
+			patch := 0
+			if len(parts) >= 3 {
+				patch, _ = strconv.Atoi(parts[2])
+			}
+
+			switch {
+			case minor > 20 || (minor == 20 && patch >= 5):
+				return 21, true
+			case minor >= 18:
+				return 17, true
+			case minor == 17:
+				return 16, true
+			default:
+				return 8, true
+			}
+		}
+	}
+
+	// snapshot protocols have bit 30 set
+	switch {
+	case protocol <= 0 || protocol >= 0x40000000:
+		return 0, false
+	case protocol >= 766:
+		return 21, true
+	case protocol >= 757:
+		return 17, true
+	case protocol >= 755:
+		return 16, true
+	default:
+		return 8, true
+	}
+}
+
+// maxBootstrapAttempts is the maximum number of times auto bootstrap runs the minecraft server to regenerate its files
+const maxBootstrapAttempts int = 3
+
+// runBootstrap runs the minecraft server so that it generates eula.txt and server.properties and exits
+// (minecraft server exits as eula is not accepted).
+func (c *Configuration) runBootstrap(command []string) *errco.MshLog {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = c.Server.Folder
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	fmt.Print(errco.COLOR_CYAN) // set color to server log color
+	err := cmd.Run()
+	fmt.Print(errco.COLOR_RESET) // reset color
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "couldn't start minecraft server to generate eula.txt (%s)", err.Error())
+	}
+
+	return nil
+}
+
+// autoBootstrap regenerates eula.txt and server.properties if they are missing (ex: after a world reset)
+// and accepts the eula.
+//
+// The minecraft server is run at most maxBootstrapAttempts times.
+// If AutoBootstrap is disabled or no file is missing, returns nil.
+func (c *Configuration) autoBootstrap() *errco.MshLog {
+	if !c.Server.AutoBootstrap {
+		return nil
+	}
+
+	eulaFilePath := filepath.Join(c.Server.Folder, "eula.txt")
+	propFilePath := filepath.Join(c.Server.Folder, "server.properties")
+
+	for attempt := 1; ; attempt++ {
+		missing := []string{}
+		for _, f := range []string{eulaFilePath, propFilePath} {
+			if _, err := os.Stat(f); errors.Is(err, os.ErrNotExist) {
+				missing = append(missing, filepath.Base(f))
+			}
+		}
+
+		if len(missing) == 0 {
+			break
+		}
+
+		if attempt > maxBootstrapAttempts {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "auto bootstrap failed after %d attempts, still missing: %s", maxBootstrapAttempts, strings.Join(missing, ", "))
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server files missing (%s), bootstrapping minecraft server (attempt %d/%d)...", strings.Join(missing, ", "), attempt, maxBootstrapAttempts)
+
+		// eula must not be accepted during bootstrap, otherwise minecraft server would not exit
+		if err := os.WriteFile(eulaFilePath, []byte("eula=false\n"), 0644); err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "auto bootstrap could not write eula.txt (%s)", err.Error())
+		}
+
+		command, logMsh := c.BuildCommandStartServer()
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		if logMsh := c.runBootstrap(command); logMsh != nil {
+			// minecraft server might exit with error when eula is not accepted, missing files are checked again
+			logMsh.Log(true)
+		}
+	}
+
+	// accept eula (AutoBootstrap implies eula acceptance)
+	eulaData, err := os.ReadFile(eulaFilePath)
+	if err == nil && strings.Contains(strings.ReplaceAll(strings.ToLower(string(eulaData)), " ", ""), "eula=true") {
+		return nil
+	}
+	if err := os.WriteFile(eulaFilePath, []byte("eula=true\n"), 0644); err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "auto bootstrap could not accept eula.txt (%s)", err.Error())
+	}
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "auto bootstrap accepted eula.txt")
+
+	return nil
+}
+
+// checkDocker checks that docker is installed and that the minecraft server container exists
+func (c *Configuration) checkDocker() *errco.MshLog {
+	if c.Server.Container == "" {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "server type \"docker\" requires Server.Container")
+	}
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "docker not installed")
+	}
+
+	out, err := exec.Command("docker", "inspect", "--format", "{{.State.Running}}", c.Server.Container).CombinedOutput()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "docker container %s not found (%s)", c.Server.Container, strings.TrimSpace(string(out)))
+	}
+
+	if strings.TrimSpace(string(out)) == "true" {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "docker container %s is already running, msh will attach to it at the first minecraft server start", c.Server.Container)
+	}
+
+	return nil
+}
@@ -0,0 +1,607 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"msh/lib/model"
+)
+
+func Test_parseJavaVersion(t *testing.T) {
+	tests := []struct {
+		title      string
+		out        string
+		expectLine string
+		expect     model.JavaVersion
+		expectOk   bool
+	}{
+		{
+			"openjdk 8",
+			"openjdk version \"1.8.0_292\"\nOpenJDK Runtime Environment (build 1.8.0_292-8u292-b10-0ubuntu1~20.04-b10)\nOpenJDK 64-Bit Server VM (build 25.292-b10, mixed mode)\n",
+			"openjdk version \"1.8.0_292\"",
+			model.JavaVersion{Major: 8, Full: "1.8.0_292"},
+			true,
+		},
+		{
+			"oracle 21 (windows line endings)",
+			"java version \"21.0.1\" 2023-10-17 LTS\r\nJava(TM) SE Runtime Environment (build 21.0.1+12-LTS-29)\r\n",
+			"java version \"21.0.1\" 2023-10-17 LTS",
+			model.JavaVersion{Major: 21, Full: "21.0.1"},
+			true,
+		},
+		{
+			"temurin 17 with _JAVA_OPTIONS warning",
+			"Picked up _JAVA_OPTIONS: -Xmx512m -Dfoo=1\nopenjdk version \"17.0.2\" 2022-01-18\nOpenJDK Runtime Environment Temurin-17.0.2+8 (build 17.0.2+8)\n",
+			"openjdk version \"17.0.2\" 2022-01-18",
+			model.JavaVersion{Major: 17, Full: "17.0.2"},
+			true,
+		},
+		{
+			"zulu 11 with JDK_JAVA_OPTIONS note",
+			"NOTE: Picked up JDK_JAVA_OPTIONS: --add-opens=java.base/java.lang=ALL-UNNAMED\nopenjdk version \"11.0.20\" 2023-07-18 LTS\nOpenJDK Runtime Environment Zulu11.66+15-CA (build 11.0.20+8-LTS)\n",
+			"openjdk version \"11.0.20\" 2023-07-18 LTS",
+			model.JavaVersion{Major: 11, Full: "11.0.20"},
+			true,
+		},
+		{
+			"--version output format",
+			"openjdk 16.0.1 2021-04-20\nOpenJDK Runtime Environment (build 16.0.1+9-24)\n",
+			"openjdk 16.0.1 2021-04-20",
+			model.JavaVersion{Major: 16, Full: "16.0.1"},
+			true,
+		},
+		{
+			"java 9 (major only)",
+			"java version \"9\"\n",
+			"java version \"9\"",
+			model.JavaVersion{Major: 9, Full: "9"},
+			true,
+		},
+		{
+			"no version",
+			"Error: could not create the Java Virtual Machine.\n",
+			"",
+			model.JavaVersion{},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		line, jv, ok := parseJavaVersion(tt.out)
+		if line != tt.expectLine || jv != tt.expect || ok != tt.expectOk {
+			t.Errorf("%s: expected (%q, %+v, %t), got (%q, %+v, %t)", tt.title, tt.expectLine, tt.expect, tt.expectOk, line, jv, ok)
+		}
+	}
+}
+
+func Test_noProxyMatch(t *testing.T) {
+	tests := []struct {
+		noProxy string
+		host    string
+		expect  bool
+	}{
+		{"", "api.example.com", false},
+		{"*", "api.example.com", true},
+		{"example.com", "example.com", true},
+		{"example.com", "api.example.com:443", true},
+		{"example.com", "notexample.com", false},
+		{".example.com", "api.example.com", true},
+		{".example.com", "example.com", false},
+		{"localhost, 127.0.0.1", "127.0.0.1:9091", true},
+		{"10.0.0.0/8", "10.1.2.3:9091", true},
+		{"10.0.0.0/8", "192.168.1.1", false},
+		{"pushgateway:9091", "pushgateway:9091", true},
+		{"pushgateway:9091", "pushgateway:80", false},
+	}
+
+	for _, tt := range tests {
+		if got := noProxyMatch(tt.noProxy, tt.host); got != tt.expect {
+			t.Errorf("noProxy %q, host %q: expected %t, got %t", tt.noProxy, tt.host, tt.expect, got)
+		}
+	}
+}
+
+func Test_loadEnv(t *testing.T) {
+	t.Setenv("MSH_SERVER_FOLDER", "/srv/mc")
+	t.Setenv("MSH_LISTEN_PORT", "25570")
+	t.Setenv("MSH_TIMEOUT", "abc")
+	t.Setenv("MSH_SUSPEND_ALLOW", "true")
+
+	c := &Configuration{}
+	c.Msh.TimeBeforeStoppingEmptyServer = 30
+	c.loadEnv()
+
+	if c.Server.Folder != "/srv/mc" {
+		t.Errorf("expected Server.Folder /srv/mc but got %s", c.Server.Folder)
+	}
+	if c.Msh.MshPort != 25570 {
+		t.Errorf("expected Msh.MshPort 25570 but got %d", c.Msh.MshPort)
+	}
+	if c.Msh.TimeBeforeStoppingEmptyServer != 30 {
+		t.Errorf("expected invalid MSH_TIMEOUT to be ignored but got %d", c.Msh.TimeBeforeStoppingEmptyServer)
+	}
+	if !c.Msh.SuspendAllow {
+		t.Errorf("expected Msh.SuspendAllow true")
+	}
+}
+
+func Test_migrateConfig(t *testing.T) {
+	// config file without version is upgraded, existing fields are kept
+	data, migrated, logMsh := migrateConfig([]byte(`{"Server": {"Folder": "/srv/mc"}, "Msh": {"VerifyBackend": false}}`))
+	if logMsh != nil || !migrated {
+		t.Fatalf("expected migration, got (%v, %v)", migrated, logMsh)
+	}
+
+	c := &Configuration{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Msh.ConfigVersion != configVersion || c.Server.Folder != "/srv/mc" || c.Server.Type != "java" || c.Msh.VerifyBackend || c.Msh.SessionSummaryLevel != 1 {
+		t.Errorf("unexpected migrated config: %s", data)
+	}
+
+	// Msh.StartingDisplay of version 1 config files is moved to Msh.Ping.StartingDisplay
+	data1, migrated, logMsh := migrateConfig([]byte(`{"Msh": {"ConfigVersion": 1, "StartingDisplay": "dash", "Ping": {"SampleAppend": ["a"]}}}`))
+	if logMsh != nil || !migrated {
+		t.Fatalf("expected migration, got (%v, %v)", migrated, logMsh)
+	}
+	c = &Configuration{}
+	if err := json.Unmarshal(data1, &c); err != nil {
+		t.Fatal(err)
+	}
+	raw := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(data1, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["Msh"]["StartingDisplay"]; ok || c.Msh.Ping.StartingDisplay != "dash" || len(c.Msh.Ping.SampleAppend) != 1 {
+		t.Errorf("unexpected migrated config: %s", data1)
+	}
+
+	// config file at current version is not modified
+	if _, migrated, _ := migrateConfig(data); migrated {
+		t.Errorf("expected no migration for current config version")
+	}
+}
+
+func Test_inScheduleWindow(t *testing.T) {
+	type test struct {
+		window model.ScheduleWindow
+		time   string // "2006-01-02 15:04" (2023-01-02 is a monday)
+		expIn  bool
+	}
+
+	weekdays := []string{"mon", "tue", "wed", "thu", "fri"}
+
+	var tests []test = []test{
+		{model.ScheduleWindow{Days: weekdays, Start: "16:00", End: "23:00"}, "2023-01-02 16:00", true},
+		{model.ScheduleWindow{Days: weekdays, Start: "16:00", End: "23:00"}, "2023-01-02 23:00", false},
+		{model.ScheduleWindow{Days: weekdays, Start: "16:00", End: "23:00"}, "2023-01-07 18:00", false},
+		{model.ScheduleWindow{Start: "16:00", End: "23:00"}, "2023-01-07 18:00", true},
+		// window crossing midnight belongs to the day in which it starts
+		{model.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}, "2023-01-06 23:30", true},
+		{model.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}, "2023-01-07 01:30", true},
+		{model.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "02:00"}, "2023-01-06 01:30", false},
+		// invalid windows
+		{model.ScheduleWindow{Days: []string{"fryday"}, Start: "22:00", End: "02:00"}, "2023-01-06 23:30", false},
+		{model.ScheduleWindow{Start: "25:00", End: "02:00"}, "2023-01-06 23:30", false},
+	}
+
+	for _, tt := range tests {
+		tm, _ := time.ParseInLocation("2006-01-02 15:04", tt.time, time.Local)
+		if in := inScheduleWindow(tt.window, tm); in != tt.expIn {
+			t.Errorf("inScheduleWindow(%v, %s) = %v, want %v", tt.window, tt.time, in, tt.expIn)
+		}
+	}
+}
+
+func Test_IpWakeAllowed(t *testing.T) {
+	type test struct {
+		allowed []string
+		blocked []string
+		address string
+		expOk   bool
+	}
+
+	var tests []test = []test{
+		{[]string{}, []string{}, "203.0.113.5", true},
+		{[]string{"192.168.1.0/24"}, []string{}, "192.168.1.20", true},
+		{[]string{"192.168.1.0/24"}, []string{}, "192.168.2.20", false},
+		{[]string{"192.168.1.0/24"}, []string{"192.168.1.20"}, "192.168.1.20", false},
+		{[]string{"2001:db8::/32"}, []string{}, "[2001:db8::1]", true},
+		{[]string{}, []string{"2001:db8::/32"}, "[2001:db8::1]", false},
+		{[]string{}, []string{"::1"}, "[::1]", false},
+		{[]string{"invalid"}, []string{}, "203.0.113.5", true},
+	}
+
+	for _, tt := range tests {
+		allowedNets = parseIpNets(tt.allowed, "AllowedIPs")
+		blockedNets = parseIpNets(tt.blocked, "BlockedIPs")
+		if ok := IpWakeAllowed(tt.address); ok != tt.expOk {
+			t.Errorf("IpWakeAllowed(%s) with allowed %v, blocked %v = %v, want %v", tt.address, tt.allowed, tt.blocked, ok, tt.expOk)
+		}
+	}
+}
+
+func Test_whitelistContains(t *testing.T) {
+	wl := []model.MSWhitelist{{Name: "gekigek99"}, {Name: "Notch"}}
+
+	type test struct {
+		player string
+		expOk  bool
+	}
+
+	var tests []test = []test{
+		{"gekigek99", true},
+		{"notch", true},
+		{"gekigek99-twin", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if ok := whitelistContains(wl, tt.player); ok != tt.expOk {
+			t.Errorf("whitelistContains(%q) = %v, want %v", tt.player, ok, tt.expOk)
+		}
+	}
+}
+
+func Test_defaultStartupDoneRegex(t *testing.T) {
+	re := regexp.MustCompile(defaultStartupDoneRegex)
+
+	type test struct {
+		line  string
+		expOk bool
+	}
+
+	var tests []test = []test{
+		{`[12:00:00] [Server thread/INFO]: Done (4.512s)! For help, type "help"`, true},
+		{`[12:00:00 INFO]: Done (12.3s)! For help, type "help"`, true},
+		{`[12:00:00] [Server thread/INFO] [minecraft/DedicatedServer]: Done (30.1s)! For help, type "help"`, true},
+		{`[12:00:00] [Server thread/INFO]: Preparing spawn area: 84%`, false},
+		{`[12:00:00] [Server thread/INFO]: <player> Done`, false},
+	}
+
+	for _, tt := range tests {
+		if ok := re.MatchString(tt.line); ok != tt.expOk {
+			t.Errorf("defaultStartupDoneRegex match %q = %v, want %v", tt.line, ok, tt.expOk)
+		}
+	}
+}
+
+func Test_encryptSecret(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+
+	for _, plain := range []string{"", "password", "https://discord.com/api/webhooks/1/abc"} {
+		enc, err := encryptSecret(key, plain)
+		if err != nil {
+			t.Fatalf("encryptSecret(%q) error: %v", plain, err)
+		}
+		if !strings.HasPrefix(enc, secretPrefix) {
+			t.Errorf("encryptSecret(%q) = %q, missing prefix %q", plain, enc, secretPrefix)
+		}
+
+		dec, err := decryptSecret(key, enc)
+		if err != nil || dec != plain {
+			t.Errorf("decryptSecret(encryptSecret(%q)) = %q, %v", plain, dec, err)
+		}
+
+		if _, err := decryptSecret(otherKey, enc); err == nil {
+			t.Errorf("decryptSecret with wrong key succeeded for %q", plain)
+		}
+	}
+
+	if _, err := decryptSecret(key, secretPrefix+"not base64!"); err == nil {
+		t.Errorf("decryptSecret of invalid value succeeded")
+	}
+}
+
+func Test_propertiesValue(t *testing.T) {
+	data := "#Minecraft server properties\nmax-players=20\nmotd=A Minecraft \\u00a7bServer\\: 1\nlevel-name = world \n"
+
+	type test struct {
+		key      string
+		expValue string
+		expOk    bool
+	}
+
+	var tests []test = []test{
+		{"max-players", "20", true},
+		{"motd", "A Minecraft §bServer: 1", true},
+		{"level-name", "world", true},
+		{"server-port", "", false},
+	}
+
+	for _, tt := range tests {
+		value, ok := propertiesValue(data, tt.key)
+		if value != tt.expValue || ok != tt.expOk {
+			t.Errorf("propertiesValue(%s) = (%q, %v), want (%q, %v)", tt.key, value, ok, tt.expValue, tt.expOk)
+		}
+	}
+}
+
+func Test_checkRemoteIcon(t *testing.T) {
+	encode := func(w, h int) []byte {
+		buff := &bytes.Buffer{}
+		png.Encode(buff, image.NewRGBA(image.Rect(0, 0, w, h)))
+		return buff.Bytes()
+	}
+
+	if logMsh := checkRemoteIcon(encode(64, 64)); logMsh != nil {
+		t.Errorf("64x64 png: unexpected error: %s", logMsh.Mex)
+	}
+	if logMsh := checkRemoteIcon(encode(128, 128)); logMsh == nil {
+		t.Error("128x128 png: expected error")
+	}
+	if logMsh := checkRemoteIcon([]byte("<html></html>")); logMsh == nil {
+		t.Error("not a png: expected error")
+	}
+}
+
+func Test_expandPath(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	os.Setenv("MSH_TEST_DIR", "/srv/mc")
+	defer os.Unsetenv("MSH_TEST_DIR")
+
+	type test struct {
+		path    string
+		expPath string
+	}
+
+	var tests []test = []test{
+		{"/opt/minecraft", "/opt/minecraft"},
+		{"server.jar", "server.jar"},
+		{"", ""},
+		{"~", home},
+		{"~/minecraft", home + "/minecraft"},
+		{"~user/minecraft", "~user/minecraft"},
+		{"$MSH_TEST_DIR/world", "/srv/mc/world"},
+		{"${MSH_TEST_DIR}/world", "/srv/mc/world"},
+		{"$MSH_TEST_UNDEFINED/world", "$MSH_TEST_UNDEFINED/world"},
+		{"${MSH_TEST_UNDEFINED}/world", "${MSH_TEST_UNDEFINED}/world"},
+		{"/srv/$/world", "/srv/$/world"},
+	}
+
+	for _, tt := range tests {
+		if path := expandPath(tt.path); path != tt.expPath {
+			t.Errorf("expandPath(%s) = %s, want %s", tt.path, path, tt.expPath)
+		}
+	}
+}
+
+func Test_minJavaMajor(t *testing.T) {
+	type test struct {
+		version  string
+		protocol int
+		expMajor int
+		expOk    bool
+	}
+
+	var tests []test = []test{
+		{"1.12.2", 340, 8, true},
+		{"1.16.5", 754, 8, true},
+		{"1.17.1", 756, 16, true},
+		{"1.18", 757, 17, true},
+		{"1.20.4", 765, 17, true},
+		{"1.20.5", 766, 21, true},
+		{"1.21", 767, 21, true},
+		{"23w31a", 763, 17, true},
+		{"24w14a", 0x40000000 + 185, 0, false},
+		{"", -1, 0, false},
+	}
+
+	for _, tt := range tests {
+		major, ok := minJavaMajor(tt.version, tt.protocol)
+		if major != tt.expMajor || ok != tt.expOk {
+			t.Errorf("minJavaMajor(%s, %d) = (%d, %v), want (%d, %v)", tt.version, tt.protocol, major, ok, tt.expMajor, tt.expOk)
+		}
+	}
+}
+
+func Test_loadTargets(t *testing.T) {
+	targets := []model.Target{
+		{Host: "10.0.0.2", Port: 25565},
+		{Host: "::1", Port: 25566},
+		{Host: "standby.local", Port: 0},
+		{Host: "", Port: 25565},
+	}
+
+	exp := []string{"127.0.0.1:25565", "10.0.0.2:25565", "[::1]:25566"}
+
+	addrs := loadTargets("127.0.0.1:25565", targets)
+	if !reflect.DeepEqual(addrs, exp) {
+		t.Errorf("loadTargets() = %v, want %v", addrs, exp)
+	}
+}
+
+func Test_parseHostPort(t *testing.T) {
+	type test struct {
+		addr    string
+		expHost string
+		expPort int
+		expOk   bool
+	}
+
+	var tests []test = []test{
+		{"127.0.0.1", "127.0.0.1", 0, true},
+		{"0.0.0.0:25565", "0.0.0.0", 25565, true},
+		{"::", "::", 0, true},
+		{"::1", "::1", 0, true},
+		{"[::1]", "::1", 0, true},
+		{"[2001:db8::1]:25565", "2001:db8::1", 25565, true},
+		{"mc.example.com", "mc.example.com", 0, true},
+		{"mc.example.com:25566", "mc.example.com", 25566, true},
+		{"127.0.0.1:99999", "", 0, false},
+		{"[::1]:port", "", 0, false},
+		{"2001:db8::zz", "", 0, false},
+		{"", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		host, port, ok := parseHostPort(tt.addr)
+		if host != tt.expHost || port != tt.expPort || ok != tt.expOk {
+			t.Errorf("parseHostPort(%s) = (%s, %d, %v), want (%s, %d, %v)", tt.addr, host, port, ok, tt.expHost, tt.expPort, tt.expOk)
+		}
+	}
+}
+
+func Test_resolvePlaceholders(t *testing.T) {
+	c := &Configuration{}
+	c.Server.FileName = "server.jar"
+	c.Server.Version = "1.20.1"
+	c.Commands.StartServerParam = "-Xmx1G -Xms1G"
+	c.Msh.ID = "abc123"
+
+	type test struct {
+		template string
+		expected string
+	}
+
+	var tests []test = []test{
+		{"version <Server.Version> (<Msh.ID>)", "version 1.20.1 (abc123)"},
+		{"java <Commands.StartServerParam> -jar <Server.FileName>", "java -Xmx1G -Xms1G -jar server.jar"},
+		{"<Unknown.Token> stays", "<Unknown.Token> stays"},
+		{`\<Server.Version\> is literal`, "<Server.Version> is literal"},
+		{"1 < 2 > 0", "1 < 2 > 0"},
+	}
+
+	for _, tt := range tests {
+		if res := c.resolvePlaceholders(tt.template); res != tt.expected {
+			t.Errorf("resolvePlaceholders(%q) = %q, want %q", tt.template, res, tt.expected)
+		}
+	}
+
+	command := c.BuildCommand("java <Commands.StartServerParam> -jar <Server.FileName> nogui")
+	if strings.Join(command, "|") != "java|-Xmx1G|-Xms1G|-jar|server.jar|nogui" {
+		t.Errorf("BuildCommand: got %v", command)
+	}
+}
+
+func Test_javaBinary(t *testing.T) {
+	type test struct {
+		startServer string
+		expBin      string
+		expDirect   bool
+	}
+
+	var tests []test = []test{
+		{"java -jar server.jar nogui", "java", true},
+		{"/opt/jdk-21/bin/java -Xmx2G -jar server.jar", "/opt/jdk-21/bin/java", true},
+		{"./run.sh nogui", "java", false},
+		{"", "java", false},
+	}
+
+	for _, tt := range tests {
+		c := &Configuration{}
+		c.Commands.StartServer = tt.startServer
+		if bin, direct := c.javaBinary(); bin != tt.expBin || direct != tt.expDirect {
+			t.Errorf("javaBinary(%q) = (%s, %v), want (%s, %v)", tt.startServer, bin, direct, tt.expBin, tt.expDirect)
+		}
+	}
+}
+
+func Test_applyReload(t *testing.T) {
+	oldDef := &Configuration{}
+	oldDef.Msh.TimeBeforeStoppingEmptyServer = 30
+	oldDef.Msh.InfoHibernation = "hibernating"
+	oldDef.Msh.MshPort = 25555
+	oldDef.Commands.StartServerParam = "-Xmx1G"
+
+	newDef := &Configuration{}
+	*newDef = *oldDef
+	newDef.Msh.TimeBeforeStoppingEmptyServer = 60 // hot
+	newDef.Msh.MshPort = 25556                    // cold
+	newDef.Commands.StartServerParam = "-Xmx2G"   // hot, overridden by flag
+
+	run := &Configuration{}
+	*run = *oldDef
+	run.Commands.StartServerParam = "-Xmx4G"
+
+	overriddenFields = map[string]bool{"Commands.StartServerParam": true}
+	defer func() { overriddenFields = nil }()
+
+	if diff := diffFields(oldDef, newDef); strings.Join(diff, ",") != "Commands.StartServerParam,Msh.MshPort,Msh.TimeBeforeStoppingEmptyServer" {
+		t.Errorf("diffFields: got %v", diff)
+	}
+
+	applied := applyReload(oldDef, newDef, run)
+	if strings.Join(applied, ",") != "Msh.TimeBeforeStoppingEmptyServer" {
+		t.Errorf("applyReload: applied %v", applied)
+	}
+	if run.Msh.TimeBeforeStoppingEmptyServer != 60 || run.Msh.MshPort != 25555 || run.Commands.StartServerParam != "-Xmx4G" || run.Msh.InfoHibernation != "hibernating" {
+		t.Errorf("applyReload: got %+v", run.Configuration)
+	}
+}
+
+func Test_checkRuntimeStartupTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		regex   string
+		timeout int
+		expect  int
+	}{
+		{"", 0, 0},
+		{"Proxy started", 0, defaultStartupTimeout},
+		{"Proxy started", 120, 120},
+	} {
+		c := &Configuration{}
+		c.Server.StartupDoneRegex, c.Msh.StartupTimeout = tt.regex, tt.timeout
+		c.checkRuntime()
+		if c.Msh.StartupTimeout != tt.expect {
+			t.Errorf("checkRuntime(StartupDoneRegex %q, StartupTimeout %d): StartupTimeout %d, want %d", tt.regex, tt.timeout, c.Msh.StartupTimeout, tt.expect)
+		}
+	}
+}
+
+func Test_loadCheckOnly(t *testing.T) {
+	defer func() { CheckOnly = false }()
+
+	for _, tt := range []struct {
+		args   []string
+		expect bool
+	}{
+		{[]string{"-d", "3"}, false},
+		{[]string{"-check"}, true},
+		{[]string{"-d", "3", "--check"}, true},
+		{[]string{"-check=true"}, true},
+		{[]string{"check"}, false},
+		{[]string{"-checkx"}, false},
+	} {
+		CheckOnly = false
+		loadCheckOnly(tt.args)
+		if CheckOnly != tt.expect {
+			t.Errorf("loadCheckOnly(%v): CheckOnly %v, want %v", tt.args, CheckOnly, tt.expect)
+		}
+	}
+}
+
+func Test_writeFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/msh.instance"
+
+	for _, data := range []string{"first content", "second"} {
+		if err := writeFileAtomic(path, []byte(data)); err != nil {
+			t.Fatalf("writeFileAtomic: %s", err.Error())
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != data {
+			t.Errorf("writeFileAtomic: read %q (%v), want %q", got, err, data)
+		}
+	}
+
+	// temporary files are not left in the directory
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("writeFileAtomic: %d files in directory, want 1", len(entries))
+	}
+
+	// a failed write returns an error
+	if err := writeFileAtomic(dir+"/missing/msh.instance", []byte("x")); err == nil {
+		t.Errorf("writeFileAtomic: no error writing in a missing directory")
+	}
+}
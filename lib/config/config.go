@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"msh/lib/errco"
 	"msh/lib/model"
@@ -21,23 +27,98 @@ import (
 var (
 	configFileName string = "msh-config.json" // configFileName is the config file name
 
-	ConfigDefault *Configuration = &Configuration{} // ConfigDefault contains parameters of config in file
-	ConfigRuntime *Configuration = &Configuration{} // ConfigRuntime contains parameters of config in runtime
+	MshHome string // MshHome is the directory containing msh config and state files (MSH_HOME / -home, default: working directory)
+
+	configDefault atomic.Pointer[Configuration] // configDefault contains parameters of config in file
+	configRuntime atomic.Pointer[Configuration] // configRuntime contains parameters of config in runtime
 
 	configDefaultSave bool = false // if true, the config will be saved after successful loading
 
-	JavaV string // Javav is the java version on the system. format: "java 16.0.1 2021-04-20"
+	JavaV       string            // Javav is the java version on the system. format: "java 16.0.1 2021-04-20"
+	JavaVersion model.JavaVersion // JavaVersion is the parsed java version on the system (Major is 0 if unknown)
 
 	ServerIcon string = defaultServerIcon // ServerIcon contains the minecraft server icon
 
-	MshHost       string = "0.0.0.0"   // MshHost		is the ip address for clients to connect to msh
-	MshPort       int                  // MshPort		is the port for clients to connect to msh
-	MshPortQuery  int                  // MshPortQuery	is the port for clients to perform stats query requests at msh
-	ServHost      string = "127.0.0.1" // ServHost		is the ip address for msh to connect to minecraft server
-	ServPort      int                  // ServPort		is the port for msh to connect to minecraft server
-	ServPortQuery int                  // ServPortQuery	is the port for msh to perform stats query requests at minecraft server
+	MshHost       string   = "0.0.0.0"   // MshHost		is the ip address for clients to connect to msh
+	MshPort       int                    // MshPort		is the port for clients to connect to msh
+	MshPortQuery  int                    // MshPortQuery	is the port for clients to perform stats query requests at msh
+	ServHost      string   = "127.0.0.1" // ServHost		is the ip address for msh to connect to minecraft server
+	ServPort      int                    // ServPort		is the port for msh to connect to minecraft server
+	ServPortQuery int                    // ServPortQuery	is the port for msh to perform stats query requests at minecraft server
+	ServTargets   []string               // ServTargets	are the backend addresses for msh to proxy clients to (ServHost:ServPort first, then Server.Targets)
+
+	ServMaxPlayers int    // ServMaxPlayers is the minecraft server max players (from server.properties, 0 if unknown)
+	ServMotd       string // ServMotd is the minecraft server motd (from server.properties, replaces <motd> in msh info)
+
+	// compiledM protects the values compiled from the runtime config (replaced by ReloadConfig)
+	compiledM sync.RWMutex
+
+	stopConfirmRegex *regexp.Regexp    // stopConfirmRegex matches the minecraft server output line that confirms a clean stop
+	startupDoneRegex *regexp.Regexp    // startupDoneRegex matches the minecraft server output line that confirms it's ready
+	consoleTriggers  []*ConsoleTrigger // consoleTriggers contains the compiled console triggers
 )
 
+func init() {
+	configDefault.Store(&Configuration{})
+	configRuntime.Store(&Configuration{})
+}
+
+// ConfigDefault returns the parameters of config in file
+func ConfigDefault() *Configuration {
+	return configDefault.Load()
+}
+
+// ConfigRuntime returns the parameters of config in runtime.
+// ReloadConfig replaces the runtime config instead of modifying it:
+// callers that need consistent values should read them from the same returned config.
+func ConfigRuntime() *Configuration {
+	return configRuntime.Load()
+}
+
+// StopConfirmRegex returns the regex matching the minecraft server output line that confirms a clean stop
+func StopConfirmRegex() *regexp.Regexp {
+	compiledM.RLock()
+	defer compiledM.RUnlock()
+	return stopConfirmRegex
+}
+
+// StartupDoneRegex returns the regex matching the minecraft server output line that confirms it's ready
+func StartupDoneRegex() *regexp.Regexp {
+	compiledM.RLock()
+	defer compiledM.RUnlock()
+	return startupDoneRegex
+}
+
+// ConsoleTriggers returns the compiled console triggers
+func ConsoleTriggers() []*ConsoleTrigger {
+	compiledM.RLock()
+	defer compiledM.RUnlock()
+	return consoleTriggers
+}
+
+// maxConsoleTriggers is the maximum number of console triggers (each output line is matched against all of them)
+const maxConsoleTriggers int = 20
+
+// ConsoleTrigger is a console trigger with compiled regex
+type ConsoleTrigger struct {
+	Regex    *regexp.Regexp
+	Action   string
+	Cooldown time.Duration
+}
+
+// defaultConsoleTriggerCooldown is the console trigger cooldown used when Cooldown is not specified
+const defaultConsoleTriggerCooldown = 10 * time.Second
+
+// defaultStopConfirmRegex is used when Server.StopConfirmRegex is not specified
+const defaultStopConfirmRegex string = `All dimensions are saved`
+
+// defaultStartupDoneRegex is used when Server.StartupDoneRegex is not specified
+// (": Done (" instead of "Done" to avoid false positives, issue #112)
+const defaultStartupDoneRegex string = `INFO.*: Done \(.*\)! For help`
+
+// defaultStartupTimeout is the StartupTimeout (seconds) used when a custom StartupDoneRegex is set without StartupTimeout
+const defaultStartupTimeout int = 600
+
 type Configuration struct {
 	model.Configuration
 }
@@ -59,28 +140,47 @@ func LoadConfig() *errco.MshLog {
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "loading config...")
 
+	// load -check start argument (before msh files are read/written)
+	loadCheckOnly(os.Args[1:])
+
+	// load msh home directory
+	logMsh = loadMshHome()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
 	// load config default
-	logMsh = ConfigDefault.loadDefault()
+	logMsh = ConfigDefault().loadDefault()
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
 
 	// load config runtime
-	logMsh = ConfigRuntime.loadRuntime(ConfigDefault)
+	logMsh = ConfigRuntime().loadRuntime(ConfigDefault())
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
 
 	// ---------------- save config ---------------- //
 
-	if configDefaultSave {
-		logMsh := ConfigDefault.Save()
-		if logMsh != nil {
-			return logMsh.AddTrace()
-		}
+	// config check must not modify the config file
+	logMsh = SavePending()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// SavePending saves the default config if it has changes that were not saved yet
+func SavePending() *errco.MshLog {
+	if !configDefaultSave || CheckOnly {
+		return nil
+	}
 
-		// reset config default save flag
-		configDefaultSave = false
+	logMsh := ConfigDefault().Save()
+	if logMsh != nil {
+		return logMsh.AddTrace()
 	}
 
 	return nil
@@ -89,8 +189,12 @@ func LoadConfig() *errco.MshLog {
 // Save saves config to the config file.
 // Then does the default config setup
 func (c *Configuration) Save() *errco.MshLog {
+	// encrypt secret fields (on a copy: the config in memory keeps plaintext values)
+	enc := *c
+	enc.encryptSecrets()
+
 	// encode the struct config
-	configData, err := json.MarshalIndent(c, "", "  ")
+	configData, err := json.MarshalIndent(enc, "", "  ")
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONFIG_SAVE, "could not marshal from config file")
 	}
@@ -102,10 +206,14 @@ func (c *Configuration) Save() *errco.MshLog {
 	}
 
 	// write to config file
-	err = os.WriteFile(configFileName, configData, 0644)
-	if err != nil {
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONFIG_SAVE, "could not write to config file")
+	// (if writing fails, the save is retried when msh exits)
+	logMsh = WritePersistFile(filepath.Join(MshHome, configFileName), configData)
+	if logMsh != nil {
+		configDefaultSave = true
+		return logMsh.AddTrace()
 	}
+	updateConfigFileModTime()
+	configDefaultSave = false
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "saved default config to config file")
 
@@ -116,18 +224,13 @@ func (c *Configuration) Save() *errco.MshLog {
 //
 // If generated command has less than 2 arguments, it is considered invalid and error returned.
 func (c *Configuration) BuildCommandStartServer() ([]string, *errco.MshLog) {
-	var command = []string{}
-	for _, ss := range strings.Fields(c.Commands.StartServer) {
-		switch ss {
-		case "<Server.FileName>":
-			command = append(command, c.Server.FileName)
-		case "<Commands.StartServerParam>":
-			command = append(command, strings.Fields(c.Commands.StartServerParam)...)
-		default:
-			command = append(command, ss)
-		}
+	// attach to the docker container so that its console is handled as a java process one
+	if c.Server.Type == "docker" {
+		return []string{"docker", "start", "--attach", "--interactive", c.Server.Container}, nil
 	}
 
+	command := c.BuildCommand(c.Commands.StartServer)
+
 	if len(command) < 2 {
 		return command, errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_INVALID_COMMAND, "generated command to start minecraft server is invalid")
 	}
@@ -137,26 +240,36 @@ func (c *Configuration) BuildCommandStartServer() ([]string, *errco.MshLog) {
 
 // loadDefault loads config file to config variable
 func (c *Configuration) loadDefault() *errco.MshLog {
-	// get working directory
-	cwdPath, err := os.Getwd()
-	if err != nil {
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
-	}
-
 	// read config file
-	configFilePath := filepath.Join(cwdPath, configFileName)
+	configFilePath := filepath.Join(MshHome, configFileName)
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "reading config file: \"%s\"", configFilePath)
+	updateConfigFileModTime()
 	configData, err := os.ReadFile(configFilePath)
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
 	}
 
+	// upgrade config file data written by older msh versions
+	configData, migrated, logMsh := migrateConfig(configData)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	if migrated {
+		configDefaultSave = true
+	}
+
 	// write data to config variable
 	err = json.Unmarshal(configData, &c)
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
 	}
 
+	// decrypt secret fields
+	logMsh = c.decryptSecrets()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
 	// ------------------- setup ------------------- //
 
 	// load mshid
@@ -170,7 +283,44 @@ func (c *Configuration) loadDefault() *errco.MshLog {
 	return nil
 }
 
-// loadRuntime initializes runtime config to default config.
+// loadMshHome sets MshHome from -home start argument or MSH_HOME environment variable (start argument has priority).
+// If neither is set, the working directory is used.
+func loadMshHome() *errco.MshLog {
+	// -home start argument is scanned before flags parsing since config file location depends on it
+	for i, arg := range os.Args[1:] {
+		switch {
+		case arg == "-home" || arg == "--home":
+			if i+2 < len(os.Args) {
+				MshHome = os.Args[i+2]
+			}
+		case strings.HasPrefix(arg, "-home=") || strings.HasPrefix(arg, "--home="):
+			MshHome = arg[strings.Index(arg, "=")+1:]
+		}
+	}
+
+	if MshHome == "" {
+		MshHome = os.Getenv("MSH_HOME")
+	}
+
+	if MshHome == "" {
+		// get working directory
+		cwdPath, err := os.Getwd()
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
+		}
+		MshHome = cwdPath
+	}
+
+	if fi, err := os.Stat(MshHome); err != nil || !fi.IsDir() {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "msh home directory does not exist: %s", MshHome)
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh home directory: %s", MshHome)
+
+	return nil
+}
+
+// loadRuntime initializes runtime config to default config and applies environment variables overrides.
 // Then parses start arguments into runtime config, replaces placeholders and does the runtime config setup
 func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	var logMsh *errco.MshLog
@@ -178,6 +328,9 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	// initialize config to base
 	*c = *confdef
 
+	// override config with environment variables (start arguments have priority)
+	c.loadEnv()
+
 	// specify arguments
 	flag.StringVar(&c.Server.Folder, "folder", c.Server.Folder, "Specify minecraft server folder path.")
 	flag.StringVar(&c.Server.FileName, "file", c.Server.FileName, "Specify minecraft server file name.")
@@ -189,26 +342,68 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	// c.Commands.StopServer should not be set by a flag
 	flag.IntVar(&c.Commands.StopServerAllowKill, "allowkill", c.Commands.StopServerAllowKill, "Specify after how many seconds the server should be killed (if stop command fails).")
 
+	flag.StringVar(&MshHome, "home", MshHome, "Specify msh home directory (config and state files).") // already loaded by loadMshHome()
+	flag.BoolVar(&CheckOnly, "check", CheckOnly, "Validates config and exits (minecraft server is not started).")
 	flag.IntVar(&c.Msh.Debug, "d", c.Msh.Debug, "Specify debug level.")
+	flag.StringVar(&c.Msh.LogFile, "logfile", c.Msh.LogFile, "Specify file to which msh log is written.")
+	flag.StringVar(&c.Msh.LogFormat, "logformat", c.Msh.LogFormat, "Specify log format (text - json).")
+	flag.StringVar(&c.Msh.Template, "template", c.Msh.Template, "Specify server template (vanilla - paper - fabric - forge).")
 	// c.Msh.ID should not be set by a flag
-	flag.StringVar(&MshHost, "host", MshHost, "Specify msh host.")
+	flag.StringVar(&MshHost, "host", MshHost, "Specify msh host (\"::\" to listen on ipv4 and ipv6).")
 	flag.IntVar(&c.Msh.MshPort, "port", c.Msh.MshPort, "Specify msh port.")
 	flag.IntVar(&c.Msh.MshPortQuery, "portquery", c.Msh.MshPortQuery, "Specify msh port for queries.")
-	flag.StringVar(&ServHost, "servhost", ServHost, "Specify the minecraft server host.")
+	flag.IntVar(&c.Msh.BindRetrySeconds, "bindretry", c.Msh.BindRetrySeconds, "Specify for how many seconds binding msh port is retried (0 to disable).")
+	flag.StringVar(&c.Msh.MshPortRange, "portrange", c.Msh.MshPortRange, "Specify msh port range, the first free port is used (ex: 25555-25565).")
+	flag.StringVar(&ServHost, "servhost", ServHost, "Specify the minecraft server host (ex: 127.0.0.1, [::1]:25565, mc.local).")
 	flag.IntVar(&ServPort, "servport", ServPort, "Specify the minecraft server port.")
 	flag.IntVar(&ServPortQuery, "servportquery", ServPortQuery, "Specify minecraft server port for queries.")
 	flag.BoolVar(&c.Msh.EnableQuery, "enablequery", c.Msh.EnableQuery, "Enables queries handling.")
+	flag.BoolVar(&c.Msh.EnableLegacyPing, "legacyping", c.Msh.EnableLegacyPing, "Enables legacy ping response (1.6 and older clients).")
+	flag.StringVar(&c.Msh.HttpOnMcPortResponse, "httpresponse", c.Msh.HttpOnMcPortResponse, "Specify response to http requests on msh port (\"\" to close, \"400\" for bad request, url to redirect).")
 	flag.Int64Var(&c.Msh.TimeBeforeStoppingEmptyServer, "timeout", c.Msh.TimeBeforeStoppingEmptyServer, "Specify time to wait before stopping minecraft server.")
+	flag.IntVar(&c.Msh.MinUptimeBeforeStop, "minuptime", c.Msh.MinUptimeBeforeStop, "Specify minimum minecraft server uptime before a manual stop is allowed.")
+	flag.IntVar(&c.Msh.MinHibernationSeconds, "minhibe", c.Msh.MinHibernationSeconds, "Specify minimum minecraft server hibernation before a join can warm it again.")
+	flag.IntVar(&c.Msh.ShutdownTimeout, "shutdowntimeout", c.Msh.ShutdownTimeout, "Specify how many seconds msh waits for minecraft server to stop when msh exits.")
+	flag.IntVar(&c.Msh.HibernationWarnSeconds, "hibewarn", c.Msh.HibernationWarnSeconds, "Specify seconds before scheduled hibernation during which msh double-checks that minecraft server is empty (0 to disable).")
+	flag.IntVar(&c.Msh.HibernateOnMemPercent, "memhibe", c.Msh.HibernateOnMemPercent, "Specify system memory usage percentage above which empty minecraft server is hibernated (0 to disable).")
+	flag.IntVar(&c.Msh.StartupJoinTimeout, "joinhold", c.Msh.StartupJoinTimeout, "Specify how many seconds a joining client is held while minecraft server starts (0 to disable).")
+	flag.BoolVar(&c.Msh.CancelStartIfEmpty, "cancelstart", c.Msh.CancelStartIfEmpty, "Enables minecraft server start cancellation when all held clients leave.")
+	flag.IntVar(&c.Msh.StartupTimeout, "startuptimeout", c.Msh.StartupTimeout, "Specify after how many seconds a starting minecraft server is considered online if ready command did not succeed.")
+	flag.BoolVar(&c.Msh.VerifyBackend, "verifybackend", c.Msh.VerifyBackend, "Enables verification that the minecraft server port speaks the minecraft protocol.")
 	flag.BoolVar(&c.Msh.SuspendAllow, "suspendallow", c.Msh.SuspendAllow, "Enables minecraft server process suspension.")
+	flag.StringVar(&c.Msh.HibernationMode, "hibemode", c.Msh.HibernationMode, "Specify minecraft server hibernation mode (stop - soft).")
 	flag.IntVar(&c.Msh.SuspendRefresh, "suspendrefresh", c.Msh.SuspendRefresh, "Specify how often the suspended minecraft server process must be refreshed.")
+	flag.IntVar(&c.Msh.SuspendStopAfter, "suspendstop", c.Msh.SuspendStopAfter, "Specify after how many seconds a suspended minecraft server is fully stopped (0 to disable).")
 	flag.StringVar(&c.Msh.InfoHibernation, "infohibe", c.Msh.InfoHibernation, "Specify hibernation info.")
 	flag.StringVar(&c.Msh.InfoStarting, "infostar", c.Msh.InfoStarting, "Specify starting info.")
+	flag.BoolVar(&c.Msh.InfoStartingProgress, "infoprog", c.Msh.InfoStartingProgress, "Enables server loading progress in starting info.")
+	flag.StringVar(&c.Msh.Ping.StartingDisplay, "startdisplay", c.Msh.Ping.StartingDisplay, "Specify player count display while minecraft server is starting (zero - hidden - dash).")
+	flag.IntVar(&c.Msh.NotifyRetryMinutes, "notifyretry", c.Msh.NotifyRetryMinutes, "Specify for how many minutes failed webhook notifications are retried (0 to disable).")
+	flag.IntVar(&c.Msh.MaxHandlers, "maxhandlers", c.Msh.MaxHandlers, "Specify maximum concurrent connection handlers (0 to disable).")
+	flag.IntVar(&c.Msh.MaxConnectionsPerIp, "maxconnip", c.Msh.MaxConnectionsPerIp, "Specify maximum concurrent connections from the same ip (0 to disable).")
+	flag.BoolVar(&c.Msh.AcceptProxyProtocol, "acceptproxy", c.Msh.AcceptProxyProtocol, "Enables reading the PROXY protocol header from incoming connections.")
+	flag.BoolVar(&c.Msh.SendProxyProtocol, "sendproxy", c.Msh.SendProxyProtocol, "Enables sending a PROXY protocol header to minecraft server.")
+	flag.IntVar(&c.Msh.MaxConnsPerMinute, "maxconnmin", c.Msh.MaxConnsPerMinute, "Specify maximum connections per minute from the same ip (0 to disable).")
+	flag.StringVar(&c.Msh.OnServerOom, "onoom", c.Msh.OnServerOom, "Specify action taken when minecraft server runs out of memory (alert - restart - lowermem).")
+	flag.BoolVar(&c.Msh.RestartOnCrash, "restartcrash", c.Msh.RestartOnCrash, "Enables minecraft server restart after a crash.")
+	flag.IntVar(&c.Msh.MaxRestartAttempts, "maxrestart", c.Msh.MaxRestartAttempts, "Specify maximum consecutive minecraft server crash restart attempts.")
+	flag.IntVar(&c.Msh.KickIdlePlayersAfter, "kickidle", c.Msh.KickIdlePlayersAfter, "Specify after how many seconds an idle player is kicked (0 to disable).")
 	flag.BoolVar(&c.Msh.NotifyUpdate, "notifyupd", c.Msh.NotifyUpdate, "Enables update notifications.")
 	flag.BoolVar(&c.Msh.NotifyMessage, "notifymes", c.Msh.NotifyMessage, "Enables message notifications.")
 	// c.Msh.Whitelist (type []string, not worth to make it a flag)
 	flag.BoolVar(&c.Msh.WhitelistImport, "wlimport", c.Msh.WhitelistImport, "Enables minecraft server whitelist import.")
+	flag.BoolVar(&c.Msh.WhitelistRconRefresh, "wlrcon", c.Msh.WhitelistRconRefresh, "Enables minecraft server whitelist refresh through rcon before hibernation.")
 	flag.BoolVar(&c.Msh.ShowResourceUsage, "showres", c.Msh.ShowResourceUsage, "Enables logging of msh resource usage (cpu / mem percentage).")
 	flag.BoolVar(&c.Msh.ShowInternetUsage, "showint", c.Msh.ShowInternetUsage, "Enables logging of msh interent usage (->clients / ->server).")
+	flag.IntVar(&c.Msh.SessionSummaryLevel, "sessionlvl", c.Msh.SessionSummaryLevel, "Specify debug level at which player session summaries are logged (-1 to disable).")
+	flag.StringVar(&c.Msh.StatsFile, "statsfile", c.Msh.StatsFile, "Specify file to which stats snapshot is written.")
+	flag.IntVar(&c.Msh.StatsFileInterval, "statsint", c.Msh.StatsFileInterval, "Specify every how many seconds stats snapshot is written.")
+	flag.IntVar(&c.Msh.MetricsPort, "metricsport", c.Msh.MetricsPort, "Specify port on which prometheus metrics are served at /metrics (0 to disable).")
+	flag.IntVar(&c.Msh.ApiPort, "apiport", c.Msh.ApiPort, "Specify port on which the control api is served (0 to disable).")
+	flag.StringVar(&c.Msh.PushgatewayUrl, "pushurl", c.Msh.PushgatewayUrl, "Specify prometheus pushgateway url to which metrics are pushed.")
+	flag.IntVar(&c.Msh.PushgatewayInterval, "pushint", c.Msh.PushgatewayInterval, "Specify every how many seconds metrics are pushed.")
+	flag.StringVar(&c.Msh.HttpProxy, "httpproxy", c.Msh.HttpProxy, "Specify http proxy for msh outbound connections.")
+	flag.StringVar(&c.Msh.SocksProxy, "socksproxy", c.Msh.SocksProxy, "Specify socks5 proxy for msh outbound connections.")
 
 	// backward compatibility
 	flag.IntVar(&c.Commands.StopServerAllowKill, "allowKill", c.Commands.StopServerAllowKill, "Specify after how many seconds the server should be killed (if stop command fails).") // msh pterodactyl egg
@@ -231,15 +426,45 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	}
 	flag.CommandLine.Parse(args)
 
+	// record the fields overridden by environment variables and flags (kept by config reloads)
+	overriddenFields = map[string]bool{}
+	for _, field := range diffFields(confdef, c) {
+		overriddenFields[field] = true
+	}
+
+	// expand "~" and environment variables in paths (before they are used)
+	c.expandPaths()
+
+	// record config problems from now on (if config check is requested)
+	if CheckOnly {
+		startCheck()
+	}
+
 	// after config variables are set, set debug level
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "setting log level to: %d", c.Msh.Debug)
 	errco.DebugLvl = errco.LogLvl(c.Msh.Debug)
+	errco.SetLogFormat(c.Msh.LogFormat)
+
+	// write logs to file (if enabled)
+	if logMsh := errco.SetLogFile(c.Msh.LogFile, c.Msh.LogMaxSizeMB); logMsh != nil {
+		logMsh.Log(true)
+	}
+
+	// fill empty fields with server template defaults
+	c.applyTemplate()
 
 	// ---------------- setup check ---------------- //
 
 	// check if server folder/executeble exist
 	serverFileFolderPath := filepath.Join(c.Server.Folder, c.Server.FileName)
-	if _, err := os.Stat(serverFileFolderPath); os.IsNotExist(err) {
+	if c.Server.Type == "docker" {
+		// minecraft server files and java are inside the docker container
+
+		if logMsh := c.checkDocker(); logMsh != nil {
+			logMsh.Log(true)
+			servstats.Stats.SetMajorError(logMsh)
+		}
+	} else if _, err := os.Stat(serverFileFolderPath); os.IsNotExist(err) {
 		// server folder/executeble does not exist
 
 		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "specified minecraft server folder/file does not exist: %s", serverFileFolderPath)
@@ -247,10 +472,41 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	} else {
 		// server folder/executeble exist
 
+		// check that minecraft server is not managed by an other msh instance
+		// (config check does not run minecraft server)
+		if !CheckOnly {
+			if logMsh := c.acquireLock(); logMsh != nil {
+				logMsh.Log(true)
+				servstats.Stats.SetMajorError(logMsh)
+			}
+		}
+
+		// regenerate missing minecraft server files (if AutoBootstrap is enabled)
+		// (config check must not run minecraft server)
+		var bootLogMsh *errco.MshLog
+		if !CheckOnly {
+			bootLogMsh = c.autoBootstrap()
+		}
+
 		// check if eula.txt exists and is set to true
 		eulaFilePath := filepath.Join(c.Server.Folder, "eula.txt")
 		eulaData, err := os.ReadFile(eulaFilePath)
 		switch {
+		case bootLogMsh != nil:
+			// auto bootstrap failed
+
+			bootLogMsh.Log(true)
+			servstats.Stats.SetMajorError(bootLogMsh)
+
+		case c.Server.Edition == "bedrock":
+			// bedrock servers have no eula.txt
+
+		case err != nil && CheckOnly:
+			// eula.txt does not exist (config check must not run minecraft server to generate it)
+
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "eula.txt missing: %s", eulaFilePath)
+			servstats.Stats.SetMajorError(logMsh)
+
 		case err != nil:
 			// eula.txt does not exist
 
@@ -262,15 +518,9 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
-			cmd := exec.Command(command[0], command[1:]...)
-			cmd.Dir = c.Server.Folder
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			fmt.Print(errco.COLOR_CYAN) // set color to server log color
-			err = cmd.Run()
-			fmt.Print(errco.COLOR_RESET) // reset color
-			if err != nil {
-				logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "couldn't start minecraft server to generate eula.txt (%s)", err.Error())
+			logMsh = c.runBootstrap(command)
+			if logMsh != nil {
+				logMsh.Log(true)
 				servstats.Stats.SetMajorError(logMsh)
 			}
 			fallthrough
@@ -288,21 +538,59 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 		}
 	}
 
+	// check that start command placeholders are resolved
+	if CheckOnly {
+		c.checkStartCommand()
+	}
+
 	// check if java is installed and get java version
-	_, err = exec.LookPath("java")
-	if err != nil {
-		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "java not installed")
-		servstats.Stats.SetMajorError(logMsh)
-	} else if out, err := exec.Command("java", "--version").Output(); err != nil {
-		// non blocking error
-		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "could not execute 'java -version' command")
-		JavaV = "unknown"
-	} else {
-		JavaV = strings.ReplaceAll(strings.Split(string(out), "\n")[0], "\r", "")
+	// (bedrock servers are native executables)
+	// the java binary of the start command is probed as it might not be the one on PATH
+	if c.Server.Type != "docker" && c.Server.Edition != "bedrock" {
+		javaBin, _ := c.javaBinary()
+		_, err = exec.LookPath(javaBin)
+		if err != nil {
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "java not installed (%s)", javaBin)
+			servstats.Stats.SetMajorError(logMsh)
+		} else if out, err := exec.Command(javaBin, "-version").CombinedOutput(); err != nil {
+			// non blocking error
+			// ("-version" is used as "--version" is not supported by java 8, output is printed to stderr)
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "could not execute '%s -version' command", javaBin)
+			JavaV = "unknown"
+		} else if line, jv, ok := parseJavaVersion(string(out)); !ok {
+			// non blocking error
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "could not parse java version from '%s -version' output", javaBin)
+			JavaV = "unknown"
+		} else {
+			JavaV = line
+			JavaVersion = jv
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "java version: %s (major %d)", JavaVersion.Full, JavaVersion.Major)
+		}
 	}
 
 	// ---------------- setup load ----------------- //
 
+	// load hosts
+	// (ipv6 literals might be bracketed and hosts might include a port: "[::1]:25565")
+	if host, port, ok := parseHostPort(MshHost); !ok {
+		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "msh host is invalid: %s", MshHost)
+		servstats.Stats.SetMajorError(logMsh)
+	} else {
+		MshHost = host
+		if port != 0 {
+			c.Msh.MshPort = port
+		}
+	}
+	if host, port, ok := parseHostPort(ServHost); !ok {
+		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "minecraft server host is invalid: %s", ServHost)
+		servstats.Stats.SetMajorError(logMsh)
+	} else {
+		ServHost = host
+		if port != 0 && ServPort == 0 {
+			ServPort = port
+		}
+	}
+
 	// load ports
 
 	// MshHost defined in global definition
@@ -329,6 +617,13 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh connection  proxy setup: %10s:%5d --> %10s:%5d", MshHost, MshPort, ServHost, ServPort)
 
+	// load failover targets
+	ServTargets = loadTargets(net.JoinHostPort(ServHost, strconv.Itoa(ServPort)), c.Server.Targets)
+	servstats.Stats.SetTarget(0, ServTargets[0])
+	for _, t := range ServTargets[1:] {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh connection  proxy failover target: %s", t)
+	}
+
 	// check if queries are enabled by config, start arguments or ms config
 	if !c.Msh.EnableQuery {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh stats query proxy setup: disabled by msh config or start arguments")
@@ -345,7 +640,32 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 		c.Msh.EnableQuery = true
 	}
 
+	// load max players and motd from ms config
+	c.loadServerProperties()
+
+	// load rcon settings from ms config (if not set in msh config)
+	if c.Server.RconPort == 0 || c.Server.RconPassword == "" {
+		if msConfigEnableRcon, logMsh := c.ParsePropertiesBool("enable-rcon"); logMsh == nil && msConfigEnableRcon {
+			if c.Server.RconPort == 0 {
+				if rconPort, logMsh := c.ParsePropertiesInt("rcon.port"); logMsh == nil {
+					c.Server.RconPort = rconPort
+				}
+			}
+			if c.Server.RconPassword == "" {
+				if rconPassword, logMsh := c.ParsePropertiesString("rcon.password"); logMsh == nil {
+					c.Server.RconPassword = rconPassword
+				}
+			}
+		}
+	}
+	if c.Server.RconPort > 0 && c.Server.RconPassword != "" {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server stop: rcon on %10s:%5d", ServHost, c.Server.RconPort)
+	}
+
 	// load ms version/protocol
+	if fi, err := os.Stat(filepath.Join(c.Server.Folder, c.Server.FileName)); err == nil {
+		serverFileModTime = fi.ModTime()
+	}
 	c.Server.Version, c.Server.Protocol, logMsh = c.getVersionInfo()
 	if logMsh != nil {
 		// just log it since ms version/protocol are not vital for the connection with clients
@@ -360,6 +680,15 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 		configDefaultSave = true
 	}
 
+	// check that java is compatible with ms version
+	// (docker/bedrock servers don't use the system java)
+	if c.Server.Type != "docker" && c.Server.Edition != "bedrock" {
+		c.checkJavaCompat()
+	}
+
+	// check runtime config values
+	c.checkRuntime()
+
 	// load server icon
 	logMsh = c.loadIcon()
 	if logMsh != nil {
@@ -369,3 +698,230 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 
 	return nil
 }
+
+// checkRuntime checks runtime config values (replacing invalid ones) and loads the derived runtime variables.
+// It's called by loadRuntime and ReloadConfig.
+func (c *Configuration) checkRuntime() {
+	var err error
+
+	// check starting player count display
+	switch c.Msh.Ping.StartingDisplay {
+	case "zero", "hidden", "dash":
+	case "":
+		c.Msh.Ping.StartingDisplay = "zero"
+	default:
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "starting display \"%s\" is invalid, using \"zero\"", c.Msh.Ping.StartingDisplay)
+		c.Msh.Ping.StartingDisplay = "zero"
+	}
+
+	// load outbound connections proxy
+	if logMsh := c.loadOutboundProxy(); logMsh != nil {
+		logMsh.Log(true)
+	}
+
+	// check http response on msh port
+	if r := c.Msh.HttpOnMcPortResponse; r != "" && r != "400" && !strings.HasPrefix(r, "http://") && !strings.HasPrefix(r, "https://") {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "HttpOnMcPortResponse \"%s\" is invalid, http requests will be closed without response", r)
+		c.Msh.HttpOnMcPortResponse = ""
+	}
+
+	// check protocol rewrite range
+	if pr := c.Msh.ProtocolRewrite; pr.MaxProtocol != 0 && pr.MinProtocol > pr.MaxProtocol {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "ProtocolRewrite range is invalid (%d > %d), protocol rewrite disabled", pr.MinProtocol, pr.MaxProtocol)
+		c.Msh.ProtocolRewrite.MaxProtocol = 0
+	}
+
+	// check schedule windows
+	windows := []model.ScheduleWindow{}
+	for _, w := range c.Msh.Schedule.Windows {
+		if _, _, _, ok := parseScheduleWindow(w); !ok {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "schedule window %v %s-%s is invalid, ignoring it", w.Days, w.Start, w.End)
+			continue
+		}
+		windows = append(windows, w)
+	}
+	c.Msh.Schedule.Windows = windows
+	if c.Msh.Schedule.KickMessage == "" {
+		c.Msh.Schedule.KickMessage = "Server is closed at this time"
+	}
+
+	// load wake ip allowlist/blocklist
+	allowed, blocked := parseIpNets(c.Msh.AllowedIPs, "AllowedIPs"), parseIpNets(c.Msh.BlockedIPs, "BlockedIPs")
+	compiledM.Lock()
+	allowedNets, blockedNets = allowed, blocked
+	compiledM.Unlock()
+	if c.Msh.WakeDeniedMessage == "" {
+		c.Msh.WakeDeniedMessage = "You don't have permission to warm this server"
+	}
+	if c.Msh.WhitelistKickMessage == "" {
+		c.Msh.WhitelistKickMessage = "You are not white-listed on this server!"
+	}
+
+	// check server type
+	switch c.Server.Type {
+	case "java":
+	case "":
+		c.Server.Type = "java"
+	case "docker":
+		// msh process is the docker client: process tree operations would not affect the container
+		if c.Msh.SuspendAllow {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "server type \"docker\" is not compatible with SuspendAllow, suspension disabled")
+			c.Msh.SuspendAllow = false
+		}
+		c.Server.CpuAffinity = []int{}
+		c.Server.StartupIoThrottle = 0
+	default:
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "server type \"%s\" is invalid, using \"java\"", c.Server.Type)
+		c.Server.Type = "java"
+	}
+
+	// check server edition
+	switch c.Server.Edition {
+	case "java":
+	case "":
+		c.Server.Edition = "java"
+	case "bedrock":
+		// bedrock servers don't speak the java edition protocol
+		c.Msh.VerifyBackend = false
+		if c.Msh.EnableQuery {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "server edition \"bedrock\" is not compatible with EnableQuery, query disabled")
+			c.Msh.EnableQuery = false
+		}
+	default:
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "server edition \"%s\" is invalid, using \"java\"", c.Server.Edition)
+		c.Server.Edition = "java"
+	}
+
+	// check hibernation mode
+	switch c.Msh.HibernationMode {
+	case "stop":
+	case "":
+		c.Msh.HibernationMode = "stop"
+	case "soft":
+		if c.Commands.SoftStop == "" || c.Commands.SoftStart == "" {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "hibernation mode \"soft\" requires Commands.SoftStop and Commands.SoftStart, using \"stop\"")
+			c.Msh.HibernationMode = "stop"
+		} else if c.Msh.SuspendAllow {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "hibernation mode \"soft\" is not compatible with SuspendAllow, suspension disabled")
+			c.Msh.SuspendAllow = false
+		}
+	default:
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "hibernation mode \"%s\" is invalid, using \"stop\"", c.Msh.HibernationMode)
+		c.Msh.HibernationMode = "stop"
+	}
+
+	// check out of memory action
+	switch c.Msh.OnServerOom {
+	case "alert", "restart", "lowermem":
+	case "":
+		c.Msh.OnServerOom = "alert"
+	default:
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "out of memory action \"%s\" is invalid, using \"alert\"", c.Msh.OnServerOom)
+		c.Msh.OnServerOom = "alert"
+	}
+
+	// check bind retry window
+	if c.Msh.BindRetrySeconds < 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "BindRetrySeconds must not be negative, bind retry disabled")
+		c.Msh.BindRetrySeconds = 0
+	}
+
+	// check log format ("" if missing from an older config file)
+	switch c.Msh.LogFormat {
+	case "text", "json":
+	case "":
+		c.Msh.LogFormat = "text"
+	default:
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "LogFormat \"%s\" is invalid, using \"text\"", c.Msh.LogFormat)
+		c.Msh.LogFormat = "text"
+	}
+	errco.SetLogFormat(c.Msh.LogFormat)
+
+	// check suspended server full stop threshold
+	if c.Msh.SuspendStopAfter < 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "SuspendStopAfter must not be negative, full stop of suspended server disabled")
+		c.Msh.SuspendStopAfter = 0
+	}
+
+	// check shutdown timeout (0 if missing from an older config file)
+	if c.Msh.ShutdownTimeout < 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "ShutdownTimeout must be positive, using 120")
+	}
+	if c.Msh.ShutdownTimeout <= 0 {
+		c.Msh.ShutdownTimeout = 120
+	}
+
+	// check hibernation warning window
+	if c.Msh.HibernationWarnSeconds < 0 || int64(c.Msh.HibernationWarnSeconds) > c.Msh.TimeBeforeStoppingEmptyServer {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "HibernationWarnSeconds must be between 0 and TimeBeforeStoppingEmptyServer, hibernation warning disabled")
+		c.Msh.HibernationWarnSeconds = 0
+	}
+
+	// check memory pressure hibernation threshold
+	if c.Msh.HibernateOnMemPercent < 0 || c.Msh.HibernateOnMemPercent > 100 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "HibernateOnMemPercent must be between 0 and 100, memory pressure hibernation disabled")
+		c.Msh.HibernateOnMemPercent = 0
+	}
+
+	// check crash restart attempts
+	if c.Msh.RestartOnCrash && c.Msh.MaxRestartAttempts <= 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "MaxRestartAttempts must be positive when RestartOnCrash is enabled, using 3")
+		c.Msh.MaxRestartAttempts = 3
+	}
+
+	// check idle player kick time
+	if c.Msh.KickIdlePlayersAfter < 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "KickIdlePlayersAfter is negative, idle player kick disabled")
+		c.Msh.KickIdlePlayersAfter = 0
+	}
+
+	// load stop confirm regex
+	var stopRe *regexp.Regexp
+	if c.Server.StopConfirmRegex == "" {
+		stopRe = regexp.MustCompile(defaultStopConfirmRegex)
+	} else if stopRe, err = regexp.Compile(c.Server.StopConfirmRegex); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "stop confirm regex is invalid, using default (%s)", err.Error())
+		stopRe = regexp.MustCompile(defaultStopConfirmRegex)
+	}
+
+	if c.Msh.CancelStartIfEmpty && c.Msh.StartupJoinTimeout <= 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "CancelStartIfEmpty requires StartupJoinTimeout, start cancellation disabled")
+	}
+
+	// load startup done regex
+	var doneRe *regexp.Regexp
+	if c.Server.StartupDoneRegex == "" {
+		doneRe = regexp.MustCompile(defaultStartupDoneRegex)
+	} else if doneRe, err = regexp.Compile(c.Server.StartupDoneRegex); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "startup done regex is invalid, using default (%s)", err.Error())
+		doneRe = regexp.MustCompile(defaultStartupDoneRegex)
+	}
+	// a custom startup done regex might never match: ms must not stay starting forever
+	if c.Server.StartupDoneRegex != "" && c.Msh.StartupTimeout <= 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "StartupDoneRegex is set without StartupTimeout, using a startup timeout of %d seconds", defaultStartupTimeout)
+		c.Msh.StartupTimeout = defaultStartupTimeout
+	}
+
+	// load console triggers
+	triggers := []*ConsoleTrigger{}
+	for n, ct := range c.Msh.ConsoleTriggers {
+		if n >= maxConsoleTriggers {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "too many console triggers, only the first %d are loaded", maxConsoleTriggers)
+			break
+		}
+		re, err := regexp.Compile(ct.Regex)
+		if err != nil || ct.Regex == "" || ct.Action == "" {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "console trigger %d is invalid (regex: \"%s\", action: \"%s\"), skipping", n, ct.Regex, ct.Action)
+			continue
+		}
+		cooldown := time.Duration(ct.Cooldown) * time.Second
+		if ct.Cooldown <= 0 {
+			cooldown = defaultConsoleTriggerCooldown
+		}
+		triggers = append(triggers, &ConsoleTrigger{Regex: re, Action: ct.Action, Cooldown: cooldown})
+	}
+
+	compiledM.Lock()
+	stopConfirmRegex, startupDoneRegex, consoleTriggers = stopRe, doneRe, triggers
+	compiledM.Unlock()
+}
@@ -0,0 +1,276 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// raknet offline message ids
+const (
+	raknetUnconnectedPing          byte = 0x01
+	raknetUnconnectedPingOpen      byte = 0x02
+	raknetUnconnectedPong          byte = 0x1c
+	raknetOpenConnectionRequest1   byte = 0x05
+	raknetOpenConnectionRequest2   byte = 0x07
+	raknetUnconnectedPingMinLength      = 1 + 8 + 16 // id + ping time + magic
+)
+
+// bedrockSessionTimeout is the time after which a bedrock proxy session with no traffic is closed
+const bedrockSessionTimeout = 30 * time.Second
+
+// bedrockReadBackoffMax is the maximum delay between reads after consecutive read errors
+const bedrockReadBackoffMax = time.Second
+
+// raknetMagic is the magic sequence contained in raknet offline messages
+var raknetMagic = []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+// bedrockGuid is the raknet server guid used by msh in unconnected pongs
+var bedrockGuid = time.Now().UnixNano()
+
+// bedrockSession is a udp proxy session between a bedrock client and ms
+type bedrockSession struct {
+	servConn *net.UDPConn // connection to ms
+	last     time.Time    // time of the last datagram from the client
+	joined   bool         // the client requested a connection (counted in servstats.Stats.ConnCount)
+}
+
+// bedrockSessions contains the bedrock proxy sessions by client address
+var bedrockSessions = struct {
+	m sync.Mutex
+	s map[string]*bedrockSession
+}{s: map[string]*bedrockSession{}}
+
+// HandlerBedrock handles bedrock edition clients (raknet over udp) on msh port.
+//
+// While ms is not online, unconnected pings are answered by msh and
+// an open connection request warms ms.
+// While ms is online, datagrams are forwarded between clients and ms.
+// It returns only if the udp socket can't be opened or is closed.
+//
+// [blocking]
+func HandlerBedrock() *errco.MshLog {
+	connCli, err := net.ListenPacket("udp", net.JoinHostPort(config.MshHost, strconv.Itoa(config.MshPort)))
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new bedrock clients on", config.MshHost, config.MshPort)
+
+	go bedrockSessionCleaner()
+
+	buf := make([]byte, 2048)
+	var backoff time.Duration
+	for {
+		n, addrCli, err := connCli.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
+			}
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
+
+			// don't spin on persistent read errors
+			if backoff == 0 {
+				backoff = 10 * time.Millisecond
+			} else if backoff *= 2; backoff > bedrockReadBackoffMax {
+				backoff = bedrockReadBackoffMax
+			}
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		handleBedrockDatagram(connCli, addrCli, append([]byte{}, buf[:n]...))
+	}
+}
+
+// handleBedrockDatagram handles a datagram received from a bedrock client
+func handleBedrockDatagram(connCli net.PacketConn, addrCli net.Addr, data []byte) {
+	clientAddress := addrCli.(*net.UDPAddr).IP.String()
+
+	if len(data) == 0 {
+		return
+	}
+
+	// ms online: forward datagram to ms
+	if servstats.Stats.MajorError == nil && servstats.Stats.Status == errco.SERVER_STATUS_ONLINE && !servstats.Stats.Suspended && !servstats.Stats.SoftStopped {
+		bedrockForward(connCli, addrCli, data)
+		return
+	}
+
+	switch data[0] {
+
+	case raknetUnconnectedPing, raknetUnconnectedPingOpen:
+		if len(data) < raknetUnconnectedPingMinLength {
+			return
+		}
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "recv bedrock unconnected ping from %s:\t%v", clientAddress, data)
+
+		var motd string
+		switch {
+		case servstats.Stats.MajorError != nil:
+			motd = fmt.Sprintf(servstats.Stats.MajorError.Mex, servstats.Stats.MajorError.Arg...)
+		case servstats.Stats.Status == errco.SERVER_STATUS_STARTING:
+			motd = config.ConfigRuntime().Msh.InfoStarting
+		case servstats.Stats.Status == errco.SERVER_STATUS_STOPPING:
+			motd = "server is stopping... refresh the page"
+		default: // ms offline or suspended
+			motd = config.ConfigRuntime().Msh.InfoHibernation
+		}
+
+		pingTime := int64(binary.BigEndian.Uint64(data[1:9]))
+		mes := buildBedrockPong(pingTime, bedrockGuid, config.ResolvePlaceholders(motd), config.ConfigRuntime().Server.Version, config.ConfigRuntime().Server.Protocol, 0, config.ServMaxPlayers, config.MshPort)
+		connCli.WriteTo(mes, addrCli)
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+	case raknetOpenConnectionRequest1:
+		// the client is trying to join: warm ms
+		// (the client receives no response and retries/times out while ms starts)
+		if servstats.Stats.MajorError != nil || servstats.Stats.Status == errco.SERVER_STATUS_STARTING || servstats.Stats.Status == errco.SERVER_STATUS_STOPPING {
+			return
+		}
+
+		if allowed, log := allowRate(clientAddress); !allowed {
+			if log {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_REQ, "bedrock join requests from %s dropped: max connections per minute (%d) exceeded", clientAddress, config.ConfigRuntime().Msh.MaxConnsPerMinute)
+			}
+			return
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a bedrock client tried to join from %s:%d to %s:%d", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+
+		if !config.IpWakeAllowed(clientAddress) {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_REQ, "warm denied to %s by AllowedIPs/BlockedIPs", clientAddress)
+			return
+		}
+		if config.ConfigRuntime().Msh.Schedule.RefuseWake && !config.ConfigRuntime().ScheduleAllowed(time.Now()) {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server is outside schedule windows, warm rejected")
+			return
+		}
+		if wait := servctrl.HibernationCooldown(); wait > 0 {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server hibernated less than %ds ago, warm rejected", config.ConfigRuntime().Msh.MinHibernationSeconds)
+			return
+		}
+
+		// the read loop must not be blocked while ms starts (pings and forwarding of other clients)
+		// [goroutine]
+		go func() {
+			if logMsh := servctrl.WarmMSBy("bedrock client " + clientAddress); logMsh != nil {
+				logMsh.Log(true)
+			}
+		}()
+	}
+}
+
+// buildBedrockPong returns a raknet unconnected pong:
+// [0x1c] [int64 ping time] [int64 server guid] [magic] [uint16 length] [server id string]
+//
+// server id string: "MCPE;motd;protocol;version;players;max players;server guid;sub motd;game mode;1;port v4;port v6;"
+func buildBedrockPong(pingTime, guid int64, motd, version string, protocol, players, maxPlayers, port int) []byte {
+	// bedrock motd has 2 lines separated by ";": msh info lines are used for them
+	motdLines := strings.SplitN(strings.ReplaceAll(motd, ";", ""), "\n", 2)
+	subMotd := ""
+	if len(motdLines) == 2 {
+		subMotd = strings.ReplaceAll(motdLines[1], "\n", " ")
+	}
+
+	serverId := fmt.Sprintf("MCPE;%s;%d;%s;%d;%d;%d;%s;Survival;1;%d;%d;",
+		strings.TrimSpace(motdLines[0]), protocol, version, players, maxPlayers, guid, strings.TrimSpace(subMotd), port, port)
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte(raknetUnconnectedPong)
+	binary.Write(buf, binary.BigEndian, pingTime)
+	binary.Write(buf, binary.BigEndian, guid)
+	buf.Write(raknetMagic)
+	binary.Write(buf, binary.BigEndian, uint16(len(serverId)))
+	buf.WriteString(serverId)
+
+	return buf.Bytes()
+}
+
+// bedrockForward forwards a client datagram to ms, opening a proxy session for the client if needed
+func bedrockForward(connCli net.PacketConn, addrCli net.Addr, data []byte) {
+	bedrockSessions.m.Lock()
+	defer bedrockSessions.m.Unlock()
+
+	sess, ok := bedrockSessions.s[addrCli.String()]
+	if !ok {
+		servAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(config.ServHost, strconv.Itoa(config.ServPort)))
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
+			return
+		}
+		servConn, err := net.DialUDP("udp", nil, servAddr)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
+			return
+		}
+
+		sess = &bedrockSession{servConn: servConn}
+		bedrockSessions.s[addrCli.String()] = sess
+
+		// proxy server -> client
+		// [goroutine]
+		go func() {
+			buf := make([]byte, 2048)
+			for {
+				n, err := servConn.Read(buf)
+				if err != nil {
+					// session closed
+					return
+				}
+				connCli.WriteTo(buf[:n], addrCli)
+				atomic.AddInt64(&servstats.Stats.BytesToClientsTotal, int64(n))
+			}
+		}()
+	}
+
+	sess.last = time.Now()
+
+	// the client is joining ms
+	if !sess.joined && (data[0] == raknetOpenConnectionRequest1 || data[0] == raknetOpenConnectionRequest2) {
+		sess.joined = true
+		count := servstats.Stats.ConnAdd(1)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A BEDROCK CLIENT CONNECTED TO THE SERVER! (%s) - %d active connections", addrCli.String(), count)
+	}
+
+	sess.servConn.Write(data)
+	atomic.AddInt64(&servstats.Stats.BytesToServerTotal, int64(len(data)))
+}
+
+// bedrockSessionCleaner closes the bedrock proxy sessions with no client traffic for bedrockSessionTimeout
+// (udp has no connection closure: a disconnected client just stops sending datagrams)
+//
+// [goroutine]
+func bedrockSessionCleaner() {
+	for range time.NewTicker(bedrockSessionTimeout / 3).C {
+		bedrockSessions.m.Lock()
+		for addr, sess := range bedrockSessions.s {
+			if time.Since(sess.last) < bedrockSessionTimeout {
+				continue
+			}
+
+			sess.servConn.Close()
+			delete(bedrockSessions.s, addr)
+
+			if sess.joined {
+				count := servstats.Stats.ConnAdd(-1)
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A BEDROCK CLIENT DISCONNECTED FROM THE SERVER! (%s) - %d active connections", addr, count)
+				servctrl.FreezeMSSchedule()
+			}
+		}
+		bedrockSessions.m.Unlock()
+	}
+}
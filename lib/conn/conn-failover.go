@@ -0,0 +1,99 @@
+package conn
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+const (
+	failoverDialTimeout   = 5 * time.Second  // max time to connect to a backend
+	failbackProbeInterval = 30 * time.Second // interval at which the primary backend is probed while a standby is active
+)
+
+// dialServ connects to the active backend (servstats.Stats.Target).
+//
+// If the active backend is unreachable while ms is online (the startup window is over),
+// the other targets are tried in order and the first reachable one becomes the active backend.
+// While a standby backend is active, the primary backend is probed to fail back when it recovers.
+// (the active backend is reset to the primary backend when ms is cold started)
+//
+// Only the connections proxied by msh follow the failover: ms stats queries,
+// player count and rcon always use the primary backend.
+func dialServ(traceID string) (net.Conn, error) {
+	targets := config.ServTargets
+	if len(targets) == 0 {
+		return net.DialTimeout("tcp", net.JoinHostPort(config.ServHost, strconv.Itoa(config.ServPort)), failoverDialTimeout)
+	}
+
+	active, _ := servstats.Stats.Target()
+
+	serverSocket, err := net.DialTimeout("tcp", targets[active], failoverDialTimeout)
+	if err == nil || len(targets) == 1 || servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+		return serverSocket, err
+	}
+
+	errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_DIAL, "[%s] backend %s unreachable: %s", traceID, targets[active], err.Error())
+
+	// targets are dialed without holding any lock: other connections are not blocked meanwhile
+	for n := 1; n < len(targets); n++ {
+		i := (active + n) % len(targets)
+
+		serverSocket, errNext := net.DialTimeout("tcp", targets[i], failoverDialTimeout)
+		if errNext != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_DIAL, "[%s] backend %s unreachable: %s", traceID, targets[i], errNext.Error())
+			continue
+		}
+
+		// another connection already changed the active backend: use it
+		if !servstats.Stats.SwapTarget(active, i, targets[i]) {
+			serverSocket.Close()
+			now, addr := servstats.Stats.Target()
+			if now == active {
+				continue
+			}
+			return net.DialTimeout("tcp", addr, failoverDialTimeout)
+		}
+
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SERVER_DIAL, "FAILOVER: backend %s unreachable, proxying clients to %s", targets[active], targets[i])
+		if active == 0 {
+			go failbackProbe()
+		}
+
+		return serverSocket, nil
+	}
+
+	return nil, err
+}
+
+// failbackProbe probes the primary backend every failbackProbeInterval
+// and makes it the active backend again when it's reachable.
+// It returns when the primary backend is active again (ex: reset by a ms cold start).
+//
+// [goroutine]
+func failbackProbe() {
+	ticker := time.NewTicker(failbackProbeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if active, _ := servstats.Stats.Target(); active == 0 {
+			return
+		}
+
+		conn, err := net.DialTimeout("tcp", config.ServTargets[0], failoverDialTimeout)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		if servstats.Stats.SetTarget(0, config.ServTargets[0]) != 0 {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "FAILBACK: backend %s recovered, proxying clients to it", config.ServTargets[0])
+		}
+
+		return
+	}
+}
@@ -0,0 +1,166 @@
+package conn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/servctrl"
+)
+
+const (
+	idleCheckInterval  = 10 * time.Second // interval at which client activity is checked
+	idleBytesThreshold = 512              // client --> server bytes per check interval under which the client is considered idle
+	idleWarnAdvance    = 60 * time.Second // time before the kick at which the player is warned
+	idleKickMessage    = "You have been disconnected for being idle"
+)
+
+// playerNameRegex matches a valid minecraft player name (used to prevent command injection)
+var playerNameRegex = regexp.MustCompile(`^\w{3,16}$`)
+
+// idleTracker keeps track of the client --> server activity of a proxied JOIN connection.
+//
+// An AFK client keeps sending keep-alive and position packets: the client is considered idle when
+// the bytes sent in a check interval are less than idleBytesThreshold.
+type idleTracker struct {
+	clientConn net.Conn
+	player     string // player name ("" if unknown)
+	traceID    string
+	bytes      int64 // client --> server bytes since last check (atomic)
+	kicked     atomic.Bool
+	done       chan struct{}
+	doneOnce   sync.Once
+}
+
+// newIdleTracker returns a new idleTracker.
+// Returns nil if idle player kick is disabled.
+func newIdleTracker(clientConn net.Conn, player, traceID string) *idleTracker {
+	if config.ConfigRuntime().Msh.KickIdlePlayersAfter <= 0 {
+		return nil
+	}
+
+	return &idleTracker{
+		clientConn: clientConn,
+		player:     player,
+		traceID:    traceID,
+		done:       make(chan struct{}),
+	}
+}
+
+// add records client --> server bytes (nil idleTracker is a no-op)
+func (it *idleTracker) add(n int) {
+	if it == nil {
+		return
+	}
+	atomic.AddInt64(&it.bytes, int64(n))
+}
+
+// stop stops the idle tracker watch (nil idleTracker is a no-op)
+func (it *idleTracker) stop() {
+	if it == nil {
+		return
+	}
+	it.doneOnce.Do(func() { close(it.done) })
+}
+
+// isKicked returns true if the player was kicked for being idle (nil idleTracker is a no-op)
+func (it *idleTracker) isKicked() bool {
+	if it == nil {
+		return false
+	}
+	return it.kicked.Load()
+}
+
+// watch checks client activity, warns the player when the kick is near and kicks the player when idle for too long.
+//
+// If the player name is unknown the client connection is closed without a disconnect message.
+//
+// [goroutine stoppable]
+func (it *idleTracker) watch() {
+	kickAfter := time.Duration(config.ConfigRuntime().Msh.KickIdlePlayersAfter) * time.Second
+	var idleFor time.Duration = 0
+	var warned bool = false
+
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-it.done:
+			return
+		case <-ticker.C:
+		}
+
+		if atomic.SwapInt64(&it.bytes, 0) >= idleBytesThreshold {
+			idleFor, warned = 0, false
+			continue
+		}
+		idleFor += idleCheckInterval
+
+		switch {
+		case idleFor >= kickAfter:
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "[%s] kicking idle player %s (idle for %s)", it.traceID, it.playerName(), idleFor)
+			it.kicked.Store(true)
+			if logMsh := it.kick(); logMsh != nil {
+				logMsh.Log(true)
+				// fallback: close the connection without disconnect message
+				_ = it.clientConn.Close()
+			}
+			return
+
+		case !warned && idleFor >= kickAfter-idleWarnAdvance:
+			warned = true
+			if logMsh := it.warn(kickAfter - idleFor); logMsh != nil {
+				logMsh.Log(true)
+			}
+		}
+	}
+}
+
+// warn notifies the player in game of the upcoming idle kick
+func (it *idleTracker) warn(left time.Duration) *errco.MshLog {
+	if !playerNameRegex.MatchString(it.player) {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_IDLE_KICK, "[%s] player name unknown, can't warn idle player", it.traceID)
+	}
+
+	gameMessage, err := json.Marshal(&model.GameRawMessage{Text: fmt.Sprintf("[MSH] you are idle and will be disconnected in %s", left), Color: "aqua", Bold: false})
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+	}
+
+	_, logMsh := servctrl.Execute("tellraw " + it.player + " " + string(gameMessage))
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// kick disconnects the player from ms with idleKickMessage
+func (it *idleTracker) kick() *errco.MshLog {
+	if !playerNameRegex.MatchString(it.player) {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_IDLE_KICK, "[%s] player name unknown, can't kick idle player", it.traceID)
+	}
+
+	_, logMsh := servctrl.Execute("kick " + it.player + " " + idleKickMessage)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// playerName returns the player name for logging purposes
+func (it *idleTracker) playerName() string {
+	if it.player == "" {
+		return "(unknown)"
+	}
+	return it.player
+}
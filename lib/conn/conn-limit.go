@@ -0,0 +1,181 @@
+package conn
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/servstats"
+)
+
+// handlerSem is a counting semaphore that limits concurrent connection handlers
+// (initialized on first use, nil if MaxHandlers is disabled)
+var handlerSem chan struct{}
+var handlerSemOnce sync.Once
+
+// handlerConn is a client connection that releases its handler slot when closed
+type handlerConn struct {
+	net.Conn
+	releaseOnce sync.Once
+}
+
+// Close closes the client connection and releases its handler slot
+func (c *handlerConn) Close() error {
+	c.releaseOnce.Do(func() {
+		atomic.AddInt32(&servstats.Stats.Handlers, -1)
+		if handlerSem != nil {
+			<-handlerSem
+		}
+	})
+	return c.Conn.Close()
+}
+
+// AcquireHandler acquires a connection handler slot for an accepted client connection.
+//
+// Returns the client connection that releases the slot when closed
+// and false if MaxHandlers concurrent handlers are already active.
+func AcquireHandler(clientConn net.Conn) (net.Conn, bool) {
+	handlerSemOnce.Do(func() {
+		if config.ConfigRuntime().Msh.MaxHandlers > 0 {
+			handlerSem = make(chan struct{}, config.ConfigRuntime().Msh.MaxHandlers)
+		}
+	})
+
+	if handlerSem != nil {
+		select {
+		case handlerSem <- struct{}{}:
+		default:
+			return clientConn, false
+		}
+	}
+
+	atomic.AddInt32(&servstats.Stats.Handlers, 1)
+
+	return &handlerConn{Conn: clientConn}, true
+}
+
+// ipConns tracks active connections per client ip
+var ipConns = struct {
+	m sync.Mutex
+	n map[string]int
+}{n: map[string]int{}}
+
+// ipConn is a client connection that releases its ip slot when closed
+type ipConn struct {
+	net.Conn
+	ip          string
+	releaseOnce sync.Once
+}
+
+// Close closes the client connection and releases its ip slot
+func (c *ipConn) Close() error {
+	c.releaseOnce.Do(func() {
+		ipConns.m.Lock()
+		defer ipConns.m.Unlock()
+		if ipConns.n[c.ip]--; ipConns.n[c.ip] <= 0 {
+			delete(ipConns.n, c.ip)
+		}
+	})
+	return c.Conn.Close()
+}
+
+// acquireIp acquires a connection slot for the client ip.
+//
+// Returns the client connection that releases the slot when closed
+// and false if MaxConnectionsPerIp connections from the client ip are already active.
+func acquireIp(clientConn net.Conn, ip string) (net.Conn, bool) {
+	if config.ConfigRuntime().Msh.MaxConnectionsPerIp <= 0 {
+		return clientConn, true
+	}
+
+	ipConns.m.Lock()
+	defer ipConns.m.Unlock()
+
+	if ipConns.n[ip] >= config.ConfigRuntime().Msh.MaxConnectionsPerIp {
+		return clientConn, false
+	}
+	ipConns.n[ip]++
+
+	return &ipConn{Conn: clientConn, ip: ip}, true
+}
+
+// rateCleanupInterval is the interval at which stale connection rate buckets are removed
+const rateCleanupInterval = 10 * time.Minute
+
+// rateLogCooldown is the minimum time between rate limit logs for the same client ip
+const rateLogCooldown = time.Minute
+
+// rateBucket is a token bucket that limits the connection rate of a client ip
+type rateBucket struct {
+	tokens  float64   // available connection tokens
+	last    time.Time // time of the last tokens update
+	lastLog time.Time // time of the last rate limit log
+}
+
+// ipRates tracks the connection rate buckets per client ip
+var ipRates = struct {
+	m           sync.Mutex
+	b           map[string]*rateBucket
+	lastCleanup time.Time
+}{b: map[string]*rateBucket{}}
+
+// take refills the bucket (perMinute tokens per minute, up to perMinute)
+// and returns true if a connection token could be taken.
+func (b *rateBucket) take(now time.Time, perMinute int) bool {
+	b.tokens += now.Sub(b.last).Minutes() * float64(perMinute)
+	if b.tokens > float64(perMinute) {
+		b.tokens = float64(perMinute)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// allowRate returns true if a new connection from the client ip is within MaxConnsPerMinute.
+// If the connection is not allowed, log reports if the rate limit should be logged
+// (once per rateLogCooldown for each ip).
+func allowRate(ip string) (allowed, log bool) {
+	perMinute := config.ConfigRuntime().Msh.MaxConnsPerMinute
+	if perMinute <= 0 {
+		return true, false
+	}
+
+	ipRates.m.Lock()
+	defer ipRates.m.Unlock()
+
+	now := time.Now()
+
+	// remove buckets that would be full by now (same as a new bucket)
+	if now.Sub(ipRates.lastCleanup) > rateCleanupInterval {
+		for i, b := range ipRates.b {
+			if now.Sub(b.last) > time.Minute && now.Sub(b.lastLog) > rateLogCooldown {
+				delete(ipRates.b, i)
+			}
+		}
+		ipRates.lastCleanup = now
+	}
+
+	b, ok := ipRates.b[ip]
+	if !ok {
+		b = &rateBucket{tokens: float64(perMinute), last: now}
+		ipRates.b[ip] = b
+	}
+
+	if b.take(now, perMinute) {
+		return true, false
+	}
+
+	if now.Sub(b.lastLog) < rateLogCooldown {
+		return false, false
+	}
+	b.lastLog = now
+
+	return false, true
+}
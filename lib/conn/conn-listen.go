@@ -0,0 +1,162 @@
+package conn
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/opsys"
+)
+
+// listenFdsStart is the first file descriptor passed with systemd socket activation
+const listenFdsStart = 3
+
+const (
+	bindRetryMinDelay = 500 * time.Millisecond // delay before the first bind retry
+	bindRetryMaxDelay = 8 * time.Second        // max delay between bind retries
+)
+
+// Listen returns the listener for new clients connections.
+//
+// If msh received a listening socket from the process that started it
+// (systemd socket activation: LISTEN_PID / LISTEN_FDS environment variables),
+// the inherited socket is used so that no connection is refused while msh is replaced.
+// Otherwise a new listener is opened on MshHost:MshPort (or on the first free port of MshPortRange).
+// Binding MshPort is retried for BindRetrySeconds.
+func Listen() (net.Listener, *errco.MshLog) {
+	listener, logMsh := inheritedListener()
+	if logMsh != nil {
+		// fall back to a normal bind
+		logMsh.Log(true)
+	} else if listener != nil {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "using inherited listening socket: %s", listener.Addr().String())
+		return listener, nil
+	}
+
+	if config.ConfigRuntime().Msh.MshPortRange != "" {
+		minPort, maxPort, ok := parsePortRange(config.ConfigRuntime().Msh.MshPortRange)
+		if ok {
+			return listenRange(minPort, maxPort)
+		}
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_LISTEN, "MshPortRange \"%s\" is invalid, using MshPort", config.ConfigRuntime().Msh.MshPortRange)
+	}
+
+	return listenRetry(net.JoinHostPort(config.MshHost, strconv.Itoa(config.MshPort)), time.Duration(config.ConfigRuntime().Msh.BindRetrySeconds)*time.Second)
+}
+
+// listenRetry opens a listener on address, retrying with exponential backoff
+// until it succeeds or window expires (ex: port not released yet after a msh restart).
+//
+// [blocking]
+func listenRetry(address string, window time.Duration) (net.Listener, *errco.MshLog) {
+	deadline := time.Now().Add(window)
+
+	for attempt := 1; ; attempt++ {
+		listener, err := opsys.ListenTCP(address)
+		if err == nil {
+			return listener, nil
+		}
+
+		delay := bindRetryDelay(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
+		}
+
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_LISTEN, "could not listen on %s (attempt %d), retrying in %s: %s", address, attempt, delay, err.Error())
+		time.Sleep(delay)
+	}
+}
+
+// bindRetryDelay returns the delay before the next bind attempt (doubled at each attempt)
+func bindRetryDelay(attempt int) time.Duration {
+	delay := bindRetryMinDelay
+	for i := 1; i < attempt && delay < bindRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > bindRetryMaxDelay {
+		delay = bindRetryMaxDelay
+	}
+
+	return delay
+}
+
+// listenRange opens a listener on the first free port in minPort-maxPort and sets it as msh port
+func listenRange(minPort, maxPort int) (net.Listener, *errco.MshLog) {
+	var err error
+	for port := minPort; port <= maxPort; port++ {
+		// minecraft server port might be free while minecraft server is offline
+		if port == config.ServPort {
+			continue
+		}
+
+		var listener net.Listener
+		listener, err = opsys.ListenTCP(net.JoinHostPort(config.MshHost, strconv.Itoa(port)))
+		if err != nil {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh port %d not available: %s", port, err.Error())
+			continue
+		}
+
+		// query port follows msh port if they were the same
+		if config.MshPortQuery == config.MshPort {
+			config.MshPortQuery = port
+		}
+		config.MshPort = port
+		config.ConfigRuntime().Msh.MshPort = port
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "msh port chosen from range %d-%d: %d", minPort, maxPort, port)
+
+		return listener, nil
+	}
+
+	return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CLIENT_LISTEN, "no free port in range %d-%d (%v)", minPort, maxPort, err)
+}
+
+// parsePortRange parses a port range (ex: "25555-25565").
+// Returns false if the range is invalid.
+func parsePortRange(r string) (int, int, bool) {
+	bounds := strings.SplitN(r, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+
+	minPort, err1 := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	maxPort, err2 := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err1 != nil || err2 != nil || minPort < 1 || maxPort > 65535 || minPort > maxPort {
+		return 0, 0, false
+	}
+
+	return minPort, maxPort, true
+}
+
+// inheritedListener returns the listening socket passed to msh (nil if there is none)
+func inheritedListener() (net.Listener, *errco.MshLog) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		// sockets were not passed to msh
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, "LISTEN_FDS is invalid: %s", os.Getenv("LISTEN_FDS"))
+	}
+
+	// unset variables so that they are not inherited by child processes (minecraft server)
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// only the first passed socket is used for clients connections
+	f := os.NewFile(uintptr(listenFdsStart), "msh-listener")
+	defer f.Close() // net.FileListener duplicates the file descriptor
+
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, "could not use inherited socket: %s", err.Error())
+	}
+
+	return listener, nil
+}
@@ -3,14 +3,19 @@ package conn
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"math/big"
 	"net"
+	"regexp"
 	"strings"
 	"time"
+	"unicode/utf16"
 
 	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/model"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
 )
 
 // buildMessage takes the request type and message to write to the client
@@ -65,34 +70,80 @@ func buildMessage(reqType int, message string) []byte {
 
 	// send server info
 	case errco.CLIENT_REQ_INFO:
+		return buildInfoMessage(message, -1)
 
-		// "&" [\x26] is converted to "§" [\xc2\xa7]
-		// this step is not strictly necessary if in msh-config is used the character "§"
-		message = strings.ReplaceAll(message, "&", "§")
+	default:
+		return nil
+	}
+}
 
-		// replace "\\n" with "\n" in case the new line was set as msh parameter
-		message = strings.ReplaceAll(message, "\\n", "\n")
+// buildInfoMessage returns the msh INFO response for a client using clientProtocol (-1 if unknown)
+func buildInfoMessage(message string, clientProtocol int) []byte {
+	dataInfJSON, err := json.Marshal(buildDataInfo(message, clientProtocol))
+	if err != nil {
+		// don't return error, just log a warning
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+		return nil
+	}
 
-		messageStruct := &model.DataInfo{}
-		messageStruct.Description.Text = message
-		messageStruct.Players.Max = 0
-		messageStruct.Players.Online = 0
-		messageStruct.Version.Name = config.ConfigRuntime.Server.Version
-		messageStruct.Version.Protocol = config.ConfigRuntime.Server.Protocol
-		messageStruct.Favicon = "data:image/png;base64," + config.ServerIcon
+	return buildStatusPacket(dataInfJSON)
+}
 
-		dataInfJSON, err := json.Marshal(messageStruct)
-		if err != nil {
-			// don't return error, just log a warning
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
-			return nil
-		}
+// buildDataInfo returns the status response sent by msh while ms is not online,
+// customized by Msh.StatusResponse.
+// clientProtocol is reported if EchoProtocol is enabled (-1 if unknown).
+func buildDataInfo(message string, clientProtocol int) *model.DataInfo {
+	sr := config.ConfigRuntime().Msh.StatusResponse
 
-		return mountHeader(dataInfJSON)
+	// replace msh info placeholders
+	message = config.ResolvePlaceholders(message)
 
-	default:
-		return nil
+	// "&" [\x26] is converted to "§" [\xc2\xa7]
+	// this step is not strictly necessary if in msh-config is used the character "§"
+	message = strings.ReplaceAll(message, "&", "§")
+
+	// replace "\\n" with "\n" in case the new line was set as msh parameter
+	message = strings.ReplaceAll(message, "\\n", "\n")
+
+	messageStruct := &model.DataInfo{}
+	messageStruct.Description.Text = message
+	messageStruct.Players.Max = config.ServMaxPlayers
+	messageStruct.Players.Online = 0
+	messageStruct.Version.Name = config.ConfigRuntime().Server.Version
+	messageStruct.Version.Protocol = config.ConfigRuntime().Server.Protocol
+	messageStruct.Favicon = "data:image/png;base64," + config.ServerIcon
+
+	if sr.ShowLastPlayerCount {
+		messageStruct.Players.Online = servctrl.LastPlayerCount()
+	}
+	for _, line := range sr.Sample {
+		line = strings.ReplaceAll(config.ResolvePlaceholders(line), "&", "§")
+		messageStruct.Players.Sample = append(messageStruct.Players.Sample, model.DataSample{Name: line, Id: "00000000-0000-0000-0000-000000000000"})
 	}
+	if sr.VersionName != "" {
+		messageStruct.Version.Name = strings.ReplaceAll(sr.VersionName, "&", "§")
+	}
+	switch {
+	case sr.EchoProtocol && clientProtocol >= 0:
+		messageStruct.Version.Protocol = clientProtocol
+	case sr.Protocol != 0:
+		messageStruct.Version.Protocol = sr.Protocol
+	}
+
+	// while ms is starting, replace player count display.
+	// when protocol does not match, client shows version name in place of player count.
+	if servstats.Stats.Status == errco.SERVER_STATUS_STARTING {
+		switch config.ConfigRuntime().Msh.Ping.StartingDisplay {
+		case "hidden":
+			messageStruct.Version.Name = ""
+			messageStruct.Version.Protocol = -1
+		case "dash":
+			messageStruct.Version.Name = "§7-"
+			messageStruct.Version.Protocol = -1
+		}
+	}
+
+	return messageStruct
 }
 
 // getReqType returns the request packet, type (INFO or JOIN).
@@ -112,6 +163,16 @@ func getReqType(clientConn net.Conn) ([]byte, int, *errco.MshLog) {
 	reqFlagInfo := append(MshPortByt, byte(1))              // flag contained in INFO request packet -> [99 211 1]
 	reqFlagJoin := append(MshPortByt, byte(2))              // flag contained in JOIN request packet -> [99 211 2]
 
+	// http clients (ex: monitoring tools) pointed at msh port by mistake
+	if isHttpPreface(dataReqFull) {
+		return dataReqFull, errco.CLIENT_REQ_HTTP, nil
+	}
+
+	// legacy ping has a different format (pre-netty clients)
+	if legacyPingVariant(dataReqFull) != legacyPingNone {
+		return dataReqFull, errco.CLIENT_REQ_LEGACY, nil
+	}
+
 	// extract request type key byte
 	reqTypeKeyByte := byte(0)
 	if len(dataReqFull) > int(dataReqFull[0]) {
@@ -164,6 +225,302 @@ func getReqType(clientConn net.Conn) ([]byte, int, *errco.MshLog) {
 	}
 }
 
+// handshake contains the fields of the client handshake packet
+type handshake struct {
+	protocol  int    // client protocol version
+	address   string // server address used by the client to connect
+	port      int    // server port used by the client to connect
+	nextState int    // 1: status (INFO), 2: login (JOIN)
+	player    string // player name from login start packet following the handshake ("" if not available)
+}
+
+// parseHandshake parses the client handshake packet (first packet sent by the client).
+//
+// scheme:  [ length | packet id (0) | protocol | address length | address | port    | next state ]
+// type:    [ VarInt | VarInt        | VarInt   | VarInt         | string  | uint16  | VarInt     ]
+//
+// If the login start packet follows the handshake, the player name is parsed too.
+//
+// scheme:  [ length | packet id (0) | name length | name   | ... ]
+// type:    [ VarInt | VarInt        | VarInt      | string | ... ]
+func parseHandshake(data []byte) (*handshake, *errco.MshLog) {
+	h := &handshake{}
+	var i, packetID, addrLen int
+	var ok bool
+
+	if _, i, ok = readVarInt(data, 0); !ok {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "handshake length could not be parsed")
+	}
+	if packetID, i, ok = readVarInt(data, i); !ok || packetID != 0 {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "handshake packet id is invalid")
+	}
+	if h.protocol, i, ok = readVarInt(data, i); !ok {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "handshake protocol could not be parsed")
+	}
+	if addrLen, i, ok = readVarInt(data, i); !ok || i+addrLen+2 > len(data) {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "handshake address could not be parsed")
+	}
+
+	// forge clients append "\x00FML\x00" (or similar) to the address
+	h.address = strings.Split(string(data[i:i+addrLen]), "\x00")[0]
+	i += addrLen
+
+	h.port = int(data[i])<<8 | int(data[i+1])
+	i += 2
+
+	if h.nextState, i, ok = readVarInt(data, i); !ok {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "handshake next state could not be parsed")
+	}
+
+	// parse login start packet (if any)
+	// a missing or malformed login start packet is not an handshake error
+	var nameLen int
+	if h.nextState != 2 {
+		return h, nil
+	}
+	if _, i, ok = readVarInt(data, i); !ok {
+		return h, nil
+	}
+	if packetID, i, ok = readVarInt(data, i); !ok || packetID != 0 {
+		return h, nil
+	}
+	if nameLen, i, ok = readVarInt(data, i); !ok || i+nameLen > len(data) {
+		return h, nil
+	}
+	h.player = string(data[i : i+nameLen])
+
+	return h, nil
+}
+
+// readVarInt reads a VarInt starting at data[i] and returns its value and the index of the following byte
+func readVarInt(data []byte, i int) (int, int, bool) {
+	value := 0
+	for n := 0; n < 5; n++ {
+		if i >= len(data) {
+			return 0, i, false
+		}
+		value |= int(data[i]&0x7f) << (7 * n)
+		i++
+		if data[i-1]&0x80 == 0 {
+			return value, i, true
+		}
+	}
+	return 0, i, false
+}
+
+// writeVarInt returns the VarInt encoding of value
+func writeVarInt(value int) []byte {
+	var data []byte
+	v := uint32(value)
+	for {
+		if v&^0x7f == 0 {
+			return append(data, byte(v))
+		}
+		data = append(data, byte(v&0x7f|0x80))
+		v >>= 7
+	}
+}
+
+// rewriteHandshakeProtocol re-encodes the client handshake packet with a different protocol.
+// Data following the handshake packet (ex: login start packet) is preserved.
+//
+// scheme:  [ length | packet id (0) | protocol | ...rest of handshake ] [ following data ]
+// type:    [ VarInt | VarInt        | VarInt   | ...                  ] [ ...            ]
+func rewriteHandshakeProtocol(data []byte, protocol int) ([]byte, *errco.MshLog) {
+	length, i, ok := readVarInt(data, 0)
+	if !ok || i+length > len(data) {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "handshake length could not be parsed")
+	}
+	end := i + length // index of the first byte after the handshake packet
+
+	packetID, j, ok := readVarInt(data, i)
+	if !ok || packetID != 0 {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "handshake packet id is invalid")
+	}
+	_, k, ok := readVarInt(data, j)
+	if !ok || k > end {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "handshake protocol could not be parsed")
+	}
+
+	body := append([]byte{}, data[i:j]...)        // packet id
+	body = append(body, writeVarInt(protocol)...) // new protocol
+	body = append(body, data[k:end]...)           // rest of handshake
+
+	rewritten := append(writeVarInt(len(body)), body...)
+	rewritten = append(rewritten, data[end:]...)
+
+	return rewritten, nil
+}
+
+// rewriteStatusSample rewrites the player sample of a status response json.
+// If override is not empty the sample is replaced, then extra lines are added.
+// Fields of the status response unknown to msh are preserved.
+func rewriteStatusSample(statusJSON []byte, override, extra []string) ([]byte, *errco.MshLog) {
+	var status map[string]interface{}
+	err := json.Unmarshal(statusJSON, &status)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
+	}
+
+	players, ok := status["players"].(map[string]interface{})
+	if !ok {
+		players = map[string]interface{}{"max": 0, "online": 0}
+		status["players"] = players
+	}
+
+	sample, _ := players["sample"].([]interface{})
+	if len(override) > 0 {
+		sample = []interface{}{}
+		for _, name := range override {
+			sample = append(sample, map[string]interface{}{"name": name, "id": "00000000-0000-0000-0000-000000000000"})
+		}
+	}
+	for _, name := range extra {
+		sample = append(sample, map[string]interface{}{"name": name, "id": "00000000-0000-0000-0000-000000000000"})
+	}
+	players["sample"] = sample
+
+	rewritten, err := json.Marshal(status)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+	}
+
+	return rewritten, nil
+}
+
+// buildStatusPacket builds a status response packet containing the specified json.
+//
+// scheme:  [ length | packet id (0) | json length | json   ]
+// type:    [ VarInt | VarInt        | VarInt      | string ]
+func buildStatusPacket(statusJSON []byte) []byte {
+	body := append([]byte{0}, writeVarInt(len(statusJSON))...)
+	body = append(body, statusJSON...)
+
+	return append(writeVarInt(len(body)), body...)
+}
+
+// parseStatusPacket returns the json of a status response packet.
+// Returns false if data does not contain a complete status response packet.
+func parseStatusPacket(data []byte) ([]byte, bool) {
+	length, i, ok := readVarInt(data, 0)
+	if !ok || i+length > len(data) {
+		return nil, false
+	}
+
+	packetID, j, ok := readVarInt(data, i)
+	if !ok || packetID != 0 {
+		return nil, false
+	}
+
+	jsonLen, k, ok := readVarInt(data, j)
+	if !ok || k+jsonLen > i+length {
+		return nil, false
+	}
+
+	return data[k : k+jsonLen], true
+}
+
+// legacy ping variants (server list ping of pre-netty clients)
+const (
+	legacyPingNone = iota // not a legacy ping
+	legacyPingBeta        // beta 1.8 - 1.3:	[ 0xFE ]
+	legacyPing14          // 1.4 - 1.5:		[ 0xFE 0x01 ]
+	legacyPing16          // 1.6:			[ 0xFE 0x01 0xFA (MC|PingHost plugin message) ]
+)
+
+// legacyPingVariant returns the legacy ping variant of the first client packet (legacyPingNone if not a legacy ping).
+//
+// A modern handshake of length 254 also starts with [ 0xFE 0x01 ] but is followed by packet id 0x00.
+func legacyPingVariant(data []byte) int {
+	switch {
+	case len(data) == 0 || data[0] != 0xFE:
+		return legacyPingNone
+	case len(data) == 1:
+		return legacyPingBeta
+	case data[1] != 0x01:
+		return legacyPingNone
+	case len(data) == 2:
+		return legacyPing14
+	case data[2] == 0xFA:
+		return legacyPing16
+	default:
+		return legacyPingNone
+	}
+}
+
+// legacyFormatCodes matches minecraft formatting codes (not supported by beta legacy ping)
+var legacyFormatCodes = regexp.MustCompile("§.?")
+
+// buildLegacyPing builds the kick packet used to respond to a legacy ping.
+//
+// scheme:  [ packet id (0xFF) | string length (chars) | string    ]
+// type:    [ byte             | uint16                | UTF-16BE  ]
+//
+// beta 1.8 - 1.3 string:	motd§online§max (formatting codes not supported)
+//
+// 1.4 - 1.6 string:		§1\x00protocol\x00version\x00motd\x00online\x00max
+//
+// (as for modern INFO response, "&" is converted to "§" and new lines are replaced with spaces)
+func buildLegacyPing(variant int, motd, version string, protocol, online, maxPlayers int) []byte {
+	// legacy motd is a single line
+	motd = strings.ReplaceAll(motd, "\\n", " ")
+	motd = strings.ReplaceAll(motd, "\n", " ")
+	motd = strings.ReplaceAll(motd, "&", "§")
+
+	var s string
+	switch variant {
+	case legacyPingBeta:
+		// § is the field separator: remove formatting codes
+		motd = legacyFormatCodes.ReplaceAllString(motd, "")
+		s = fmt.Sprintf("%s§%d§%d", strings.TrimSpace(motd), online, maxPlayers)
+	case legacyPing14, legacyPing16:
+		s = fmt.Sprintf("§1\x00%d\x00%s\x00%s\x00%d\x00%d", protocol, version, strings.TrimSpace(motd), online, maxPlayers)
+	default:
+		return nil
+	}
+
+	chars := utf16.Encode([]rune(s))
+
+	data := []byte{0xFF, byte(len(chars) >> 8), byte(len(chars))}
+	for _, c := range chars {
+		data = append(data, byte(c>>8), byte(c))
+	}
+
+	return data
+}
+
+// httpMethods are the request methods that identify an http request preface
+var httpMethods = []string{"GET ", "POST ", "HEAD ", "PUT ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+// isHttpPreface returns true if the first client packet looks like an http request
+func isHttpPreface(data []byte) bool {
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(data, []byte(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildHttpResponse builds the response to an http request received on msh port.
+//
+// response is HttpOnMcPortResponse: "400" for a bad request response, an http(s) url for a redirect response.
+// Returns nil if no response should be sent.
+func buildHttpResponse(response string) []byte {
+	var status, header, body string
+
+	switch {
+	case response == "400":
+		status, body = "400 Bad Request", "this port serves minecraft clients\n"
+	case strings.HasPrefix(response, "http://") || strings.HasPrefix(response, "https://"):
+		status, header, body = "302 Found", "Location: "+response+"\r\n", "this port serves minecraft clients, see "+response+"\n"
+	default:
+		return nil
+	}
+
+	return []byte(fmt.Sprintf("HTTP/1.1 %s\r\n%sContent-Type: text/plain\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", status, header, len(body), body))
+}
+
 // getPing performs msh PING response to the client PING request
 // (must be performed after msh INFO response)
 func getPing(clientConn net.Conn) *errco.MshLog {
@@ -2,13 +2,20 @@ package conn
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/servstats"
+	"msh/lib/utility"
 )
 
 type test struct {
@@ -276,3 +283,411 @@ func Test_getPing(t *testing.T) {
 		serverSocket.Close()
 	}
 }
+
+func Test_parseHandshake(t *testing.T) {
+	tests := []struct {
+		title  string
+		data   []byte
+		expect *handshake
+	}{
+		// positive cases
+		{
+			"client info request (1.18.2 local)",
+			[]byte{16, 0, 246, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 1},
+			&handshake{758, "127.0.0.1", 25555, 1, ""},
+		},
+		{
+			"client join request (1.18.2 local) + login start",
+			[]byte{33, 0, 246, 5, 26, 107, 117, 98, 101, 114, 110, 101, 116, 101, 115, 46, 100, 111, 99, 107, 101, 114, 46, 105, 110, 116, 101, 114, 110, 97, 108, 99, 211, 2, 11, 0, 9, 103, 101, 107, 105, 103, 101, 107, 57, 57},
+			&handshake{758, "kubernetes.docker.internal", 25555, 2, "gekigek99"},
+		},
+		{
+			"client join request (1.18.2 local) without login start",
+			[]byte{16, 0, 246, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 2},
+			&handshake{758, "127.0.0.1", 25555, 2, ""},
+		},
+
+		// negative cases
+		{
+			"truncated address",
+			[]byte{16, 0, 246, 5, 9, 49, 50, 55},
+			nil,
+		},
+		{
+			"wrong packet id",
+			[]byte{9, 1, 0, 0, 0, 0, 0, 89, 73, 114},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		h, logMsh := parseHandshake(tt.data)
+		switch {
+		case tt.expect == nil && logMsh == nil:
+			t.Errorf("%s: expected error, got %+v", tt.title, h)
+		case tt.expect != nil && logMsh != nil:
+			t.Errorf("%s: unexpected error: %s", tt.title, logMsh.Mex)
+		case tt.expect != nil && *h != *tt.expect:
+			t.Errorf("%s: expected %+v, got %+v", tt.title, tt.expect, h)
+		}
+	}
+}
+
+func Test_legacyPingVariant(t *testing.T) {
+	tests := []struct {
+		title  string
+		data   []byte
+		expect int
+	}{
+		{"beta 1.8 - 1.3 legacy ping", []byte{0xFE}, legacyPingBeta},
+		{"1.4 - 1.5 legacy ping", []byte{0xFE, 0x01}, legacyPing14},
+		{"1.6 legacy ping", []byte{0xFE, 0x01, 0xFA, 0x00, 0x0B, 0x00, 0x4D, 0x00, 0x43, 0x00, 0x7C, 0x00, 0x50, 0x00, 0x69, 0x00, 0x6E, 0x00, 0x67, 0x00, 0x48, 0x00, 0x6F, 0x00, 0x73, 0x00, 0x74}, legacyPing16},
+		{"modern handshake of length 254", []byte{0xFE, 0x01, 0x00, 0xF6, 0x05}, legacyPingNone},
+		{"modern info request", []byte{16, 0, 246, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 1}, legacyPingNone},
+		{"empty", []byte{}, legacyPingNone},
+	}
+
+	for _, tt := range tests {
+		if got := legacyPingVariant(tt.data); got != tt.expect {
+			t.Errorf("%s: expected variant %d, got %d", tt.title, tt.expect, got)
+		}
+	}
+}
+
+func Test_buildLegacyPing(t *testing.T) {
+	// utf16be encodes an ascii/latin string as UTF-16BE
+	utf16be := func(s string) []byte {
+		var b []byte
+		for _, r := range s {
+			b = append(b, byte(r>>8), byte(r))
+		}
+		return b
+	}
+
+	tests := []struct {
+		title   string
+		variant int
+		motd    string
+		expect  string
+	}{
+		{"beta 1.8 - 1.3", legacyPingBeta, "  §b§lHIBERNATING", "HIBERNATING§0§20"},
+		{"1.4 - 1.5", legacyPing14, "§fserver status:\n§b§lHIBERNATING", "§1\x0078\x001.6.4\x00§fserver status: §b§lHIBERNATING\x000\x0020"},
+		{"1.6", legacyPing16, "&6WARMING UP", "§1\x0078\x001.6.4\x00§6WARMING UP\x000\x0020"},
+	}
+
+	for _, tt := range tests {
+		expect := append([]byte{0xFF, 0, byte(len([]rune(tt.expect)))}, utf16be(tt.expect)...)
+		if got := buildLegacyPing(tt.variant, tt.motd, "1.6.4", 78, 0, 20); !bytes.Equal(got, expect) {
+			t.Errorf("%s: expected %v, got %v", tt.title, expect, got)
+		}
+	}
+
+	if got := buildLegacyPing(legacyPingNone, "", "", 0, 0, 0); got != nil {
+		t.Errorf("not a legacy ping: expected nil, got %v", got)
+	}
+}
+
+func Test_isHttpPreface(t *testing.T) {
+	tests := []struct {
+		title  string
+		data   []byte
+		expect bool
+	}{
+		{"http GET", []byte("GET / HTTP/1.1\r\nHost: localhost:25555\r\n\r\n"), true},
+		{"http POST", []byte("POST /api HTTP/1.1\r\n"), true},
+		{"http HEAD", []byte("HEAD / HTTP/1.0\r\n"), true},
+		{"client info request", []byte{16, 0, 246, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 1}, false},
+		{"legacy ping", []byte{0xFE, 0x01}, false},
+		{"lowercase method", []byte("get / HTTP/1.1\r\n"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isHttpPreface(tt.data); got != tt.expect {
+			t.Errorf("%s: expected %t, got %t", tt.title, tt.expect, got)
+		}
+	}
+}
+
+func Test_buildHttpResponse(t *testing.T) {
+	if got := buildHttpResponse(""); got != nil {
+		t.Errorf("empty response: expected nil, got %q", got)
+	}
+
+	if got := buildHttpResponse("400"); !bytes.HasPrefix(got, []byte("HTTP/1.1 400 Bad Request\r\n")) {
+		t.Errorf("400 response: unexpected response %q", got)
+	}
+
+	got := buildHttpResponse("https://example.com/help")
+	if !bytes.HasPrefix(got, []byte("HTTP/1.1 302 Found\r\nLocation: https://example.com/help\r\n")) {
+		t.Errorf("redirect response: unexpected response %q", got)
+	}
+}
+
+func Test_rewriteHandshakeProtocol(t *testing.T) {
+	tests := []struct {
+		title    string
+		data     []byte
+		protocol int
+		expect   []byte
+	}{
+		{
+			"join request + login start, protocol 759 -> 760 (same VarInt size)",
+			[]byte{16, 0, 247, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 2, 11, 0, 9, 103, 101, 107, 105, 103, 101, 107, 57, 57},
+			760,
+			[]byte{16, 0, 248, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 2, 11, 0, 9, 103, 101, 107, 105, 103, 101, 107, 57, 57},
+		},
+		{
+			"join request, protocol 47 -> 760 (longer VarInt)",
+			[]byte{15, 0, 47, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 2},
+			760,
+			[]byte{16, 0, 248, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 2},
+		},
+		{
+			"truncated handshake",
+			[]byte{16, 0, 247, 5, 9, 49},
+			760,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got, logMsh := rewriteHandshakeProtocol(tt.data, tt.protocol)
+		switch {
+		case tt.expect == nil && logMsh == nil:
+			t.Errorf("%s: expected error, got %v", tt.title, got)
+		case tt.expect != nil && logMsh != nil:
+			t.Errorf("%s: unexpected error: %s", tt.title, logMsh.Mex)
+		case !bytes.Equal(got, tt.expect):
+			t.Errorf("%s: expected %v, got %v", tt.title, tt.expect, got)
+		}
+
+		// rewritten handshake must be parsable with the new protocol
+		if tt.expect != nil {
+			if h, logMsh := parseHandshake(got); logMsh != nil || h.protocol != tt.protocol {
+				t.Errorf("%s: rewritten handshake not parsable with protocol %d", tt.title, tt.protocol)
+			}
+		}
+	}
+}
+
+func Test_rewriteStatusSample(t *testing.T) {
+	status := []byte(`{"version":{"name":"1.20.1","protocol":763},"players":{"max":20,"online":1,"sample":[{"name":"steve","id":"4566e69f-c907-48ee-8d71-d7ba5aa00d20"}]},"description":{"text":"hi"},"enforcesSecureChat":true}`)
+
+	type test struct {
+		override []string
+		extra    []string
+		expNames []string
+	}
+
+	var tests []test = []test{
+		{nil, []string{"play.example.com"}, []string{"steve", "play.example.com"}},
+		{[]string{"a", "b"}, nil, []string{"a", "b"}},
+		{[]string{"a"}, []string{"b"}, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		rewritten, logMsh := rewriteStatusSample(status, tt.override, tt.extra)
+		if logMsh != nil {
+			t.Fatalf("rewriteStatusSample returned error: %s", logMsh.Mex)
+		}
+
+		var got struct {
+			Players struct {
+				Max    int `json:"max"`
+				Sample []struct {
+					Name string `json:"name"`
+				} `json:"sample"`
+			} `json:"players"`
+			EnforcesSecureChat bool `json:"enforcesSecureChat"`
+		}
+		if err := json.Unmarshal(rewritten, &got); err != nil {
+			t.Fatalf("rewritten status is invalid json: %s", err.Error())
+		}
+
+		var names []string
+		for _, s := range got.Players.Sample {
+			names = append(names, s.Name)
+		}
+		if !reflect.DeepEqual(names, tt.expNames) || got.Players.Max != 20 || !got.EnforcesSecureChat {
+			t.Errorf("rewriteStatusSample(%v, %v) = %s", tt.override, tt.extra, rewritten)
+		}
+
+		// status packet round trip
+		parsed, ok := parseStatusPacket(buildStatusPacket(rewritten))
+		if !ok || !bytes.Equal(parsed, rewritten) {
+			t.Errorf("parseStatusPacket(buildStatusPacket()) = %s, %v", parsed, ok)
+		}
+	}
+}
+
+func Test_rateBucket(t *testing.T) {
+	now := time.Now()
+	b := &rateBucket{tokens: 2, last: now}
+
+	for i, expect := range []bool{true, true, false} {
+		if got := b.take(now, 2); got != expect {
+			t.Errorf("take %d: got %v, expected %v", i, got, expect)
+		}
+	}
+
+	// half a minute refills 1 token
+	if !b.take(now.Add(30*time.Second), 2) {
+		t.Error("expected token after refill")
+	}
+	if b.take(now.Add(30*time.Second), 2) {
+		t.Error("expected no token after refill was used")
+	}
+
+	// refill is capped at perMinute tokens
+	b.take(now.Add(time.Hour), 2)
+	if b.tokens != 1 {
+		t.Errorf("got %v tokens, expected 1", b.tokens)
+	}
+}
+
+func Test_buildBedrockPong(t *testing.T) {
+	mes := buildBedrockPong(42, 7, "server status:\nHIBERNATING", "1.20.0", 589, 0, 10, 19132)
+
+	if mes[0] != raknetUnconnectedPong {
+		t.Fatalf("got packet id %d, expected %d", mes[0], raknetUnconnectedPong)
+	}
+	if !bytes.Equal(mes[17:33], raknetMagic) {
+		t.Fatalf("magic not found at offset 17")
+	}
+
+	expect := "MCPE;server status:;589;1.20.0;0;10;7;HIBERNATING;Survival;1;19132;19132;"
+	if got := string(mes[35:]); got != expect {
+		t.Errorf("got server id %q, expected %q", got, expect)
+	}
+}
+
+func Test_buildDataInfo(t *testing.T) {
+	config.ConfigRuntime().Server.Version = "1.20.1"
+	config.ConfigRuntime().Server.Protocol = 763
+	defer func() { config.ConfigRuntime().Msh.StatusResponse = model.StatusResponse{} }()
+
+	type test struct {
+		sr             model.StatusResponse
+		clientProtocol int
+		expName        string
+		expProtocol    int
+		expSample      int
+	}
+
+	var tests []test = []test{
+		{model.StatusResponse{}, 340, "1.20.1", 763, 0},
+		{model.StatusResponse{VersionName: "&bclick to wake", Protocol: 765}, 340, "§bclick to wake", 765, 0},
+		{model.StatusResponse{Protocol: 765, EchoProtocol: true}, 340, "1.20.1", 340, 0},
+		{model.StatusResponse{Protocol: 765, EchoProtocol: true}, -1, "1.20.1", 765, 0},
+		{model.StatusResponse{Sample: []string{"join to wake", "&7the server"}}, 340, "1.20.1", 763, 2},
+	}
+
+	for _, tt := range tests {
+		config.ConfigRuntime().Msh.StatusResponse = tt.sr
+		info := buildDataInfo("hibernating", tt.clientProtocol)
+		if info.Version.Name != tt.expName || info.Version.Protocol != tt.expProtocol || len(info.Players.Sample) != tt.expSample {
+			t.Errorf("buildDataInfo() with %+v, client protocol %d: version %q %d, %d sample lines, expected %q %d, %d sample lines",
+				tt.sr, tt.clientProtocol, info.Version.Name, info.Version.Protocol, len(info.Players.Sample), tt.expName, tt.expProtocol, tt.expSample)
+		}
+	}
+}
+
+func Test_parseProxyHeader(t *testing.T) {
+	// v1
+	addr, logMsh := parseProxyHeaderV1("PROXY TCP4 203.0.113.7 10.0.0.2 51234 25565\r\n")
+	if logMsh != nil || addr.String() != "203.0.113.7:51234" {
+		t.Errorf("v1: got %v %v, expected 203.0.113.7:51234", addr, logMsh)
+	}
+	if addr, logMsh := parseProxyHeaderV1("PROXY UNKNOWN\r\n"); logMsh != nil || addr != nil {
+		t.Errorf("v1 unknown: got %v %v, expected nil address", addr, logMsh)
+	}
+	for _, line := range []string{"PROXY TCP4 203.0.113.7\r\n", "PROXY TCP4 x 10.0.0.2 1 2\r\n", "PROXY TCP4 203.0.113.7 10.0.0.2 99999 25565\r\n"} {
+		if _, logMsh := parseProxyHeaderV1(line); logMsh == nil {
+			t.Errorf("v1 %q: expected error", line)
+		}
+	}
+
+	// v2 (built by utility.ProxyHeader)
+	src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 25565}
+	header := utility.ProxyHeader(src, dst)
+	addr, logMsh = readProxyHeaderV2(bytes.NewReader(header[len(utility.ProxyHeaderSig):]))
+	if logMsh != nil || addr.String() != src.String() {
+		t.Errorf("v2: got %v %v, expected %s", addr, logMsh, src)
+	}
+	if addr, logMsh := readProxyHeaderV2(bytes.NewReader(utility.ProxyHeader(nil, nil)[len(utility.ProxyHeaderSig):])); logMsh != nil || addr != nil {
+		t.Errorf("v2 local: got %v %v, expected nil address", addr, logMsh)
+	}
+	if _, logMsh := readProxyHeaderV2(bytes.NewReader([]byte{0x21, 0x11, 0x00, 0x0c, 1, 2})); logMsh == nil {
+		t.Error("v2 truncated: expected error")
+	}
+}
+
+func Test_splitPackets(t *testing.T) {
+	keepAlive := buildLoginPluginRequest(1, "msh:wait")
+	if !bytes.Equal(keepAlive, []byte{11, 4, 1, 8, 'm', 's', 'h', ':', 'w', 'a', 'i', 't'}) {
+		t.Errorf("buildLoginPluginRequest: got %v", keepAlive)
+	}
+
+	// login start, login plugin response, incomplete packet
+	data := []byte{5, 0, 3, 'b', 'o', 'b', 3, 2, 1, 0, 4, 2}
+	packets, rest := splitPackets(data)
+	if len(packets) != 2 || !bytes.Equal(rest, []byte{4, 2}) {
+		t.Fatalf("splitPackets: got %v, rest %v", packets, rest)
+	}
+	if packetId(packets[0]) != 0 || packetId(packets[1]) != loginPluginResponseId {
+		t.Errorf("packetId: got %d, %d", packetId(packets[0]), packetId(packets[1]))
+	}
+	if n := countPluginResponses(packets); n != 1 {
+		t.Errorf("countPluginResponses: got %d, expected 1", n)
+	}
+}
+
+func Test_openProxyDialFailure(t *testing.T) {
+	config.ServTargets = []string{"127.0.0.1:1"} // nothing listens on port 1
+	defer func() { config.ServTargets = nil }()
+
+	client, other := net.Pipe()
+	defer other.Close()
+	go io.Copy(io.Discard, other)
+
+	clientConn, ok := AcquireHandler(client)
+	if !ok {
+		t.Fatal("AcquireHandler: handler slot not acquired")
+	}
+	if got := atomic.LoadInt32(&servstats.Stats.Handlers); got != 1 {
+		t.Fatalf("got %d active handlers, expected 1", got)
+	}
+
+	openProxy(clientConn, nil, errco.CLIENT_REQ_JOIN, "test", "", nil)
+
+	if got := atomic.LoadInt32(&servstats.Stats.Handlers); got != 0 {
+		t.Errorf("got %d active handlers after dial failure, expected 0", got)
+	}
+}
+
+func Test_acquireIpRelease(t *testing.T) {
+	config.ConfigRuntime().Msh.MaxConnectionsPerIp = 1
+	defer func() { config.ConfigRuntime().Msh.MaxConnectionsPerIp = 0 }()
+	config.ServTargets = []string{"127.0.0.1:1"} // nothing listens on port 1
+	defer func() { config.ServTargets = nil }()
+
+	for i := 0; i < 3; i++ {
+		client, other := net.Pipe()
+		go io.Copy(io.Discard, other)
+
+		clientConn, ok := acquireIp(client, "10.0.0.1")
+		if !ok {
+			t.Fatalf("attempt %d: ip slot not released by previous connection", i)
+		}
+		if _, ok := acquireIp(client, "10.0.0.1"); ok {
+			t.Fatalf("attempt %d: MaxConnectionsPerIp exceeded", i)
+		}
+
+		// backend dial failure must release the ip slot
+		if openProxy(clientConn, nil, errco.CLIENT_REQ_JOIN, "test", "", nil) {
+			t.Fatalf("attempt %d: proxy opened to unreachable backend", i)
+		}
+		other.Close()
+	}
+}
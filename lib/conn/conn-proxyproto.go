@@ -0,0 +1,156 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/utility"
+)
+
+// proxyHeaderTimeout is the time a client has to send the PROXY protocol header
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyHeaderV1MaxLength is the maximum length of a PROXY protocol v1 header (CRLF included)
+const proxyHeaderV1MaxLength = 107
+
+// proxiedConn is a client connection whose remote address is the one reported by the PROXY protocol header
+type proxiedConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+// RemoteAddr returns the real client address
+func (c *proxiedConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// readProxyHeader reads the PROXY protocol (v1 or v2) header sent by a load balancer
+// and returns the client connection with the real client address as remote address.
+//
+// If the header reports a LOCAL/UNKNOWN connection (ex: load balancer health check),
+// the remote address is not changed.
+func readProxyHeader(clientConn net.Conn) (net.Conn, *errco.MshLog) {
+	clientConn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer clientConn.SetReadDeadline(time.Time{})
+
+	// both v1 ("PROXY UNKNOWN\r\n") and v2 headers are at least 12 bytes long
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(clientConn, head); err != nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "could not read PROXY header: %s", err.Error())
+	}
+
+	var addr net.Addr
+	var logMsh *errco.MshLog
+	switch {
+	case bytes.Equal(head, utility.ProxyHeaderSig):
+		addr, logMsh = readProxyHeaderV2(clientConn)
+	case bytes.HasPrefix(head, []byte("PROXY ")):
+		addr, logMsh = readProxyHeaderV1(clientConn, head)
+	default:
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "connection does not start with a PROXY header")
+	}
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	if addr == nil {
+		return clientConn, nil
+	}
+
+	return &proxiedConn{Conn: clientConn, remoteAddr: addr}, nil
+}
+
+// readProxyHeaderV1 reads the rest of a PROXY protocol v1 header:
+// "PROXY TCP4 <src ip> <dst ip> <src port> <dst port>\r\n"
+func readProxyHeaderV1(r io.Reader, head []byte) (net.Addr, *errco.MshLog) {
+	line := append([]byte{}, head...)
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyHeaderV1MaxLength {
+			return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY v1 header too long")
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "could not read PROXY v1 header: %s", err.Error())
+		}
+		line = append(line, b[0])
+	}
+
+	return parseProxyHeaderV1(string(line))
+}
+
+// parseProxyHeaderV1 parses a PROXY protocol v1 header and returns the source address (nil if UNKNOWN)
+func parseProxyHeaderV1(line string) (net.Addr, *errco.MshLog) {
+	fields := strings.Fields(strings.TrimSuffix(line, "\r\n"))
+	if len(fields) >= 2 && fields[0] == "PROXY" && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || fields[0] != "PROXY" || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY v1 header is malformed: %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || net.ParseIP(fields[3]) == nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY v1 header is malformed: %q", line)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads the rest of a PROXY protocol v2 header (after the signature)
+// and returns the source address (nil if LOCAL or not tcp/udp over ip).
+func readProxyHeaderV2(r io.Reader) (net.Addr, *errco.MshLog) {
+	// [ver_cmd] [fam] [uint16 length] [addresses]
+	meta := make([]byte, 4)
+	if _, err := io.ReadFull(r, meta); err != nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "could not read PROXY v2 header: %s", err.Error())
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(meta[2:4]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "could not read PROXY v2 header: %s", err.Error())
+	}
+
+	return parseProxyHeaderV2(meta[0], meta[1], data)
+}
+
+// parseProxyHeaderV2 parses the PROXY protocol v2 header fields and returns the source address (nil if LOCAL or not ip)
+func parseProxyHeaderV2(verCmd, fam byte, data []byte) (net.Addr, *errco.MshLog) {
+	if verCmd>>4 != 2 {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY v2 header version %d is invalid", verCmd>>4)
+	}
+
+	switch verCmd & 0x0f {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY v2 header command %d is invalid", verCmd&0x0f)
+	}
+
+	// address family (high nibble): 1 IPv4, 2 IPv6 (unix sockets and unspecified are ignored)
+	var ipLen int
+	switch fam >> 4 {
+	case 0x1:
+		ipLen = net.IPv4len
+	case 0x2:
+		ipLen = net.IPv6len
+	default:
+		return nil, nil
+	}
+
+	if len(data) < 2*ipLen+4 {
+		return nil, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "PROXY v2 header addresses too short")
+	}
+
+	ip := net.IP(append([]byte{}, data[:ipLen]...))
+	port := binary.BigEndian.Uint16(data[2*ipLen : 2*ipLen+2])
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -40,7 +40,7 @@ type challengeLibrary struct {
 //
 // Accepts requests on config.MshHost, config.MshPortQuery
 func HandlerQuery() {
-	connCli, err := net.ListenPacket("udp", fmt.Sprintf("%s:%d", config.MshHost, config.MshPortQuery))
+	connCli, err := net.ListenPacket("udp", net.JoinHostPort(config.MshHost, strconv.Itoa(config.MshPortQuery)))
 	if err != nil {
 		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
 		return
@@ -134,7 +134,7 @@ func handleRequest(connCli net.PacketConn, addr net.Addr, reqClient []byte) *err
 // Returns the stats data already adapted for the client response.
 func statsGet(reqClient []byte) ([]byte, *errco.MshLog) {
 	// Dial the server using a UDP connection
-	conn, err := net.Dial("udp", fmt.Sprintf("%s:%d", config.ServHost, config.ServPortQuery))
+	conn, err := net.Dial("udp", net.JoinHostPort(config.ServHost, strconv.Itoa(config.ServPortQuery)))
 	if err != nil {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
 	}
@@ -202,14 +202,14 @@ func statsGet(reqClient []byte) ([]byte, *errco.MshLog) {
 
 // statsRespBase writes a base stats response to client
 func statsRespBase(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
-	levelName, _ := config.ConfigRuntime.ParsePropertiesString("level-name")
+	levelName, _ := config.ConfigRuntime().ParsePropertiesString("level-name")
 	mshPortSmallEndian := utility.Reverse(big.NewInt(int64(config.MshPort)).Bytes())
 	var motd string
 	switch {
-	case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE || servstats.Stats.Suspended:
-		motd = config.ConfigRuntime.Msh.InfoHibernation
+	case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE || servstats.Stats.Suspended || servstats.Stats.SoftStopped:
+		motd = config.ResolvePlaceholders(config.ConfigRuntime().Msh.InfoHibernation)
 	case servstats.Stats.Status == errco.SERVER_STATUS_STARTING:
-		motd = config.ConfigRuntime.Msh.InfoStarting
+		motd = config.ResolvePlaceholders(config.ConfigRuntime().Msh.InfoStarting)
 	case servstats.Stats.Status == errco.SERVER_STATUS_ONLINE:
 		// server can't be online if this function was called
 	case servstats.Stats.Status == errco.SERVER_STATUS_STOPPING:
@@ -223,7 +223,7 @@ func statsRespBase(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
 	buf.WriteString("SMP\x00")                                       // gametype hardcoded (default)
 	buf.WriteString(fmt.Sprintf("%s\x00", levelName))                // map
 	buf.WriteString("0\x00")                                         // numplayers hardcoded
-	buf.WriteString("0\x00")                                         // maxplayers hardcoded
+	buf.WriteString(fmt.Sprintf("%d\x00", config.ServMaxPlayers))    // maxplayers
 	buf.Write(append(mshPortSmallEndian, byte(0)))                   // hostport
 	buf.WriteString(fmt.Sprintf("%s\x00", utility.GetOutboundIP4())) // hostip
 
@@ -236,13 +236,13 @@ func statsRespBase(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
 
 // statsRespFull writes a full stats response to client
 func statsRespFull(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
-	levelName, _ := config.ConfigRuntime.ParsePropertiesString("level-name")
+	levelName, _ := config.ConfigRuntime().ParsePropertiesString("level-name")
 	var motd string
 	switch {
-	case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE || servstats.Stats.Suspended:
-		motd = config.ConfigRuntime.Msh.InfoHibernation
+	case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE || servstats.Stats.Suspended || servstats.Stats.SoftStopped:
+		motd = config.ResolvePlaceholders(config.ConfigRuntime().Msh.InfoHibernation)
 	case servstats.Stats.Status == errco.SERVER_STATUS_STARTING:
-		motd = config.ConfigRuntime.Msh.InfoStarting
+		motd = config.ResolvePlaceholders(config.ConfigRuntime().Msh.InfoStarting)
 	case servstats.Stats.Status == errco.SERVER_STATUS_ONLINE:
 		// server can't be online if this function was called
 	case servstats.Stats.Status == errco.SERVER_STATUS_STOPPING:
@@ -258,11 +258,11 @@ func statsRespFull(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
 	buf.WriteString(fmt.Sprintf("hostname\x00%s\x00", motd))
 	buf.WriteString(fmt.Sprintf("gametype\x00%s\x00", "SMP"))      // hardcoded (default)
 	buf.WriteString(fmt.Sprintf("game_id\x00%s\x00", "MINECRAFT")) // hardcoded (default)
-	buf.WriteString(fmt.Sprintf("version\x00%s\x00", config.ConfigRuntime.Server.Version))
-	buf.WriteString(fmt.Sprintf("plugins\x00msh/%s: msh %s\x00", config.ConfigRuntime.Server.Version, progmgr.MshVersion)) // example: "plugins\x00{ServerVersion}: {Name} {Version}; {Name} {Version}\x00"
+	buf.WriteString(fmt.Sprintf("version\x00%s\x00", config.ConfigRuntime().Server.Version))
+	buf.WriteString(fmt.Sprintf("plugins\x00msh/%s: msh %s\x00", config.ConfigRuntime().Server.Version, progmgr.MshVersion)) // example: "plugins\x00{ServerVersion}: {Name} {Version}; {Name} {Version}\x00"
 	buf.WriteString(fmt.Sprintf("map\x00%s\x00", levelName))
 	buf.WriteString("numplayers\x000\x00") // hardcoded
-	buf.WriteString("maxplayers\x000\x00") // hardcoded
+	buf.WriteString(fmt.Sprintf("maxplayers\x00%d\x00", config.ServMaxPlayers))
 	buf.WriteString(fmt.Sprintf("hostport\x00%d\x00", config.MshPort))
 	buf.WriteString(fmt.Sprintf("hostip\x00%s\x00", utility.GetOutboundIP4()))
 	buf.WriteByte(0) // termination of section (?)
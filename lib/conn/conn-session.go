@@ -0,0 +1,78 @@
+package conn
+
+import (
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/utility"
+)
+
+// session contains the data of a client JOIN session reported by the session summary
+type session struct {
+	traceID  string
+	player   string // player name ("" if unknown)
+	address  string
+	start    time.Time
+	bytesIn  int64 // client --> server bytes (atomic)
+	bytesOut int64 // server --> client bytes (atomic)
+	woke     bool  // the session warmed ms
+}
+
+// newSession returns a new session.
+// Returns nil if session summary is disabled.
+func newSession(traceID, player, address string, woke bool) *session {
+	if config.ConfigRuntime().Msh.SessionSummaryLevel < 0 {
+		return nil
+	}
+
+	return &session{
+		traceID: traceID,
+		player:  player,
+		address: address,
+		start:   time.Now(),
+		woke:    woke,
+	}
+}
+
+// add records bytes exchanged in the session (nil session is a no-op)
+func (s *session) add(isServerToClient bool, n int) {
+	if s == nil {
+		return
+	}
+	if isServerToClient {
+		atomic.AddInt64(&s.bytesOut, int64(n))
+	} else {
+		atomic.AddInt64(&s.bytesIn, int64(n))
+	}
+}
+
+// summary logs a one-line summary of the session (nil session is a no-op).
+//
+// reason is the disconnect reason (client, server, kicked, idle, timeout).
+func (s *session) summary(reason string) {
+	if s == nil {
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LogLvl(config.ConfigRuntime().Msh.SessionSummaryLevel), errco.ERROR_NIL,
+		"[%s] session summary: player=%s ip=%s duration=%ds in=%dB out=%dB reason=%s wake=%t",
+		s.traceID, playerOrUnknown(s.player), s.address, utility.RoundSec(time.Since(s.start)), atomic.LoadInt64(&s.bytesIn), atomic.LoadInt64(&s.bytesOut), reason, s.woke)
+}
+
+// sessionReason returns the session disconnect reason from the proxy closure cause
+func sessionReason(cause string, idleKicked bool) string {
+	switch {
+	case idleKicked:
+		return "idle"
+	case cause == "closed by client":
+		return "client"
+	case cause == "closed by server":
+		return "server"
+	case cause == "timeout":
+		return "timeout"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,224 @@
+package conn
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+const (
+	waitPollInterval      = time.Second     // interval at which ms readiness is checked while a client is held
+	waitKeepAliveInterval = 5 * time.Second // interval at which a held client is sent a keep-alive
+	waitHandoffTimeout    = 3 * time.Second // max time to wait for pending client keep-alive responses before proxying
+	waitKeepAliveProtocol = 393             // first protocol (1.13) supporting login plugin requests
+	waitKeepAliveChannel  = "msh:wait"      // channel of the login plugin requests used as keep-alive
+)
+
+// infoShuttingDown is the text sent to held clients when msh is exiting
+const infoShuttingDown = "minecraft server is shutting down"
+
+// login state packet ids
+const (
+	loginPluginRequestId  = 0x04 // server --> client
+	loginPluginResponseId = 0x02 // client --> server
+)
+
+// holdJoin holds a JOIN client while ms is starting, until ms responds to a status request
+// or StartupJoinTimeout expires.
+//
+// While the client is held, a login plugin request is sent to it every waitKeepAliveInterval
+// (1.13+ clients) so that it does not time out. Its responses are not forwarded to ms.
+//
+// Returns the data to forward to ms (reqPacket followed by the client packets received while held)
+// and true if ms is ready. If false is returned the client was disconnected or it left.
+//
+// If the last held client leaves while ms is starting, the ms start is canceled (if CancelStartIfEmpty is enabled).
+// If msh is exiting (ms start aborted), the client is disconnected with a shutting down text.
+//
+// [blocking]
+func holdJoin(clientConn net.Conn, reqPacket []byte, protocol int, traceID string) ([]byte, bool) {
+	left := false // the client left while ms was starting
+	servctrl.HoldClient()
+	defer func() {
+		if servctrl.ReleaseClient() == 0 && left {
+			go servctrl.CancelStartIfEmpty()
+		}
+	}()
+
+	timeout := time.Duration(config.ConfigRuntime().Msh.StartupJoinTimeout) * time.Second
+	deadline := time.Now().Add(timeout)
+
+	// keep-alives can be sent only after the login start packet (which follows the handshake)
+	packets, _ := splitPackets(reqPacket)
+	loginStarted := len(packets) >= 2
+
+	var pending []byte          // client data received while held
+	var sent, received int      // keep-alives sent and responses received
+	var lastKeepAlive time.Time // time of the last keep-alive sent
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] holding client until minecraft server is ready (max %s)", traceID, timeout)
+
+	for !servctrl.ServReady() {
+		// ms start aborted (msh is exiting), failed or is taking too long
+		if servctrl.StartAborted() || servstats.Stats.MajorError != nil || servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE || time.Now().After(deadline) {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] minecraft server not ready, releasing held client", traceID)
+
+			// msh JOIN response (answer client with text in the loadscreen)
+			info := config.ConfigRuntime().Msh.InfoStarting
+			if config.ConfigRuntime().Msh.InfoStartingProgress {
+				info += " §7" + servstats.Stats.LoadProgress
+			}
+			if servctrl.StartAborted() {
+				info = infoShuttingDown
+			}
+			mes := buildMessage(errco.CLIENT_REQ_JOIN, config.ResolvePlaceholders(info))
+			clientConn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			clientConn.Write(mes)
+			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+			return nil, false
+		}
+
+		// keep the client connection alive
+		if loginStarted && protocol >= waitKeepAliveProtocol && time.Since(lastKeepAlive) >= waitKeepAliveInterval {
+			sent++
+			mes := buildLoginPluginRequest(sent, waitKeepAliveChannel)
+			clientConn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if _, err := clientConn.Write(mes); err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_WRITE, "[%s] held client left: %s", traceID, err.Error())
+				left = true
+				return nil, false
+			}
+			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+			lastKeepAlive = time.Now()
+		}
+
+		data, err := readHeld(clientConn, waitPollInterval)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_READ, "[%s] held client left: %s", traceID, err.Error())
+			left = true
+			return nil, false
+		}
+		pending = append(pending, data...)
+
+		packets, _ = splitPackets(pending)
+		loginStarted = loginStarted || len(packets) > 0
+	}
+
+	// wait for the keep-alive responses still in flight and for the last packet to be complete:
+	// forwarding them to ms would corrupt the login
+	handoffDeadline := time.Now().Add(waitHandoffTimeout)
+	packets, rest := splitPackets(pending)
+	for {
+		received = countPluginResponses(packets)
+		if (received >= sent && len(rest) == 0) || time.Now().After(handoffDeadline) {
+			break
+		}
+
+		data, err := readHeld(clientConn, time.Until(handoffDeadline))
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_READ, "[%s] held client left: %s", traceID, err.Error())
+			return nil, false
+		}
+		pending = append(pending, data...)
+		packets, rest = splitPackets(pending)
+	}
+	if received < sent {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "[%s] %d keep-alive responses not received from held client", traceID, sent-received)
+	}
+
+	// reset deadlines set while the client was held
+	clientConn.SetDeadline(time.Time{})
+
+	forward := append([]byte{}, reqPacket...)
+	for _, p := range packets {
+		if packetId(p) != loginPluginResponseId {
+			forward = append(forward, p...)
+		}
+	}
+	forward = append(forward, rest...)
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] minecraft server is ready, proxying held client", traceID)
+
+	return forward, true
+}
+
+// readHeld reads data from a held client waiting at most timeout.
+// A read timeout is not an error (nil data is returned).
+func readHeld(clientConn net.Conn, timeout time.Duration) ([]byte, error) {
+	buf := make([]byte, 1024)
+
+	clientConn.SetReadDeadline(time.Now().Add(timeout))
+	n, err := clientConn.Read(buf)
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, err
+	}
+
+	if n > 0 {
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%sclient --> msh%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, buf[:n])
+	}
+
+	return buf[:n], nil
+}
+
+// buildLoginPluginRequest builds a login plugin request packet with no data.
+//
+// scheme:  [ length | packet id (4) | message id | channel length | channel ]
+// type:    [ VarInt | VarInt        | VarInt     | VarInt         | string  ]
+func buildLoginPluginRequest(messageId int, channel string) []byte {
+	body := append([]byte{loginPluginRequestId}, writeVarInt(messageId)...)
+	body = append(body, writeVarInt(len(channel))...)
+	body = append(body, channel...)
+
+	return append(writeVarInt(len(body)), body...)
+}
+
+// splitPackets splits data into complete length-prefixed packets.
+// The trailing bytes of an incomplete packet are returned as rest.
+func splitPackets(data []byte) ([][]byte, []byte) {
+	var packets [][]byte
+
+	i := 0
+	for i < len(data) {
+		length, j, ok := readVarInt(data, i)
+		if !ok || j+length > len(data) {
+			break
+		}
+		packets = append(packets, data[i:j+length])
+		i = j + length
+	}
+
+	return packets, data[i:]
+}
+
+// packetId returns the id of a complete length-prefixed packet (-1 if it can't be parsed)
+func packetId(packet []byte) int {
+	_, i, ok := readVarInt(packet, 0)
+	if !ok {
+		return -1
+	}
+
+	id, _, ok := readVarInt(packet, i)
+	if !ok {
+		return -1
+	}
+
+	return id
+}
+
+// countPluginResponses returns the number of login plugin response packets
+func countPluginResponses(packets [][]byte) int {
+	n := 0
+	for _, p := range packets {
+		if packetId(p) == loginPluginResponseId {
+			n++
+		}
+	}
+	return n
+}
@@ -1,15 +1,21 @@
 package conn
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/servctrl"
 	"msh/lib/servstats"
+	"msh/lib/utility"
 )
 
 func init() {
@@ -21,31 +27,113 @@ func init() {
 // If there is a ms major error, it is reported to client then func returns.
 // [goroutine]
 func HandlerClientConn(clientConn net.Conn) {
+	// recover the real client address from the load balancer PROXY header
+	if config.ConfigRuntime().Msh.AcceptProxyProtocol {
+		proxied, logMsh := readProxyHeader(clientConn)
+		if logMsh != nil {
+			logMsh.Log(true)
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROXY_HEADER, "dropping connection from %s: invalid PROXY header", clientConn.RemoteAddr().String())
+			clientConn.Close()
+			return
+		}
+		clientConn = proxied
+	}
+
 	// handling of ipv6 addresses
 	li := strings.LastIndex(clientConn.RemoteAddr().String(), ":")
 	clientAddress := clientConn.RemoteAddr().String()[:li]
 
+	// trace id used to correlate all log lines of this connection
+	traceID := newTraceID()
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] new connection from %s", traceID, clientAddress)
+
+	// drop connections from ips exceeding the connection rate limit
+	// (before reading the request so that they can't warm ms)
+	if allowed, log := allowRate(clientAddress); !allowed {
+		if log {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_REQ, "[%s] connections from %s dropped: max connections per minute (%d) exceeded", traceID, clientAddress, config.ConfigRuntime().Msh.MaxConnsPerMinute)
+		}
+		clientConn.Close()
+		return
+	}
+
 	// get request type from client
 	reqPacket, reqType, logMsh := getReqType(clientConn)
 	if logMsh != nil {
 		logMsh.Log(true)
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "[%s] could not get request type from %s", traceID, clientAddress)
+		clientConn.Close()
 		return
 	}
 
+	// http requests are not minecraft protocol: respond (if enabled) and close quietly
+	if reqType == errco.CLIENT_REQ_HTTP {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] http request received from %s, closing connection", traceID, clientAddress)
+		if mes := buildHttpResponse(config.ConfigRuntime().Msh.HttpOnMcPortResponse); mes != nil {
+			clientConn.Write(mes)
+			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+		}
+		clientConn.Close()
+		return
+	}
+
+	// legacy ping is handled separately as it has no handshake
+	if reqType == errco.CLIENT_REQ_LEGACY {
+		handleLegacyPing(clientConn, reqPacket, traceID)
+		return
+	}
+
+	// log handshake fields for diagnostics
+	// (target port different from msh port might be caused by SRV records or wrong client settings)
+	var player string
+	var clientProtocol int = -1
+	if h, logMsh := parseHandshake(reqPacket); logMsh != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "[%s] %s", traceID, logMsh.Mex)
+	} else {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] handshake: protocol %d, target %s:%d, next state %d", traceID, h.protocol, h.address, h.port, h.nextState)
+		player = h.player
+		clientProtocol = h.protocol
+	}
+
+	// limit concurrent connections from the same ip
+	clientConn, ok := acquireIp(clientConn, clientAddress)
+	if !ok {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "[%s] connection from %s refused: max connections per ip (%d) reached", traceID, clientAddress, config.ConfigRuntime().Msh.MaxConnectionsPerIp)
+
+		// msh JOIN response (warn client with text in the loadscreen)
+		if reqType == errco.CLIENT_REQ_JOIN {
+			mes := buildMessage(reqType, "Too many connections from your address")
+			clientConn.Write(mes)
+			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+		}
+		clientConn.Close()
+
+		return
+	}
+
+	// release the ip slot on every return, unless the client connection was handed over to the proxy
+	// (the proxy closes it when the client or ms disconnects)
+	var proxied bool
+	defer func() {
+		if !proxied {
+			clientConn.Close()
+		}
+	}()
+
 	// if there is a major error warn the client and return
 	if servstats.Stats.MajorError != nil {
-		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "a client connected to msh (%s:%d to %s:%d) but minecraft server has encountered major problems", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "[%s] a client connected to msh (%s:%d to %s:%d) but minecraft server has encountered major problems", traceID, clientAddress, config.MshPort, config.ServHost, config.ServPort)
 
 		// close the client connection before returning
 		defer func() {
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "closing connection for: %s", clientAddress)
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] closing connection for: %s", traceID, clientAddress)
 			clientConn.Close()
 		}()
 
 		// msh INFO/JOIN response (warn client with error description)
 		mes := buildMessage(reqType, fmt.Sprintf(servstats.Stats.MajorError.Mex, servstats.Stats.MajorError.Arg...))
 		clientConn.Write(mes)
-		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
 		// msh PING response if it was a client INFO request
 		if reqType == errco.CLIENT_REQ_INFO {
@@ -61,14 +149,14 @@ func HandlerClientConn(clientConn net.Conn) {
 	// handle the request depending on request type
 	switch reqType {
 	case errco.CLIENT_REQ_INFO:
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client requested server info from %s:%d to %s:%d", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] a client requested server info from %s:%d to %s:%d", traceID, clientAddress, config.MshPort, config.ServHost, config.ServPort)
 
-		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.Suspended {
-			// ms not online or suspended
+		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.Suspended || servstats.Stats.SoftStopped {
+			// ms not online or suspended/soft stopped
 
 			defer func() {
 				// close the client connection before returning
-				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "closing connection for: %s", clientAddress)
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] closing connection for: %s", traceID, clientAddress)
 				clientConn.Close()
 			}()
 
@@ -76,16 +164,20 @@ func HandlerClientConn(clientConn net.Conn) {
 			var mes []byte
 			switch servstats.Stats.Status {
 			case errco.SERVER_STATUS_OFFLINE:
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoHibernation)
+				mes = buildInfoMessage(config.ConfigRuntime().Msh.InfoHibernation, clientProtocol)
 			case errco.SERVER_STATUS_STARTING:
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoStarting)
-			case errco.SERVER_STATUS_ONLINE: // ms suspended
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoHibernation)
+				if config.ConfigRuntime().Msh.InfoStartingProgress {
+					mes = buildInfoMessage(config.ConfigRuntime().Msh.InfoStarting+" §7"+servstats.Stats.LoadProgress, clientProtocol)
+				} else {
+					mes = buildInfoMessage(config.ConfigRuntime().Msh.InfoStarting, clientProtocol)
+				}
+			case errco.SERVER_STATUS_ONLINE: // ms suspended/soft stopped
+				mes = buildInfoMessage(config.ConfigRuntime().Msh.InfoHibernation, clientProtocol)
 			case errco.SERVER_STATUS_STOPPING:
-				mes = buildMessage(reqType, "server is stopping...\nrefresh the page")
+				mes = buildInfoMessage("server is stopping...\nrefresh the page", clientProtocol)
 			}
 			clientConn.Write(mes)
-			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
 			// msh PING response
 			logMsh := getPing(clientConn)
@@ -94,46 +186,153 @@ func HandlerClientConn(clientConn net.Conn) {
 				return
 			}
 
+		} else if len(config.ConfigRuntime().Msh.Ping.SampleOverride) > 0 || len(config.ConfigRuntime().Msh.Ping.SampleAppend) > 0 {
+			// ms online and not suspended, player sample rewrite enabled
+
+			defer func() {
+				// close the client connection before returning
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] closing connection for: %s", traceID, clientAddress)
+				clientConn.Close()
+			}()
+
+			// ms INFO response with rewritten player sample
+			logMsh := proxyStatusRewrite(clientConn, reqPacket, traceID)
+			if logMsh != nil {
+				logMsh.Log(true)
+				return
+			}
+
+			// msh PING response
+			logMsh = getPing(clientConn)
+			if logMsh != nil {
+				logMsh.Log(true)
+				return
+			}
+
 		} else {
 			// ms online and not suspended
 
 			// open proxy between client and server
-			openProxy(clientConn, reqPacket, errco.CLIENT_REQ_INFO)
+			proxied = openProxy(clientConn, reqPacket, errco.CLIENT_REQ_INFO, traceID, player, nil)
 		}
 
 	case errco.CLIENT_REQ_JOIN:
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client tried to join from %s:%d to %s:%d", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] a client tried to join from %s:%d to %s:%d", traceID, clientAddress, config.MshPort, config.ServHost, config.ServPort)
 
 		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
 			// ms not online (un/suspended)
 
 			defer func() {
+				if proxied {
+					return
+				}
+
 				// close the client connection before returning
-				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "closing connection for: %s", clientAddress)
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] closing connection for: %s", traceID, clientAddress)
 				clientConn.Close()
 			}()
 
+			// check if the client address is allowed to warm ms
+			if !config.IpWakeAllowed(clientAddress) {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_REQ, "[%s] warm denied to %s by AllowedIPs/BlockedIPs", traceID, clientAddress)
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				mes := buildMessage(reqType, config.ConfigRuntime().Msh.WakeDeniedMessage)
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+				return
+			}
+
 			// check if the request packet contains element of whitelist or the address is in whitelist
-			logMsh := config.ConfigRuntime.IsWhitelist(reqPacket, clientAddress)
+			logMsh := config.ConfigRuntime().IsWhitelist(reqPacket, clientAddress)
 			if logMsh != nil {
 				logMsh.Log(true)
 
 				// msh JOIN response (warn client with text in the loadscreen)
 				mes := buildMessage(reqType, "You don't have permission to warm this server")
 				clientConn.Write(mes)
-				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+				return
+			}
+
+			// check if the player is in minecraft server whitelist.json (if enabled)
+			if !config.ConfigRuntime().WakeWhitelisted(player) {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_REQ, "[%s] warm denied to %s by minecraft server whitelist", traceID, playerOrUnknown(player))
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				mes := buildMessage(reqType, config.ConfigRuntime().Msh.WhitelistKickMessage)
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+				return
+			}
+
+			// don't warm ms outside schedule windows (if refused by config)
+			if config.ConfigRuntime().Msh.Schedule.RefuseWake && !config.ConfigRuntime().ScheduleAllowed(time.Now()) {
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] minecraft server is outside schedule windows, warm rejected", traceID)
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				mes := buildMessage(reqType, config.ConfigRuntime().Msh.Schedule.KickMessage)
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+				return
+			}
+
+			// don't warm ms while the post-stop command of the last run is running
+			if servctrl.PostStopRunning() {
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] minecraft server post-stop command is running, warm rejected", traceID)
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				mes := buildMessage(reqType, "Server is stopping, please retry in a few moments")
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+				return
+			}
+
+			// avoid a full stop/start cycle if ms hibernated just now
+			if wait := servctrl.HibernationCooldown(); wait > 0 {
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] minecraft server hibernated less than %ds ago, warm rejected", traceID, config.ConfigRuntime().Msh.MinHibernationSeconds)
+
+				// msh JOIN response (warn client with text in the loadscreen)
+				mes := buildMessage(reqType, fmt.Sprintf("Server just hibernated, please wait %ds", wait))
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
 				return
 			}
 
 			// issue warm
-			logMsh = servctrl.WarmMS()
+			logMsh = servctrl.WarmMSBy(playerOrUnknown(player))
 			if logMsh != nil {
 				// msh JOIN response (warn client with text in the loadscreen)
 				logMsh.Log(true)
 				mes := buildMessage(reqType, "An error occurred while warming the server: check the msh log")
 				clientConn.Write(mes)
-				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+				return
+			}
+
+			// hold the client while ms starts and proxy it to ms when ready (if enabled)
+			if config.ConfigRuntime().Msh.StartupJoinTimeout > 0 {
+				data, ready := holdJoin(clientConn, reqPacket, clientProtocol, traceID)
+				if !ready {
+					newSession(traceID, player, clientAddress, true).summary("kicked")
+					return
+				}
+
+				// rewrite client protocol if in the configured compatible range
+				data = rewriteProtocol(data, clientProtocol, traceID)
+
+				// welcome the player that waited for ms to start (if enabled)
+				go servctrl.JoinWelcome(player)
+
+				// open proxy between client and server
+				proxied = openProxy(clientConn, data, errco.CLIENT_REQ_JOIN, traceID, player, newSession(traceID, player, clientAddress, true))
 
 				return
 			}
@@ -141,61 +340,260 @@ func HandlerClientConn(clientConn net.Conn) {
 			// msh JOIN response (answer client with text in the loadscreen)
 			mes := buildMessage(reqType, "Server start command issued. Please wait... "+servstats.Stats.LoadProgress)
 			clientConn.Write(mes)
-			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+			// the client is disconnected by msh after warming ms
+			newSession(traceID, player, clientAddress, true).summary("kicked")
 
 		} else {
 			// ms online (un/suspended)
 
-			// issue warm
-			logMsh = servctrl.WarmMS()
+			// don't forward clients to a backend that is not a minecraft server
+			if servstats.Stats.BackendInvalid {
+				mes := buildMessage(reqType, "Server misconfigured: check the msh log")
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				clientConn.Close()
+
+				return
+			}
+
+			// issue warm (resumes ms if suspended/soft stopped)
+			woke := servstats.Stats.Suspended || servstats.Stats.SoftStopped
+
+			// don't resume ms outside schedule windows (if refused by config)
+			if woke && config.ConfigRuntime().Msh.Schedule.RefuseWake && !config.ConfigRuntime().ScheduleAllowed(time.Now()) {
+				mes := buildMessage(reqType, config.ConfigRuntime().Msh.Schedule.KickMessage)
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				clientConn.Close()
+
+				return
+			}
+
+			// don't resume ms for clients not allowed to warm it
+			if woke && !config.IpWakeAllowed(clientAddress) {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_REQ, "[%s] warm denied to %s by AllowedIPs/BlockedIPs", traceID, clientAddress)
+				mes := buildMessage(reqType, config.ConfigRuntime().Msh.WakeDeniedMessage)
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				clientConn.Close()
+
+				return
+			}
+
+			// don't resume ms for players not in minecraft server whitelist.json (if enabled)
+			if woke && !config.ConfigRuntime().WakeWhitelisted(player) {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CLIENT_REQ, "[%s] warm denied to %s by minecraft server whitelist", traceID, playerOrUnknown(player))
+				mes := buildMessage(reqType, config.ConfigRuntime().Msh.WhitelistKickMessage)
+				clientConn.Write(mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				clientConn.Close()
+
+				return
+			}
+
+			logMsh = servctrl.WarmMSBy(playerOrUnknown(player))
 			if logMsh != nil {
 				// msh JOIN response (warn client with text in the loadscreen)
 				logMsh.Log(true)
 				mes := buildMessage(reqType, "An error occurred while warming the server: check the msh log")
 				clientConn.Write(mes)
-				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+				clientConn.Close()
 
 				return
 			}
 
+			// rewrite client protocol if in the configured compatible range
+			reqPacket = rewriteProtocol(reqPacket, clientProtocol, traceID)
+
 			// open proxy between client and server
-			openProxy(clientConn, reqPacket, errco.CLIENT_REQ_JOIN)
+			proxied = openProxy(clientConn, reqPacket, errco.CLIENT_REQ_JOIN, traceID, player, newSession(traceID, player, clientAddress, woke))
 		}
 
 	default:
 		mes := buildMessage(reqType, "Client request unknown")
 		clientConn.Write(mes)
-		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+		clientConn.Close()
 	}
 }
 
+// handleLegacyPing responds to a legacy ping (1.6 and older clients).
+// If ms is online and not suspended, the legacy ping is forwarded to ms.
+func handleLegacyPing(clientConn net.Conn, reqPacket []byte, traceID string) {
+	li := strings.LastIndex(clientConn.RemoteAddr().String(), ":")
+	clientAddress := clientConn.RemoteAddr().String()[:li]
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] a client requested server info with legacy ping from %s:%d to %s:%d", traceID, clientAddress, config.MshPort, config.ServHost, config.ServPort)
+
+	if servstats.Stats.MajorError == nil && servstats.Stats.Status == errco.SERVER_STATUS_ONLINE && !servstats.Stats.Suspended && !servstats.Stats.SoftStopped {
+		// open proxy between client and server
+		openProxy(clientConn, reqPacket, errco.CLIENT_REQ_INFO, traceID, "", nil)
+		return
+	}
+
+	// close the client connection before returning
+	defer func() {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] closing connection for: %s", traceID, clientAddress)
+		clientConn.Close()
+	}()
+
+	if !config.ConfigRuntime().Msh.EnableLegacyPing {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "[%s] legacy ping response disabled", traceID)
+		return
+	}
+
+	var motd string
+	switch {
+	case servstats.Stats.MajorError != nil:
+		motd = fmt.Sprintf(servstats.Stats.MajorError.Mex, servstats.Stats.MajorError.Arg...)
+	case servstats.Stats.Status == errco.SERVER_STATUS_STARTING:
+		motd = config.ConfigRuntime().Msh.InfoStarting
+	case servstats.Stats.Status == errco.SERVER_STATUS_STOPPING:
+		motd = "server is stopping... refresh the page"
+	default: // ms offline or suspended
+		motd = config.ConfigRuntime().Msh.InfoHibernation
+	}
+
+	// msh legacy INFO response
+	mes := buildLegacyPing(legacyPingVariant(reqPacket), config.ResolvePlaceholders(motd), config.ConfigRuntime().Server.Version, config.ConfigRuntime().Server.Protocol, 0, config.ServMaxPlayers)
+	clientConn.Write(mes)
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+}
+
+// rewriteProtocol returns the request packet with the handshake protocol rewritten to Server.Protocol
+// if the client protocol is in ProtocolRewrite range.
+// Otherwise (or in case of error) the request packet is returned unchanged.
+func rewriteProtocol(reqPacket []byte, clientProtocol int, traceID string) []byte {
+	pr := config.ConfigRuntime().Msh.ProtocolRewrite
+	servProtocol := config.ConfigRuntime().Server.Protocol
+
+	if pr.MaxProtocol == 0 || clientProtocol < pr.MinProtocol || clientProtocol > pr.MaxProtocol || clientProtocol == servProtocol {
+		return reqPacket
+	}
+
+	rewritten, logMsh := rewriteHandshakeProtocol(reqPacket, servProtocol)
+	if logMsh != nil {
+		logMsh.Log(true)
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_2, errco.ERROR_CLIENT_REQ, "[%s] could not rewrite client protocol %d, forwarding handshake unchanged", traceID, clientProtocol)
+		return reqPacket
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "[%s] client protocol %d rewritten to %d in forwarded handshake", traceID, clientProtocol, servProtocol)
+
+	return rewritten
+}
+
 // openProxy opens a proxy connections between mincraft server and mincraft client.
 //
 // It sends the request packet for ms to interpret.
 //
 // The req parameter indicates what request type (INFO os JOIN) the proxy will be used for.
-func openProxy(clientConn net.Conn, serverInitPacket []byte, req int) {
+//
+// traceID is the trace id of the client connection.
+//
+// player is the name of the player joining ("" if unknown), used to kick the player if idle.
+//
+// sess is the JOIN session summarized when the proxy is closed (nil if not a JOIN or if session summary is disabled).
+//
+// Returns true if the proxy was opened (the client connection is closed by the proxy),
+// otherwise the client connection is closed before returning.
+func openProxy(clientConn net.Conn, serverInitPacket []byte, req int, traceID, player string, sess *session) bool {
 	// open a connection to ms and connect it with the client
-	serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", config.ServHost, config.ServPort))
+	serverSocket, err := dialServ(traceID)
 	if err != nil {
-		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, "[%s] %s", traceID, err.Error())
 
 		// msh JOIN response (warn client with text in the loadscreen)
 		mes := buildMessage(errco.CLIENT_REQ_JOIN, "can't connect to server... check if minecraft server is running and set the correct ServPort")
 		clientConn.Write(mes)
-		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
-		return
+		// the proxy is not opened: release the client connection (and its slots)
+		clientConn.Close()
+
+		return false
+	}
+
+	// forward the client address to ms (if ms accepts the PROXY protocol)
+	if config.ConfigRuntime().Msh.SendProxyProtocol {
+		serverSocket.Write(utility.ProxyHeader(clientConn.RemoteAddr(), serverSocket.RemoteAddr()))
 	}
 
 	// sends the request packet
 	serverSocket.Write(serverInitPacket)
 
+	// cause of the proxy closure, set by the first direction to be closed
+	closeCause := make(chan string, 1)
+
+	// track client activity to kick idle players (nil if disabled)
+	var idle *idleTracker
+	if req == errco.CLIENT_REQ_JOIN {
+		idle = newIdleTracker(clientConn, player, traceID)
+		if idle != nil {
+			go idle.watch()
+		}
+	}
+
 	// launch proxy client -> server
-	go forwardTCP(clientConn, serverSocket, false, req)
+	go forwardTCP(clientConn, serverSocket, false, req, traceID, closeCause, idle, sess)
 
 	// launch proxy server -> client
-	go forwardTCP(serverSocket, clientConn, true, req)
+	go forwardTCP(serverSocket, clientConn, true, req, traceID, closeCause, idle, sess)
+
+	return true
+}
+
+// proxyStatusRewrite requests the status response to ms and sends it to the client
+// after rewriting its player sample according to Msh.Ping.
+func proxyStatusRewrite(clientConn net.Conn, reqPacket []byte, traceID string) *errco.MshLog {
+	// forward only the client handshake followed by a status request
+	// (if the client status request was already received, the client ping is read later by getPing)
+	length, i, ok := readVarInt(reqPacket, 0)
+	if !ok || i+length > len(reqPacket) {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "[%s] handshake length could not be parsed", traceID)
+	}
+	serverReq := append(append([]byte{}, reqPacket[:i+length]...), 1, 0)
+
+	serverSocket, err := dialServ(traceID)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, "[%s] %s", traceID, err.Error())
+	}
+	defer serverSocket.Close()
+
+	if config.ConfigRuntime().Msh.SendProxyProtocol {
+		serverSocket.Write(utility.ProxyHeader(clientConn.RemoteAddr(), serverSocket.RemoteAddr()))
+	}
+
+	serverSocket.Write(serverReq)
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> server%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, serverReq)
+
+	// read the whole status response
+	serverSocket.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var data []byte
+	buf := make([]byte, 4096)
+	statusJSON, ok := parseStatusPacket(data)
+	for !ok {
+		n, err := serverSocket.Read(buf)
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_REQUEST_INFO, "[%s] %s", traceID, err.Error())
+		}
+		data = append(data, buf[:n]...)
+		statusJSON, ok = parseStatusPacket(data)
+	}
+
+	statusJSON, logMsh := rewriteStatusSample(statusJSON, config.ConfigRuntime().Msh.Ping.SampleOverride, config.ConfigRuntime().Msh.Ping.SampleAppend)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	mes := buildStatusPacket(statusJSON)
+	clientConn.Write(mes)
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %smsh --> client%s: %v", traceID, errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+	return nil
 }
 
 // forwardTCP takes a source and a destination net.Conn and forwards them.
@@ -204,8 +602,16 @@ func openProxy(clientConn net.Conn, serverInitPacket []byte, req int) {
 //
 // req is used to decide if connection should be counted in servstats.Stats.ConnCount
 //
+// traceID is the trace id of the client connection
+//
+// closeCause is shared by the 2 directions of the proxy to report which side caused the proxy closure
+//
+// idle is used to track client activity (nil if idle player kick is disabled)
+//
+// sess is used to count the session bytes and summarize it on closure (nil if disabled)
+//
 // [goroutine]
-func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
+func forwardTCP(source, destination net.Conn, isServerToClient bool, req int, traceID string, closeCause chan string, idle *idleTracker, sess *session) {
 	var data []byte = make([]byte, 1024)
 	var direction string
 
@@ -217,12 +623,21 @@ func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
 
 	// if client has requested ms join, change connection count
 	if isServerToClient && req == errco.CLIENT_REQ_JOIN { // isServerToClient used to count in only one of the 2 forwardTCP()
-		servstats.Stats.ConnCount++
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT CONNECTED TO THE SERVER! (join req) - %d active connections", servstats.Stats.ConnCount)
+		count := servstats.Stats.ConnAdd(1)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "[%s] A CLIENT CONNECTED TO THE SERVER! (join req) - %d active connections", traceID, count)
 
 		defer func() {
-			servstats.Stats.ConnCount--
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT DISCONNECTED FROM THE SERVER! (join req) - %d active connections", servstats.Stats.ConnCount)
+			cause := "unknown"
+			select {
+			case cause = <-closeCause:
+			default:
+			}
+
+			idle.stop()
+
+			count := servstats.Stats.ConnAdd(-1)
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "[%s] A CLIENT DISCONNECTED FROM THE SERVER! (join req, %s) - %d active connections", traceID, cause, count)
+			sess.summary(sessionReason(cause, idle.isKicked()))
 
 			servctrl.FreezeMSSchedule()
 		}()
@@ -236,7 +651,10 @@ func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
 		// read data from source
 		dataLen, err := source.Read(data)
 		if err != nil {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_EOF, "closing %15s --> %15s | %s (cause: %s)", strings.Split(source.RemoteAddr().String(), ":")[0], strings.Split(destination.RemoteAddr().String(), ":")[0], direction, err.Error())
+			// source side closed the connection
+			cause := connCloseCause(isServerToClient, err)
+			reportConnClose(closeCause, cause)
+			logConnClose(errco.ERROR_CONN_EOF, source, destination, direction, cause, err, traceID)
 
 			// close the source/destination connections
 			_ = destination.Close()
@@ -247,7 +665,10 @@ func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
 		// write data to destination
 		_, err = destination.Write(data[:dataLen])
 		if err != nil {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_WRITE, "closing %15s --> %15s | %s (cause: %s)", strings.Split(source.RemoteAddr().String(), ":")[0], strings.Split(destination.RemoteAddr().String(), ":")[0], direction, err.Error())
+			// destination side closed the connection
+			cause := connCloseCause(!isServerToClient, err)
+			reportConnClose(closeCause, cause)
+			logConnClose(errco.ERROR_CONN_WRITE, source, destination, direction, cause, err, traceID)
 
 			// close the source/destination connections
 			_ = destination.Close()
@@ -255,9 +676,22 @@ func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
 			return
 		}
 
+		// record client activity
+		if !isServerToClient {
+			idle.add(dataLen)
+		}
+		sess.add(isServerToClient, dataLen)
+
+		// count total bytes proxied
+		if isServerToClient {
+			atomic.AddInt64(&servstats.Stats.BytesToClientsTotal, int64(dataLen))
+		} else {
+			atomic.AddInt64(&servstats.Stats.BytesToServerTotal, int64(dataLen))
+		}
+
 		// calculate bytes/s to client/server
-		if config.ConfigRuntime.Msh.ShowInternetUsage && errco.DebugLvl >= errco.LVL_3 {
-			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%s%s%s: %v", errco.COLOR_PURPLE, direction, errco.COLOR_RESET, data[:dataLen])
+		if config.ConfigRuntime().Msh.ShowInternetUsage && errco.DebugLvl >= errco.LVL_3 {
+			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "[%s] %s%s%s: %v", traceID, errco.COLOR_PURPLE, direction, errco.COLOR_RESET, data[:dataLen])
 
 			servstats.Stats.M.Lock()
 			if isServerToClient {
@@ -270,6 +704,48 @@ func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
 	}
 }
 
+// connCloseCause returns which side caused the closure of a connection.
+//
+// isServer indicates if the side that returned err is the minecraft server.
+func connCloseCause(isServer bool, err error) string {
+	switch {
+	case errors.Is(err, net.ErrClosed):
+		// connections already closed by the forwardTCP of the opposite direction
+		return "closed by msh"
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case isServer:
+		return "closed by server"
+	default:
+		return "closed by client"
+	}
+}
+
+// reportConnClose communicates the proxy closure cause to closeCause.
+// Only the first closure cause (not caused by msh) is kept.
+func reportConnClose(closeCause chan string, cause string) {
+	if cause == "closed by msh" {
+		return
+	}
+
+	// must be a non-blocking select as the cause might already be set
+	select {
+	case closeCause <- cause:
+	default:
+	}
+}
+
+// logConnClose logs the closure of a forwardTCP direction.
+// Closures caused by msh tearing down the opposite direction are expected and logged as info.
+func logConnClose(cod errco.LogCod, source, destination net.Conn, direction, cause string, err error, traceID string) {
+	typ, lvl := errco.TYPE_WAR, errco.LVL_3
+	if cause == "closed by msh" {
+		typ, lvl, cod = errco.TYPE_INF, errco.LVL_4, errco.ERROR_NIL
+	}
+
+	errco.NewLogln(typ, lvl, cod, "[%s] closing %15s --> %15s | %s | %s (err: %s)", traceID, strings.Split(source.RemoteAddr().String(), ":")[0], strings.Split(destination.RemoteAddr().String(), ":")[0], direction, cause, err.Error())
+}
+
 // printDataUsage prints connection data (KB/s) to clients and to minecraft server.
 //
 // Prints data exchanged only when clients are connected to ms.
@@ -282,7 +758,7 @@ func printDataUsage() {
 	for {
 		<-ticker.C
 
-		if !config.ConfigRuntime.Msh.ShowInternetUsage {
+		if !config.ConfigRuntime().Msh.ShowInternetUsage {
 			continue
 		}
 
@@ -295,3 +771,18 @@ func printDataUsage() {
 		}
 	}
 }
+
+// playerOrUnknown returns the player name or "unknown player" if the player name is unknown
+func playerOrUnknown(player string) string {
+	if player == "" {
+		return "unknown player"
+	}
+	return player
+}
+
+// newTraceID returns a short random id used to correlate the log lines of a connection
+func newTraceID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b) // on error the trace id is zeroed, acceptable for logging purposes
+	return hex.EncodeToString(b)
+}
@@ -1,5 +1,7 @@
 package errco
 
+import "fmt"
+
 /*
 0xxxfxxx: error
 
@@ -13,6 +15,7 @@ package errco
 0x07xxxx: input package
 0x08xxxx: errco package
 0x09xxxx: servstats package
+0x0axxxx: notification package
 */
 
 // -------------------- log -------------------- //
@@ -58,6 +61,8 @@ const (
 	CLIENT_REQ_UNKN     = 0x020000 // client request unknown
 	CLIENT_REQ_INFO     = 0x020001 // client request server info
 	CLIENT_REQ_JOIN     = 0x020002 // client request server join
+	CLIENT_REQ_LEGACY   = 0x020003 // client request server info with legacy ping (1.6 and older)
+	CLIENT_REQ_HTTP     = 0x020004 // client request is http (not minecraft protocol)
 	MESSAGE_FORMAT_TXT  = 0x020103 // message to client should be built as TXT
 	MESSAGE_FORMAT_INFO = 0x020104 // message to client should be built as INFO
 )
@@ -87,19 +92,36 @@ const (
 	ERROR_SERVER_OFFLINE_SUSPENDED LogCod = 0x00f20a // minecraft server is offline but not suspended
 	ERROR_SERVER_STOPPING          LogCod = 0x00f20b // minecraft server is stopping
 	ERROR_SERVER_UNRESPONDING      LogCod = 0x00f20c // minecraft server is not responding
+	ERROR_SERVER_SOFT_STOPPED      LogCod = 0x00f20d // minecraft server is soft stopped
+	ERROR_SERVER_SOFT_START        LogCod = 0x00f20e // minecraft server soft start failed
 	ERROR_PIPE_INPUT_WRITE         LogCod = 0x00f300 // terminal input writing error
 	ERROR_PIPE_LOAD                LogCod = 0x00f301 // terminal pipe load error
 	ERROR_CONVERSION               LogCod = 0x00f400 // variable conversion error
 	ERROR_WRONG_CONNECTION_COUNT   LogCod = 0x00f500 // connection count does not correspond to ms player count
+	ERROR_PLAYER_HOOK              LogCod = 0x00f600 // error while executing player join/leave hook
+	ERROR_DEPENDENCY               LogCod = 0x00f700 // error while starting/stopping a dependency
+	ERROR_READY_COMMAND            LogCod = 0x00f800 // error while running minecraft server ready command
+	ERROR_CONSOLE_TRIGGER          LogCod = 0x00f900 // error while executing a console trigger
+	ERROR_BACKEND_INVALID          LogCod = 0x00fa00 // minecraft server port does not speak the minecraft protocol
+	ERROR_SERVER_OOM               LogCod = 0x00fb00 // minecraft server ran out of memory
+	ERROR_SERVER_CRASH             LogCod = 0x00fb01 // minecraft server exited without a stop request
+	ERROR_DOCKER                   LogCod = 0x00fc00 // error while controlling the minecraft server docker container
+	ERROR_RCON                     LogCod = 0x00fd00 // error while executing a command through rcon
+	ERROR_HOOK_COMMAND             LogCod = 0x00fe00 // error while executing the pre-start/post-stop command
 
 	// program manager package
 
-	ERROR_VERSION         LogCod = 0x01f000 // check update error
-	ERROR_VERSION_INVALID LogCod = 0x01f001 // version format is invalid
-	ERROR_GET_CORES       LogCod = 0x01f100 // error getting system cores count
-	ERROR_GET_CPU_INFO    LogCod = 0x01f101 // error getting cpu info
-	ERROR_GET_MEMORY      LogCod = 0x01f102 // error getting system memory info
-	ERROR_BODY_READ       LogCod = 0x01f200 // error reading a body response
+	ERROR_VERSION          LogCod = 0x01f000 // check update error
+	ERROR_VERSION_INVALID  LogCod = 0x01f001 // version format is invalid
+	ERROR_GET_CORES        LogCod = 0x01f100 // error getting system cores count
+	ERROR_GET_CPU_INFO     LogCod = 0x01f101 // error getting cpu info
+	ERROR_GET_MEMORY       LogCod = 0x01f102 // error getting system memory info
+	ERROR_BODY_READ        LogCod = 0x01f200 // error reading a body response
+	ERROR_STATS_FILE       LogCod = 0x01f300 // error writing stats snapshot file
+	ERROR_METRICS_PUSH     LogCod = 0x01f400 // error pushing metrics to pushgateway
+	ERROR_METRICS_SERVE    LogCod = 0x01f401 // error serving metrics
+	ERROR_API_SERVE        LogCod = 0x01f500 // error serving the control api
+	ERROR_API_UNAUTHORIZED LogCod = 0x01f501 // unauthorized control api request
 
 	// server connection package
 
@@ -116,6 +138,8 @@ const (
 	ERROR_QUERY_CHALLENGE     LogCod = 0x02f401 // error caused by query challenge
 	ERROR_QUERY_BAD_REQUEST   LogCod = 0x02f402 // error caused by query request
 	ERROR_PING_PACKET_UNKNOWN LogCod = 0x02f500 // error ping packet received is unknown
+	ERROR_IDLE_KICK           LogCod = 0x02f600 // error while warning/kicking an idle player
+	ERROR_PROXY_HEADER        LogCod = 0x02f700 // error while reading the PROXY protocol header
 
 	// config package
 
@@ -123,6 +147,8 @@ const (
 	ERROR_CONFIG_SAVE      LogCod = 0x03f001 // error while saving config to file
 	ERROR_CONFIG_CHECK     LogCod = 0x03f002 // error while checking config
 	ERROR_CONFIG_MSHID     LogCod = 0x03f003 // error while managing msh id
+	ERROR_CONFIG_LOCK      LogCod = 0x03f004 // error while managing msh lock file
+	ERROR_CONFIG_PERSIST   LogCod = 0x03f005 // error while writing msh config/state files
 	ERROR_ICON_LOAD        LogCod = 0x03f100 // error while loading icon
 	ERROR_VERSION_LOAD     LogCod = 0x03f101 // error while loading version.json from server JAR
 	ERROR_WHITELIST_CHECK  LogCod = 0x03f200 // error while checking whitelist
@@ -143,6 +169,9 @@ const (
 	ERROR_PROCESS_LIST            LogCod = 0x04f401 // error processes running not found
 	ERROR_PROCESS_KILL            LogCod = 0x04f402 // error process kill
 	ERROR_PROCESS_TIME            LogCod = 0x04f500 // error while retrieving process time
+	ERROR_PROCESS_AFFINITY        LogCod = 0x04f600 // error while setting process cpu affinity
+	ERROR_PROCESS_IO_PRIORITY     LogCod = 0x04f601 // error while setting process I/O priority
+	ERROR_SYSTEM_MEMORY           LogCod = 0x04f700 // error while reading system memory usage
 
 	// utility package
 
@@ -163,7 +192,123 @@ const (
 
 	// errco package
 	ERROR_COLOR_ENABLE LogCod = 0x08f000 // error while trying to enable colors on terminal
+	ERROR_LOG_FILE     LogCod = 0x08f100 // error while writing the log file
 
 	// servstats package
 	ERROR_MINECRAFT_SERVER LogCod = 0x09f000 // major error while starting minecraft server (will be communicated to clients trying to join)
+
+	// notification package
+	ERROR_NOTIF_POST  LogCod = 0x0af000 // error while posting a webhook notification
+	ERROR_NOTIF_QUEUE LogCod = 0x0af100 // error while managing the notification retry queue
 )
+
+// codNames contains the log code names (used by the json log format)
+var codNames = map[LogCod]string{
+	ERROR_NIL:                      "ERROR_NIL",
+	ERROR_TERMINAL_NOT_ACTIVE:      "ERROR_TERMINAL_NOT_ACTIVE",
+	ERROR_TERMINAL_ACTIVE:          "ERROR_TERMINAL_ACTIVE",
+	ERROR_TERMINAL_START:           "ERROR_TERMINAL_START",
+	ERROR_MSH_MUST_WAIT:            "ERROR_MSH_MUST_WAIT",
+	ERROR_SERVER_STATUS_UNKNOWN:    "ERROR_SERVER_STATUS_UNKNOWN",
+	ERROR_SERVER_NOT_ONLINE:        "ERROR_SERVER_NOT_ONLINE",
+	ERROR_SERVER_NOT_EMPTY:         "ERROR_SERVER_NOT_EMPTY",
+	ERROR_SERVER_UNEXP_OUTPUT:      "ERROR_SERVER_UNEXP_OUTPUT",
+	ERROR_SERVER_KILL:              "ERROR_SERVER_KILL",
+	ERROR_SERVER_IS_WARM:           "ERROR_SERVER_IS_WARM",
+	ERROR_SERVER_IS_FROZEN:         "ERROR_SERVER_IS_FROZEN",
+	ERROR_SERVER_SUSPENDED:         "ERROR_SERVER_SUSPENDED",
+	ERROR_SERVER_NOT_SUSPENDED:     "ERROR_SERVER_NOT_SUSPENDED",
+	ERROR_SERVER_OFFLINE:           "ERROR_SERVER_OFFLINE",
+	ERROR_SERVER_OFFLINE_SUSPENDED: "ERROR_SERVER_OFFLINE_SUSPENDED",
+	ERROR_SERVER_STOPPING:          "ERROR_SERVER_STOPPING",
+	ERROR_SERVER_UNRESPONDING:      "ERROR_SERVER_UNRESPONDING",
+	ERROR_SERVER_SOFT_STOPPED:      "ERROR_SERVER_SOFT_STOPPED",
+	ERROR_SERVER_SOFT_START:        "ERROR_SERVER_SOFT_START",
+	ERROR_PIPE_INPUT_WRITE:         "ERROR_PIPE_INPUT_WRITE",
+	ERROR_PIPE_LOAD:                "ERROR_PIPE_LOAD",
+	ERROR_CONVERSION:               "ERROR_CONVERSION",
+	ERROR_WRONG_CONNECTION_COUNT:   "ERROR_WRONG_CONNECTION_COUNT",
+	ERROR_PLAYER_HOOK:              "ERROR_PLAYER_HOOK",
+	ERROR_DEPENDENCY:               "ERROR_DEPENDENCY",
+	ERROR_READY_COMMAND:            "ERROR_READY_COMMAND",
+	ERROR_CONSOLE_TRIGGER:          "ERROR_CONSOLE_TRIGGER",
+	ERROR_BACKEND_INVALID:          "ERROR_BACKEND_INVALID",
+	ERROR_SERVER_OOM:               "ERROR_SERVER_OOM",
+	ERROR_SERVER_CRASH:             "ERROR_SERVER_CRASH",
+	ERROR_DOCKER:                   "ERROR_DOCKER",
+	ERROR_RCON:                     "ERROR_RCON",
+	ERROR_HOOK_COMMAND:             "ERROR_HOOK_COMMAND",
+	ERROR_VERSION:                  "ERROR_VERSION",
+	ERROR_VERSION_INVALID:          "ERROR_VERSION_INVALID",
+	ERROR_GET_CORES:                "ERROR_GET_CORES",
+	ERROR_GET_CPU_INFO:             "ERROR_GET_CPU_INFO",
+	ERROR_GET_MEMORY:               "ERROR_GET_MEMORY",
+	ERROR_BODY_READ:                "ERROR_BODY_READ",
+	ERROR_STATS_FILE:               "ERROR_STATS_FILE",
+	ERROR_METRICS_PUSH:             "ERROR_METRICS_PUSH",
+	ERROR_METRICS_SERVE:            "ERROR_METRICS_SERVE",
+	ERROR_API_SERVE:                "ERROR_API_SERVE",
+	ERROR_API_UNAUTHORIZED:         "ERROR_API_UNAUTHORIZED",
+	ERROR_REQ_FLAG_BUILD:           "ERROR_REQ_FLAG_BUILD",
+	ERROR_CLIENT_REQ:               "ERROR_CLIENT_REQ",
+	ERROR_CLIENT_SOCKET_READ:       "ERROR_CLIENT_SOCKET_READ",
+	ERROR_CONN_READ:                "ERROR_CONN_READ",
+	ERROR_CONN_WRITE:               "ERROR_CONN_WRITE",
+	ERROR_CONN_EOF:                 "ERROR_CONN_EOF",
+	ERROR_SERVER_DIAL:              "ERROR_SERVER_DIAL",
+	ERROR_SERVER_REQUEST_INFO:      "ERROR_SERVER_REQUEST_INFO",
+	ERROR_JSON_MARSHAL:             "ERROR_JSON_MARSHAL",
+	ERROR_JSON_UNMARSHAL:           "ERROR_JSON_UNMARSHAL",
+	ERROR_QUERY_CHALLENGE:          "ERROR_QUERY_CHALLENGE",
+	ERROR_QUERY_BAD_REQUEST:        "ERROR_QUERY_BAD_REQUEST",
+	ERROR_PING_PACKET_UNKNOWN:      "ERROR_PING_PACKET_UNKNOWN",
+	ERROR_IDLE_KICK:                "ERROR_IDLE_KICK",
+	ERROR_PROXY_HEADER:             "ERROR_PROXY_HEADER",
+	ERROR_CONFIG_LOAD:              "ERROR_CONFIG_LOAD",
+	ERROR_CONFIG_SAVE:              "ERROR_CONFIG_SAVE",
+	ERROR_CONFIG_CHECK:             "ERROR_CONFIG_CHECK",
+	ERROR_CONFIG_MSHID:             "ERROR_CONFIG_MSHID",
+	ERROR_CONFIG_LOCK:              "ERROR_CONFIG_LOCK",
+	ERROR_CONFIG_PERSIST:           "ERROR_CONFIG_PERSIST",
+	ERROR_ICON_LOAD:                "ERROR_ICON_LOAD",
+	ERROR_VERSION_LOAD:             "ERROR_VERSION_LOAD",
+	ERROR_WHITELIST_CHECK:          "ERROR_WHITELIST_CHECK",
+	ERROR_TYPE_UNSUPPORTED:         "ERROR_TYPE_UNSUPPORTED",
+	ERROR_INVALID_COMMAND:          "ERROR_INVALID_COMMAND",
+	ERROR_PARSE:                    "ERROR_PARSE",
+	ERROR_OS_NOT_SUPPORTED:         "ERROR_OS_NOT_SUPPORTED",
+	ERROR_PROCESS_OPEN:             "ERROR_PROCESS_OPEN",
+	ERROR_PROCESS_SIGNAL:           "ERROR_PROCESS_SIGNAL",
+	ERROR_PROCESS_SUSPEND_CALL:     "ERROR_PROCESS_SUSPEND_CALL",
+	ERROR_PROCESS_RESUME_CALL:      "ERROR_PROCESS_RESUME_CALL",
+	ERROR_PROCESS_SYSTEM_SNAPSHOT:  "ERROR_PROCESS_SYSTEM_SNAPSHOT",
+	ERROR_PROCESS_ENTRY:            "ERROR_PROCESS_ENTRY",
+	ERROR_PROCESS_NOT_FOUND:        "ERROR_PROCESS_NOT_FOUND",
+	ERROR_PROCESS_LIST:             "ERROR_PROCESS_LIST",
+	ERROR_PROCESS_KILL:             "ERROR_PROCESS_KILL",
+	ERROR_PROCESS_TIME:             "ERROR_PROCESS_TIME",
+	ERROR_PROCESS_AFFINITY:         "ERROR_PROCESS_AFFINITY",
+	ERROR_PROCESS_IO_PRIORITY:      "ERROR_PROCESS_IO_PRIORITY",
+	ERROR_SYSTEM_MEMORY:            "ERROR_SYSTEM_MEMORY",
+	ERROR_ANALYSIS:                 "ERROR_ANALYSIS",
+	ERROR_CLIENT_LISTEN:            "ERROR_CLIENT_LISTEN",
+	ERROR_CLIENT_ACCEPT:            "ERROR_CLIENT_ACCEPT",
+	ERROR_COMMAND_INPUT:            "ERROR_COMMAND_INPUT",
+	ERROR_COMMAND_UNKNOWN:          "ERROR_COMMAND_UNKNOWN",
+	ERROR_INPUT:                    "ERROR_INPUT",
+	ERROR_INPUT_READ:               "ERROR_INPUT_READ",
+	ERROR_INPUT_EOF:                "ERROR_INPUT_EOF",
+	ERROR_COLOR_ENABLE:             "ERROR_COLOR_ENABLE",
+	ERROR_LOG_FILE:                 "ERROR_LOG_FILE",
+	ERROR_MINECRAFT_SERVER:         "ERROR_MINECRAFT_SERVER",
+	ERROR_NOTIF_POST:               "ERROR_NOTIF_POST",
+	ERROR_NOTIF_QUEUE:              "ERROR_NOTIF_QUEUE",
+}
+
+// Name returns the log code name (or its hex value if the name is unknown)
+func (c LogCod) Name() string {
+	if name, ok := codNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("%06x", int(c))
+}
@@ -0,0 +1,108 @@
+package errco
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// logFileRetention is the number of rotated log files kept (log.1 ... log.N)
+const logFileRetention = 3
+
+// colorRegex matches terminal color escape codes
+var colorRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// logFile is the file to which logs are written in addition to stdout (f is nil if disabled)
+var logFile = struct {
+	m       sync.Mutex
+	f       *os.File
+	path    string
+	size    int64 // current log file size
+	maxSize int64 // log file size after which the log file is rotated (0 to disable rotation)
+}{}
+
+// SetLogFile enables writing logs to the file at path (in addition to stdout).
+// When the file exceeds maxSizeMB it's rotated to path.1, path.2, ... (0 to disable rotation).
+//
+// An empty path disables the log file.
+func SetLogFile(path string, maxSizeMB int) *MshLog {
+	logFile.m.Lock()
+	defer logFile.m.Unlock()
+
+	if logFile.f != nil {
+		logFile.f.Close()
+		logFile.f = nil
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	logFile.path = path
+	logFile.maxSize = int64(maxSizeMB) * 1024 * 1024
+
+	return openLogFile()
+}
+
+// openLogFile opens the log file in append mode (logFile.m must be locked)
+func openLogFile() *MshLog {
+	f, err := os.OpenFile(logFile.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return NewLog(TYPE_ERR, LVL_1, ERROR_LOG_FILE, "could not open log file: %s", err.Error())
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return NewLog(TYPE_ERR, LVL_1, ERROR_LOG_FILE, "could not open log file: %s", err.Error())
+	}
+
+	logFile.f = f
+	logFile.size = fi.Size()
+
+	return nil
+}
+
+// writeLogFile writes a log line to the log file (without color escape codes), rotating it if needed
+func writeLogFile(line string) {
+	logFile.m.Lock()
+	defer logFile.m.Unlock()
+
+	if logFile.f == nil {
+		return
+	}
+
+	// "\x00" is used as empty log line field
+	line = colorRegex.ReplaceAllString(line, "")
+	line = StringGraphic(line) + "\n"
+
+	if logFile.maxSize > 0 && logFile.size+int64(len(line)) > logFile.maxSize && logFile.size > 0 {
+		rotateLogFile()
+		if logFile.f == nil {
+			return
+		}
+	}
+
+	n, _ := logFile.f.WriteString(line)
+	logFile.size += int64(n)
+}
+
+// rotateLogFile renames log to log.1, log.1 to log.2, ... (up to logFileRetention) and opens a new log file.
+// (logFile.m must be locked, errors are printed to stdout only to avoid recursion)
+func rotateLogFile() {
+	logFile.f.Close()
+	logFile.f = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", logFile.path, logFileRetention))
+	for i := logFileRetention - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", logFile.path, i), fmt.Sprintf("%s.%d", logFile.path, i+1))
+	}
+	if err := os.Rename(logFile.path, logFile.path+".1"); err != nil {
+		fmt.Printf("could not rotate log file: %s\n", err.Error())
+	}
+
+	if logMsh := openLogFile(); logMsh != nil {
+		fmt.Printf(logMsh.Mex+"\n", logMsh.Arg...)
+	}
+}
@@ -1,10 +1,12 @@
 package errco
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,6 +14,26 @@ import (
 // (start with LVL_3 to log config load errors)
 var DebugLvl LogLvl = LVL_3
 
+// logJson is true if log lines are written as json objects (set by SetLogFormat)
+var logJson atomic.Bool
+
+// logHook, if not nil, is called by Log() for each warning/error log (set by SetLogHook)
+var logHook atomic.Pointer[func(logMsh *MshLog)]
+
+// SetLogFormat sets the format of log lines: "text" (human readable) or "json" (one json object per line)
+func SetLogFormat(format string) {
+	logJson.Store(format == "json")
+}
+
+// SetLogHook sets the func called by Log() for each warning/error log, regardless of DebugLvl (nil to disable)
+func SetLogHook(hook func(logMsh *MshLog)) {
+	if hook == nil {
+		logHook.Store(nil)
+		return
+	}
+	logHook.Store(&hook)
+}
+
 type MshLog struct {
 	Ori LogOri        // log origin function
 	Typ LogTyp        // log type
@@ -95,11 +117,24 @@ func (logMsh *MshLog) Log(tracing bool) *MshLog {
 		logMsh.Ori = Trace(2) + LogOri(" -> ") + logMsh.Ori
 	}
 
+	// notify log hook of warnings/errors
+	if hook := logHook.Load(); hook != nil && (logMsh.Typ == TYPE_WAR || logMsh.Typ == TYPE_ERR) {
+		(*hook)(logMsh)
+	}
+
 	// return original log if log level is not high enough
 	if logMsh.Lvl > DebugLvl {
 		return logMsh
 	}
 
+	// json log line (no colors/alignment)
+	if logJson.Load() {
+		line := jsonLine(logMsh, time.Now())
+		log.Println(line)
+		writeLogFile(line)
+		return logMsh
+	}
+
 	// make a copy of original log
 	logMod := *logMsh
 
@@ -147,7 +182,7 @@ func (logMsh *MshLog) Log(tracing bool) *MshLog {
 		cod = fmt.Sprintf(" [%06x]", logMod.Cod)
 	}
 
-	log.Printf("%s [%s%-4s] %s%s%s\n",
+	line := fmt.Sprintf("%s [%s%-4s] %s%s%s",
 		time.Now().Format("2006/01/02 15:04:05.000"),
 		typ,
 		strings.Repeat("≡", 4-int(logMod.Lvl)),
@@ -155,10 +190,49 @@ func (logMsh *MshLog) Log(tracing bool) *MshLog {
 		mex,
 		cod)
 
+	log.Println(line)
+	writeLogFile(line)
+
 	// return original log
 	return logMsh
 }
 
+// jsonLine returns msh log struct as a json object
+func jsonLine(logMsh *MshLog, t time.Time) string {
+	line := struct {
+		Time     string   `json:"time"`
+		Type     LogTyp   `json:"type"`
+		Level    LogLvl   `json:"level"`
+		Code     string   `json:"code,omitempty"`
+		CodeName string   `json:"code_name,omitempty"`
+		Trace    []string `json:"trace,omitempty"`
+		Message  string   `json:"message"`
+	}{
+		Time:    t.Format("2006-01-02T15:04:05.000Z07:00"),
+		Type:    logMsh.Typ,
+		Level:   logMsh.Lvl,
+		Message: StringGraphic(colorRegex.ReplaceAllString(fmt.Sprintf(logMsh.Mex, logMsh.Arg...), "")),
+	}
+
+	if logMsh.Cod != ERROR_NIL {
+		line.Code = fmt.Sprintf("%06x", int(logMsh.Cod))
+		line.CodeName = logMsh.Cod.Name()
+	}
+
+	// trace is ordered from the outermost caller to the log origin
+	if logMsh.Ori != "" {
+		line.Trace = strings.Split(string(logMsh.Ori), " -> ")
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		// should never happen: all fields are strings/ints
+		return fmt.Sprintf(`{"message":%q}`, err.Error())
+	}
+
+	return string(data)
+}
+
 // AddTrace adds the caller function to the msh log trace
 func (log *MshLog) AddTrace() *MshLog {
 	// return original log if it's nil
@@ -0,0 +1,62 @@
+package errco
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func Test_jsonLine(t *testing.T) {
+	tm := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+	type test struct {
+		logMsh *MshLog
+		exp    map[string]interface{}
+	}
+
+	var tests []test = []test{
+		{
+			&MshLog{"main -> LoadConfig", TYPE_ERR, LVL_1, ERROR_CONFIG_LOAD, "could not load %s", []interface{}{"msh-config.json"}},
+			map[string]interface{}{"time": "2024-01-02T03:04:05.006Z", "type": "error", "level": 1.0, "code": "03f000", "code_name": "ERROR_CONFIG_LOAD", "trace": []interface{}{"main", "LoadConfig"}, "message": "could not load msh-config.json"},
+		},
+		{
+			&MshLog{"WarmMS", TYPE_INF, LVL_0, ERROR_NIL, COLOR_CYAN + "MINECRAFT SERVER IS ONLINE!" + COLOR_RESET, nil},
+			map[string]interface{}{"time": "2024-01-02T03:04:05.006Z", "type": "info", "level": 0.0, "trace": []interface{}{"WarmMS"}, "message": "MINECRAFT SERVER IS ONLINE!"},
+		},
+	}
+
+	for _, tt := range tests {
+		var res map[string]interface{}
+		line := jsonLine(tt.logMsh, tm)
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("jsonLine() = %s is not valid json: %v", line, err)
+		}
+		resData, _ := json.Marshal(res)
+		expData, _ := json.Marshal(tt.exp)
+		if string(resData) != string(expData) {
+			t.Errorf("jsonLine() = %s, want %s", resData, expData)
+		}
+	}
+}
+
+func Test_codNames(t *testing.T) {
+	src, err := os.ReadFile("errco-cod.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every log code must have a name
+	for _, m := range regexp.MustCompile(`(?m)^\s*(ERROR_\w+)\s+LogCod = 0x`).FindAllSubmatch(src, -1) {
+		found := false
+		for _, name := range codNames {
+			if name == string(m[1]) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("log code %s missing from codNames", m[1])
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"strings"
 
+	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/progmgr"
 	"msh/lib/servctrl"
@@ -23,6 +24,7 @@ func GetInput() {
 				readline.PcItem("msh",
 					readline.PcItem("start"),
 					readline.PcItem("freeze"),
+					readline.PcItem("refresh"),
 					readline.PcItem("exit"),
 				),
 				readline.PcItem("mine"),
@@ -77,20 +79,34 @@ func GetInput() {
 		case "msh":
 			// check that there is a command for the target
 			if len(lineSplit) < 2 {
-				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify msh command (start - freeze - exit)")
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify msh command (start - freeze - refresh - exit)")
 				continue
 			}
 
 			switch lineSplit[1] {
 
 			case "start":
+				servctrl.ClearCrashGiveUp()
 				logMsh := servctrl.WarmMS()
 				if logMsh != nil {
 					logMsh.Log(true)
 				}
 			case "freeze":
+				// reject manual stop if minecraft server was started too recently
+				logMsh := servctrl.CheckMinUptime()
+				if logMsh != nil {
+					logMsh.Log(true)
+					continue
+				}
+
 				// stop minecraft server forcefully
-				logMsh := servctrl.FreezeMS(true)
+				logMsh = servctrl.FreezeMS(true)
+				if logMsh != nil {
+					logMsh.Log(true)
+				}
+			case "refresh":
+				// refresh minecraft server version/protocol from server JAR file
+				logMsh := config.RefreshVersionInfo(true)
 				if logMsh != nil {
 					logMsh.Log(true)
 				}
@@ -103,7 +119,7 @@ func GetInput() {
 				// terminate msh
 				progmgr.AutoTerminate()
 			default:
-				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_UNKNOWN, "unknown command (start - freeze - exit)")
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_UNKNOWN, "unknown command (start - freeze - refresh - exit)")
 			}
 
 		// taget minecraft server
@@ -7,30 +7,111 @@ type Configuration struct {
 		FileName string `json:"FileName"`
 		Version  string `json:"Version"`
 		Protocol int    `json:"Protocol"`
+
+		StopConfirmRegex  string   `json:"StopConfirmRegex"`  // regex matching the minecraft server output line that confirms a clean stop
+		StartupDoneRegex  string   `json:"StartupDoneRegex"`  // regex matching the minecraft server output line that confirms it's ready
+		CpuAffinity       []int    `json:"CpuAffinity"`       // cpu cores to which minecraft server process is pinned (empty for no pinning)
+		StartupIoThrottle int      `json:"StartupIoThrottle"` // seconds during which minecraft server process disk I/O is throttled at startup (0 to disable)
+		StdinKeepAlive    int      `json:"StdinKeepAlive"`    // every how many seconds an empty line is written to minecraft server stdin (0 to disable)
+		AutoBootstrap     bool     `json:"AutoBootstrap"`     // regenerate missing eula.txt/server.properties and accept the eula
+		ReadyCommand      string   `json:"ReadyCommand"`      // command run repeatedly during startup, exit code 0 means minecraft server is ready ("" to disable)
+		Type              string   `json:"Type"`              // how the minecraft server is run ("java", "docker")
+		Edition           string   `json:"Edition"`           // minecraft server edition ("java", "bedrock")
+		Container         string   `json:"Container"`         // docker container running the minecraft server (Type "docker")
+		RconPort          int      `json:"RconPort"`          // minecraft server rcon port used to stop it (0 to read it from server.properties)
+		RconPassword      string   `json:"RconPassword"`      // minecraft server rcon password ("" to read it from server.properties)
+		Targets           []Target `json:"Targets"`           // standby backends (in order) to which clients are proxied when minecraft server is unreachable
 	} `json:"Server"`
 	Commands struct {
 		StartServer         string `json:"StartServer"`
 		StartServerParam    string `json:"StartServerParam"`
 		StopServer          string `json:"StopServer"`
 		StopServerAllowKill int    `json:"StopServerAllowKill"`
+		SoftStop            string `json:"SoftStop"`    // command that makes minecraft server unbind its port while running (HibernationMode "soft")
+		SoftStart           string `json:"SoftStart"`   // command that makes minecraft server bind its port again (HibernationMode "soft")
+		PreStart            string `json:"PreStart"`    // command executed before minecraft server starts ("" to disable)
+		PostStop            string `json:"PostStop"`    // command executed after minecraft server stops ("" to disable)
+		JoinWelcome         string `json:"JoinWelcome"` // minecraft server command executed when a player held during startup joins ("" to disable)
 	} `json:"Commands"`
 	Msh struct {
+		ConfigVersion                 int      `json:"ConfigVersion"` // config file version (upgraded automatically, do not modify)
 		Debug                         int      `json:"Debug"`
+		LogFile                       string   `json:"LogFile"`      // file to which msh log is written in addition to stdout ("" to disable)
+		LogMaxSizeMB                  int      `json:"LogMaxSizeMB"` // log file size (MB) after which it's rotated (0 to disable rotation)
+		LogFormat                     string   `json:"LogFormat"`    // format of log lines ("text", "json")
 		ID                            string   `json:"ID"`
+		Template                      string   `json:"Template"` // server template used to fill empty fields ("vanilla", "paper", "fabric", "forge", "" to disable)
 		MshPort                       int      `json:"MshPort"`
 		MshPortQuery                  int      `json:"MshPortQuery"`
+		MshPortRange                  string   `json:"MshPortRange"`     // port range from which msh port is picked at startup, ex: "25555-25565" ("" to use MshPort)
+		BindRetrySeconds              int      `json:"BindRetrySeconds"` // specify for how many seconds binding msh port is retried at startup (0 to disable)
 		EnableQuery                   bool     `json:"EnableQuery"`
+		EnableLegacyPing              bool     `json:"EnableLegacyPing"`     // specify if msh should respond to legacy ping (1.6 and older clients)
+		HttpOnMcPortResponse          string   `json:"HttpOnMcPortResponse"` // response to http requests on msh port ("" to close, "400" for bad request, url to redirect)
 		TimeBeforeStoppingEmptyServer int64    `json:"TimeBeforeStoppingEmptyServer"`
-		SuspendAllow                  bool     `json:"SuspendAllow"`   // specify if msh should suspend java server process
-		SuspendRefresh                int      `json:"SuspendRefresh"` // specify if msh should refresh java server process suspension and every how many seconds
+		MinUptimeBeforeStop           int      `json:"MinUptimeBeforeStop"`    // specify the seconds after start during which a manual stop is rejected
+		MinHibernationSeconds         int      `json:"MinHibernationSeconds"`  // specify the seconds after hibernation during which a join does not warm the server
+		ShutdownTimeout               int      `json:"ShutdownTimeout"`        // specify the seconds msh waits for the server to stop when msh exits before killing it
+		HibernationWarnSeconds        int      `json:"HibernationWarnSeconds"` // specify the seconds before scheduled hibernation during which msh double-checks that the server is empty (0 to disable)
+		WarnOnlinePlayers             bool     `json:"WarnOnlinePlayers"`      // specify if players found online during the hibernation check are warned in game
+		VerifyBackend                 bool     `json:"VerifyBackend"`          // specify if msh should verify that the minecraft server port speaks the minecraft protocol
+		StartupTimeout                int      `json:"StartupTimeout"`         // specify the seconds after which a starting server is considered online if ReadyCommand did not succeed (0 to disable)
+		StartupJoinTimeout            int      `json:"StartupJoinTimeout"`     // specify the seconds a joining client is held while the server starts (0 to disconnect it right away)
+		CancelStartIfEmpty            bool     `json:"CancelStartIfEmpty"`     // specify if a server start is canceled when all the held clients leave before it's online
+		HibernateOnMemPercent         int      `json:"HibernateOnMemPercent"`  // system memory usage percentage above which empty ms is hibernated early (0 to disable)
+		SuspendAllow                  bool     `json:"SuspendAllow"`           // specify if msh should suspend java server process
+		HibernationMode               string   `json:"HibernationMode"`        // specify how msh hibernates minecraft server ("stop", "soft")
+		SuspendRefresh                int      `json:"SuspendRefresh"`         // specify if msh should refresh java server process suspension and every how many seconds
+		SuspendStopAfter              int      `json:"SuspendStopAfter"`       // specify the seconds after which a suspended server is fully stopped (0 to disable)
+		IconPath                      string   `json:"IconPath"`               // server icon file path or http/https url ("" to use server-icon-frozen in server folder)
 		InfoHibernation               string   `json:"InfoHibernation"`
 		InfoStarting                  string   `json:"InfoStarting"`
+		InfoStartingProgress          bool     `json:"InfoStartingProgress"` // specify if msh should append the server loading progress to starting info
+		DiscordWebhookUrl             string   `json:"DiscordWebhookUrl"`    // discord webhook url to which minecraft server lifecycle events are sent ("" to disable)
+		OnPlayerJoin                  string   `json:"OnPlayerJoin"`         // webhook url or command executed when a player joins ("" to disable)
+		OnPlayerLeave                 string   `json:"OnPlayerLeave"`        // webhook url or command executed when a player leaves ("" to disable)
+		NotifyRetryMinutes            int      `json:"NotifyRetryMinutes"`   // minutes during which failed webhook notifications are retried (0 to disable)
+		MaxHandlers                   int      `json:"MaxHandlers"`          // maximum concurrent connection handlers, further connections are rejected (0 to disable)
+		MaxConnectionsPerIp           int      `json:"MaxConnectionsPerIp"`  // maximum concurrent connections from the same ip, further connections are rejected (0 to disable)
+		AcceptProxyProtocol           bool     `json:"AcceptProxyProtocol"`  // read the PROXY protocol header sent by a load balancer to get the real client address
+		SendProxyProtocol             bool     `json:"SendProxyProtocol"`    // send a PROXY protocol v2 header to minecraft server with the client address
+		MaxConnsPerMinute             int      `json:"MaxConnsPerMinute"`    // maximum connections per minute from the same ip, further connections are dropped (0 to disable)
+		RestartOnCrash                bool     `json:"RestartOnCrash"`       // restart minecraft server when it exits without a stop request
+		MaxRestartAttempts            int      `json:"MaxRestartAttempts"`   // maximum consecutive crash restart attempts
+		KickIdlePlayersAfter          int      `json:"KickIdlePlayersAfter"` // seconds after which an idle player is warned and kicked (0 to disable)
+		OnServerOom                   string   `json:"OnServerOom"`          // action taken when minecraft server runs out of memory ("alert", "restart", "lowermem")
 		NotifyUpdate                  bool     `json:"NotifyUpdate"`
 		NotifyMessage                 bool     `json:"NotifyMessage"`
 		Whitelist                     []string `json:"Whitelist"`
 		WhitelistImport               bool     `json:"WhitelistImport"`
+		WhitelistRconRefresh          bool     `json:"WhitelistRconRefresh"` // refresh imported whitelist through rcon "whitelist list" before hibernation
+		RespectWhitelist              bool     `json:"RespectWhitelist"`     // specify if only players in whitelist.json can warm minecraft server (when white-list=true in server.properties)
+		WhitelistKickMessage          string   `json:"WhitelistKickMessage"` // message shown to players not allowed to warm minecraft server by RespectWhitelist
+		AllowedIPs                    []string `json:"AllowedIPs"`           // ip addresses/CIDRs allowed to warm minecraft server (empty to allow every address)
+		BlockedIPs                    []string `json:"BlockedIPs"`           // ip addresses/CIDRs not allowed to warm minecraft server
+		WakeDeniedMessage             string   `json:"WakeDeniedMessage"`    // message shown to clients not allowed to warm minecraft server by AllowedIPs/BlockedIPs
 		ShowResourceUsage             bool     `json:"ShowResourceUsage"`
 		ShowInternetUsage             bool     `json:"ShowInternetUsage"`
+		SessionSummaryLevel           int      `json:"SessionSummaryLevel"` // debug level at which player session summaries are logged (-1 to disable)
+		StatsFile                     string   `json:"StatsFile"`           // specify the file to which msh periodically writes a stats snapshot
+		StatsFileInterval             int      `json:"StatsFileInterval"`   // specify every how many seconds the stats snapshot is written
+		MetricsPort                   int      `json:"MetricsPort"`         // port on which msh serves prometheus metrics at /metrics (0 to disable)
+		ApiPort                       int      `json:"ApiPort"`             // port on which msh serves the control api (0 to disable)
+		ApiToken                      string   `json:"ApiToken"`            // bearer token required by the control api
+		PushgatewayUrl                string   `json:"PushgatewayUrl"`      // prometheus pushgateway url to which msh periodically pushes metrics ("" to disable)
+		PushgatewayInterval           int      `json:"PushgatewayInterval"` // specify every how many seconds metrics are pushed
+		PushgatewayJob                string   `json:"PushgatewayJob"`      // pushgateway job label
+		PushgatewayInstance           string   `json:"PushgatewayInstance"` // pushgateway instance label ("" to use hostname)
+		OnPersistError                string   `json:"OnPersistError"`      // behaviour when msh config/state files can't be written ("warn", "alert", "readonly")
+		HttpProxy                     string   `json:"HttpProxy"`           // http proxy used for msh outbound connections ("" to use environment settings)
+		SocksProxy                    string   `json:"SocksProxy"`          // socks5 proxy used for msh outbound connections ("" to use environment settings)
+
+		Dependencies    []Dependency     `json:"Dependencies"`    // services started (in order) before minecraft server and stopped (in reverse order) after it
+		ProtocolRewrite ProtocolRewrite  `json:"ProtocolRewrite"` // client protocol range rewritten to Server.Protocol in the forwarded handshake
+		ConsoleTriggers []ConsoleTrigger `json:"ConsoleTriggers"` // minecraft server output patterns that fire a webhook or command
+		Ping            Ping             `json:"Ping"`            // rewrite of the minecraft server status response player sample
+		StatusResponse  StatusResponse   `json:"StatusResponse"`  // status response sent by msh while minecraft server is not online
+		Schedule        Schedule         `json:"Schedule"`        // time windows in which minecraft server is allowed to be online
 	} `json:"Msh"`
 }
 
@@ -45,8 +126,9 @@ type DataInfo struct {
 		Text string `json:"text"`
 	} `json:"description"`
 	Players struct {
-		Max    int `json:"max"`
-		Online int `json:"online"`
+		Max    int          `json:"max"`
+		Online int          `json:"online"`
+		Sample []DataSample `json:"sample,omitempty"`
 	} `json:"players"`
 	Version struct {
 		Name     string `json:"name"`
@@ -55,6 +137,12 @@ type DataInfo struct {
 	Favicon string `json:"favicon"`
 }
 
+// struct for a player of the status response player sample
+type DataSample struct {
+	Name string `json:"name"`
+	Id   string `json:"id"`
+}
+
 type Api2Req struct {
 	ProtV int `json:"prot-v"` // msh protocol version
 	Msh   struct {
@@ -139,8 +227,126 @@ type MshInstanceV0 struct {
 	CheckSum string `json:"CheckSum"`
 }
 
+// struct for minecraft server console trigger
+type ConsoleTrigger struct {
+	Regex    string `json:"Regex"`    // regex matched against each minecraft server output line
+	Action   string `json:"Action"`   // webhook url (json posted) or command (<line>, <match> placeholders) executed on match
+	Cooldown int    `json:"Cooldown"` // minimum seconds between two actions of the trigger (0 for the default)
+}
+
+// struct for console trigger webhook body
+type ConsoleEvent struct {
+	Regex string `json:"regex"` // regex of the trigger
+	Line  string `json:"line"`  // minecraft server output line
+	Match string `json:"match"` // part of the line matched by the regex
+}
+
+// struct for client protocol rewrite
+type ProtocolRewrite struct {
+	MinProtocol int `json:"MinProtocol"` // lowest client protocol rewritten to Server.Protocol
+	MaxProtocol int `json:"MaxProtocol"` // highest client protocol rewritten to Server.Protocol (0 to disable)
+}
+
+// struct for status response player sample rewrite and player count display
+type Ping struct {
+	SampleAppend    []string `json:"SampleAppend"`    // lines appended to the player sample of the minecraft server status response
+	SampleOverride  []string `json:"SampleOverride"`  // lines that replace the player sample of the minecraft server status response
+	StartingDisplay string   `json:"StartingDisplay"` // player count display while minecraft server is starting ("zero", "hidden", "dash")
+}
+
+// struct for the status response sent by msh while minecraft server is not online
+type StatusResponse struct {
+	VersionName         string   `json:"VersionName"`         // version name shown to clients ("" to use Server.Version)
+	Protocol            int      `json:"Protocol"`            // protocol reported to clients (0 to use Server.Protocol)
+	EchoProtocol        bool     `json:"EchoProtocol"`        // report the protocol of the requesting client (every client version sees a compatible server)
+	Sample              []string `json:"Sample"`              // player sample lines (shown when hovering the player count)
+	ShowLastPlayerCount bool     `json:"ShowLastPlayerCount"` // report the last player count known by msh instead of 0
+}
+
+// struct for hibernation schedule
+type Schedule struct {
+	Windows     []ScheduleWindow `json:"Windows"`     // windows in which minecraft server is allowed to be online (empty to disable)
+	RefuseWake  bool             `json:"RefuseWake"`  // refuse to warm minecraft server outside windows
+	KickMessage string           `json:"KickMessage"` // message shown to clients that can't warm minecraft server outside windows
+}
+
+// struct for hibernation schedule window
+type ScheduleWindow struct {
+	Days  []string `json:"Days"`  // days in which the window starts ("mon", "tue", ..., empty for every day)
+	Start string   `json:"Start"` // window start time in local timezone ("15:04")
+	End   string   `json:"End"`   // window end time in local timezone ("15:04", before Start if the window crosses midnight)
+}
+
+// struct for java version
+type JavaVersion struct {
+	Major int    // java major version (ex: 8 for "1.8.0_292", 17 for "17.0.2")
+	Full  string // java full version (ex: "1.8.0_292", "17.0.2")
+}
+
+// struct for msh lock file
+type MshLock struct {
+	Pid   int    `json:"Pid"`
+	MshId string `json:"MshId"`
+}
+
 // struct for minecraft server whitelist file
 type MSWhitelist struct {
 	UUID string `json:"uuid"`
 	Name string `json:"name"`
 }
+
+// struct for stats snapshot file
+type StatsSnapshot struct {
+	Time         string `json:"time"`          // snapshot time (RFC3339)
+	Status       string `json:"status"`        // ms status
+	Suspended    bool   `json:"suspended"`     // ms process suspended
+	Players      int    `json:"players"`       // active client connections to ms
+	LoadProgress string `json:"load-progress"` // ms loading progress
+	MajorError   string `json:"major-error"`   // ms major error ("" if none)
+	CrashError   string `json:"crash-error"`   // ms last run crash ("" if none)
+	MshUptime    int    `json:"msh-uptime"`    // msh uptime in seconds
+	TermUptime   int    `json:"ms-uptime"`     // ms terminal uptime in seconds (-1 if not running)
+	HibeDur      int    `json:"seconds-hibe"`  // seconds in which ms was hibernating since msh start
+
+	ServCpu    float64 `json:"ms-cpu"`     // ms process tree cpu percent (last sample)
+	ServCpuAvg float64 `json:"ms-cpu-avg"` // ms process tree cpu percent (rolling average)
+	ServMem    float64 `json:"ms-mem"`     // ms process tree rss memory in MB (last sample)
+	ServMemAvg float64 `json:"ms-mem-avg"` // ms process tree rss memory in MB (rolling average)
+
+	Handlers int `json:"handlers"`  // active connection handlers
+	OomCount int `json:"oom-count"` // ms out of memory errors since msh start
+
+	NotifQueue int `json:"notif-queue"` // webhook notifications waiting for a retry
+
+	MshPort int `json:"msh-port"` // port on which msh listens for clients
+
+	WakeCount      int   `json:"wake-count"`       // ms warms since msh start
+	BytesToClients int64 `json:"bytes-to-clients"` // bytes proxied server->clients since msh start (or last counters reset)
+	BytesToServer  int64 `json:"bytes-to-server"`  // bytes proxied clients->server since msh start (or last counters reset)
+	ConnPeak       int   `json:"conn-peak"`        // peak concurrent client connections to ms since msh start (or last counters reset)
+	HibernateIn    int   `json:"hibernate-in"`     // seconds until the scheduled ms hibernation (-1 if not scheduled)
+
+	ActiveTarget string `json:"active-target"` // address of the backend to which clients are proxied
+}
+
+// struct for player join/leave webhook body
+type PlayerEvent struct {
+	Event  string `json:"event"`  // "join" or "leave"
+	Player string `json:"player"` // player name
+	Count  int    `json:"count"`  // active client connections to ms
+}
+
+// struct for a standby backend minecraft server
+type Target struct {
+	Host string `json:"Host"` // standby backend host
+	Port int    `json:"Port"` // standby backend port
+}
+
+// struct for a service that minecraft server depends on
+type Dependency struct {
+	Name         string `json:"Name"`         // dependency name (used in logs)
+	StartCommand string `json:"StartCommand"` // command to start the dependency
+	StopCommand  string `json:"StopCommand"`  // command to stop the dependency ("" to leave it running)
+	ReadyAddress string `json:"ReadyAddress"` // tcp address that accepts connections when the dependency is ready ("" to skip readiness check)
+	ReadyTimeout int    `json:"ReadyTimeout"` // seconds to wait for the dependency to be ready
+}
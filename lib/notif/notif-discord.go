@@ -0,0 +1,85 @@
+package notif
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// discordDebounce is the time during which discord events are batched in a single message
+const discordDebounce = 5 * time.Second
+
+// discord contains the events waiting to be sent to DiscordWebhookUrl
+var discord = struct {
+	m      sync.Mutex
+	events []string
+}{}
+
+// Discord sends an event to DiscordWebhookUrl.
+// Events received within discordDebounce are batched in a single message.
+//
+// If DiscordWebhookUrl is not specified this func does nothing.
+//
+// [non-blocking]
+func Discord(format string, a ...interface{}) {
+	if config.ConfigRuntime().Msh.DiscordWebhookUrl == "" {
+		return
+	}
+
+	discord.m.Lock()
+	defer discord.m.Unlock()
+
+	discord.events = append(discord.events, fmt.Sprintf(format, a...))
+
+	// first event of the batch schedules the message
+	if len(discord.events) == 1 {
+		time.AfterFunc(discordDebounce, discordFlush)
+	}
+}
+
+// DiscordLogHook sends ERROR_MINECRAFT_SERVER logs and config/state files persistence errors
+// (OnPersistError "alert"/"readonly") to DiscordWebhookUrl (to be set with errco.SetLogHook)
+func DiscordLogHook(logMsh *errco.MshLog) {
+	switch {
+	case logMsh.Cod == errco.ERROR_MINECRAFT_SERVER:
+		Discord("minecraft server error: %s", fmt.Sprintf(logMsh.Mex, logMsh.Arg...))
+	case logMsh.Cod == errco.ERROR_CONFIG_PERSIST && logMsh.Typ == errco.TYPE_ERR:
+		Discord("msh error: %s", fmt.Sprintf(logMsh.Mex, logMsh.Arg...))
+	}
+}
+
+// discordFlush sends the batched events to DiscordWebhookUrl.
+// Delivery failures are only logged.
+//
+// [goroutine]
+func discordFlush() {
+	discord.m.Lock()
+	events := discord.events
+	discord.events = nil
+	discord.m.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+
+	// discord message content is limited to 2000 characters
+	content := []rune(strings.Join(events, "\n"))
+	if len(content) > 2000 {
+		content = append(content[:1997], []rune("...")...)
+	}
+
+	body, err := json.Marshal(map[string]string{"content": string(content)})
+	if err != nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+		return
+	}
+
+	if logMsh := PostJson(config.ConfigRuntime().Msh.DiscordWebhookUrl, body); logMsh != nil {
+		logMsh.Log(true)
+	}
+}
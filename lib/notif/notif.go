@@ -0,0 +1,244 @@
+package notif
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+const (
+	queueFileName = "msh-notif-queue.json" // file where undelivered notifications are persisted
+	maxQueue      = 50                     // maximum queued notifications (oldest are dropped when full)
+	retryMinDelay = 30 * time.Second       // first retry delay
+	retryMaxDelay = 5 * time.Minute        // maximum retry delay (delay doubles at each failed retry)
+	postTimeout   = 10 * time.Second       // http post timeout
+)
+
+// notification is a webhook notification that could not be delivered
+type notification struct {
+	Url  string          `json:"url"`
+	Body json.RawMessage `json:"body"`
+	Time time.Time       `json:"time"` // time of the first delivery attempt
+	id   uint64          // queue id
+}
+
+// queue contains the notifications waiting for a retry
+var queue = struct {
+	m        sync.Mutex
+	n        []notification
+	retrying bool   // retrier is running
+	nextId   uint64 // id of the next queued notification
+}{n: []notification{}}
+
+// PostJson posts a json body to a webhook url.
+//
+// If the delivery fails because of a transient error and NotifyRetryMinutes is enabled,
+// the notification is queued and retried with backoff.
+func PostJson(url string, body []byte) *errco.MshLog {
+	logMsh, transient := post(url, body)
+	if logMsh == nil {
+		return nil
+	}
+
+	if transient && config.ConfigRuntime().Msh.NotifyRetryMinutes > 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_NOTIF_QUEUE, "notification to %s queued for retry", url)
+		enqueue(notification{Url: url, Body: body, Time: time.Now()})
+	}
+
+	return logMsh.AddTrace()
+}
+
+// QueueDepth returns the number of notifications waiting for a retry
+func QueueDepth() int {
+	queue.m.Lock()
+	defer queue.m.Unlock()
+	return len(queue.n)
+}
+
+// LoadQueue loads the notifications that were not delivered before msh exited and starts retrying them.
+//
+// If NotifyRetryMinutes is disabled this func does nothing.
+func LoadQueue() *errco.MshLog {
+	if config.ConfigRuntime().Msh.NotifyRetryMinutes <= 0 {
+		return nil
+	}
+
+	n, logMsh := load()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	for _, nn := range n {
+		enqueue(nn)
+	}
+
+	return nil
+}
+
+// post posts a json body to a webhook url.
+// Returns true if the error is transient (network error, 429 or 5xx status) and delivery should be retried.
+func post(url string, body []byte) (*errco.MshLog, bool) {
+	res, err := config.HttpClient(postTimeout).Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_NOTIF_POST, err.Error()), true
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		transient := res.StatusCode == 429 || res.StatusCode >= 500
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_NOTIF_POST, "webhook %s returned status: %s", url, res.Status), transient
+	}
+
+	return nil, false
+}
+
+// enqueue adds a notification to the retry queue (dropping the oldest if full) and starts the retrier
+func enqueue(n notification) {
+	queue.m.Lock()
+	defer queue.m.Unlock()
+
+	n.id = queue.nextId
+	queue.nextId++
+
+	queue.n = append(queue.n, n)
+	if len(queue.n) > maxQueue {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_NOTIF_QUEUE, "notification queue full, dropping notification to %s", queue.n[0].Url)
+		queue.n = queue.n[1:]
+	}
+	save()
+
+	if !queue.retrying {
+		queue.retrying = true
+		go retrier()
+	}
+}
+
+// retrier retries queued notifications with exponential backoff until the queue is empty.
+// Notifications older than NotifyRetryMinutes are dropped.
+//
+// [goroutine]
+func retrier() {
+	delay := retryMinDelay
+
+	for {
+		time.Sleep(delay)
+
+		queue.m.Lock()
+		pending := append([]notification{}, queue.n...)
+		queue.m.Unlock()
+
+		// ids of delivered/expired notifications
+		done := map[uint64]bool{}
+		backendDown := false
+		for _, n := range pending {
+			if time.Since(n.Time) > time.Duration(config.ConfigRuntime().Msh.NotifyRetryMinutes)*time.Minute {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_NOTIF_QUEUE, "notification to %s expired, dropping it", n.Url)
+				done[n.id] = true
+				continue
+			}
+
+			logMsh, transient := post(n.Url, n.Body)
+			if logMsh != nil && transient {
+				// backend is still down, retry later
+				backendDown = true
+				break
+			}
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
+			done[n.id] = true
+		}
+
+		queue.m.Lock()
+		// notifications might have been added or dropped in the meantime
+		remaining := []notification{}
+		for _, n := range queue.n {
+			if !done[n.id] {
+				remaining = append(remaining, n)
+			}
+		}
+		queue.n = remaining
+		save()
+		if len(queue.n) == 0 {
+			queue.retrying = false
+			queue.m.Unlock()
+			return
+		}
+		queue.m.Unlock()
+
+		if backendDown {
+			delay *= 2
+			if delay > retryMaxDelay {
+				delay = retryMaxDelay
+			}
+		} else {
+			delay = retryMinDelay
+		}
+	}
+}
+
+// load reads the notification queue file written by save.
+// Notifications whose url can't be decrypted are dropped.
+func load() ([]notification, *errco.MshLog) {
+	data, err := os.ReadFile(filepath.Join(config.MshHome, queueFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_NOTIF_QUEUE, err.Error())
+	}
+
+	var saved []notification
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
+	}
+
+	n := []notification{}
+	for _, nn := range saved {
+		url, err := config.DecryptValue(nn.Url)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_NOTIF_QUEUE, "could not decrypt queued notification url, dropping it: %s", err.Error())
+			continue
+		}
+		nn.Url = url
+		n = append(n, nn)
+	}
+
+	return n, nil
+}
+
+// save writes the notification queue to file (queue.m must be locked).
+// Webhook urls contain secrets (ex: DiscordWebhookUrl): they are encrypted.
+func save() {
+	queueFilePath := filepath.Join(config.MshHome, queueFileName)
+
+	if len(queue.n) == 0 {
+		if err := os.Remove(queueFilePath); err != nil && !os.IsNotExist(err) {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_NOTIF_QUEUE, err.Error())
+		}
+		return
+	}
+
+	saved := make([]notification, len(queue.n))
+	for i, n := range queue.n {
+		n.Url = config.EncryptValue(n.Url)
+		saved[i] = n
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+		return
+	}
+
+	logMsh := config.WritePersistFile(queueFilePath, data)
+	if logMsh != nil {
+		logMsh.Log(true)
+	}
+}
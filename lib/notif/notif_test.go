@@ -0,0 +1,50 @@
+package notif
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+)
+
+func Test_saveLoad(t *testing.T) {
+	config.MshHome = t.TempDir()
+
+	url := "https://discord.com/api/webhooks/123/secret-token"
+	queue.m.Lock()
+	queue.n = []notification{{Url: url, Body: json.RawMessage(`{"content":"hi"}`), Time: time.Unix(1700000000, 0).UTC()}}
+	save()
+	queue.n = []notification{}
+	queue.m.Unlock()
+
+	queueFilePath := filepath.Join(config.MshHome, queueFileName)
+	fi, err := os.Stat(queueFilePath)
+	if err != nil {
+		t.Fatalf("save: %s", err.Error())
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("save: file permissions %o, want 600", fi.Mode().Perm())
+	}
+
+	data, _ := os.ReadFile(queueFilePath)
+	if enc := config.EncryptValue(url); enc != url && strings.Contains(string(data), "secret-token") {
+		t.Errorf("save: webhook url written in plaintext")
+	}
+
+	n, logMsh := load()
+	if logMsh != nil {
+		t.Fatalf("load: %s", logMsh.Mex)
+	}
+	var body bytes.Buffer
+	if len(n) == 1 {
+		_ = json.Compact(&body, n[0].Body)
+	}
+	if len(n) != 1 || n[0].Url != url || body.String() != `{"content":"hi"}` || !n[0].Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("load: got %+v", n)
+	}
+}
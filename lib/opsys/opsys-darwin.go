@@ -0,0 +1,28 @@
+//go:build darwin
+
+package opsys
+
+import (
+	"github.com/shirou/gopsutil/mem"
+
+	"msh/lib/errco"
+)
+
+func procSetAffinity(pid uint32, cpus []int) *errco.MshLog {
+	// macos does not support pinning a process to specific cpu cores
+	return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROCESS_AFFINITY, "cpu affinity is not supported on this OS")
+}
+
+func procTreeIoThrottle(ppid uint32, throttle bool) *errco.MshLog {
+	return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROCESS_IO_PRIORITY, "I/O throttle is not supported on this OS")
+}
+
+func sysMemPercent() (float64, *errco.MshLog) {
+	// macos has no /proc/meminfo: memory statistics are read through host_statistics (gopsutil)
+	memInfo, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SYSTEM_MEMORY, err.Error())
+	}
+
+	return memInfo.UsedPercent, nil
+}
@@ -0,0 +1,97 @@
+//go:build linux
+
+package opsys
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"msh/lib/errco"
+)
+
+func procSetAffinity(pid uint32, cpus []int) *errco.MshLog {
+	var set unix.CPUSet
+	set.Zero()
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+
+	// sched_setaffinity applies to a single thread:
+	// set affinity of all existing threads (threads created later inherit it)
+	tids, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(int(pid)), "task"))
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_AFFINITY, err.Error())
+	}
+
+	for _, t := range tids {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+		err = unix.SchedSetaffinity(tid, &set)
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_AFFINITY, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// ioprio_set constants (linux/ioprio.h)
+const (
+	ioprioWhoPgrp    = 2  // IOPRIO_WHO_PGRP
+	ioprioClassShift = 13 // IOPRIO_CLASS_SHIFT
+	ioprioClassBE    = 2  // IOPRIO_CLASS_BE (best-effort, default)
+	ioprioClassIdle  = 3  // IOPRIO_CLASS_IDLE (disk I/O only when no other process needs it)
+)
+
+func procTreeIoThrottle(ppid uint32, throttle bool) *errco.MshLog {
+	// ms process is started in a new process group (pgid == ppid)
+	prio := ioprioClassBE<<ioprioClassShift | 4 // best-effort default level
+	if throttle {
+		prio = ioprioClassIdle << ioprioClassShift
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoPgrp, uintptr(ppid), uintptr(prio))
+	if errno != 0 {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_IO_PRIORITY, errno.Error())
+	}
+
+	return nil
+}
+
+func sysMemPercent() (float64, *errco.MshLog) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SYSTEM_MEMORY, err.Error())
+	}
+
+	// /proc/meminfo lines: "MemTotal:       16318480 kB"
+	var total, available uint64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "MemAvailable:":
+			available, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	if total == 0 || available > total {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SYSTEM_MEMORY, "could not parse /proc/meminfo")
+	}
+
+	return float64(total-available) / float64(total) * 100, nil
+}
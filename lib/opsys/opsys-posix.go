@@ -5,6 +5,7 @@ package opsys
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"syscall"
 
 	"msh/lib/errco"
@@ -64,6 +65,12 @@ func procTreeKill(ppid uint32) *errco.MshLog {
 	return nil
 }
 
+func procAlive(pid int) bool {
+	// signal 0 performs error checking only (EPERM means that the process exists)
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
 func fileId(filePath string) (uint64, error) {
 	// https://github.com/hymkor/go-windows-fileid/blob/master/main_unix.go
 	fileInf, err := os.Stat(filePath)
@@ -76,3 +83,18 @@ func fileId(filePath string) (uint64, error) {
 	}
 	return stat.Ino, nil
 }
+
+func notifyReload(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
+
+func listenControl(network, address string, rc syscall.RawConn) error {
+	var sockErr error
+	err := rc.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -22,6 +22,10 @@ var (
 	dllNtdll             = windows.NewLazySystemDLL("ntdll.dll")
 	procNtResumeProcess  = dllNtdll.NewProc("NtResumeProcess")
 	procNtSuspendProcess = dllNtdll.NewProc("NtSuspendProcess")
+
+	dllKernel32                = windows.NewLazySystemDLL("kernel32.dll")
+	procSetProcessAffinityMask = dllKernel32.NewProc("SetProcessAffinityMask")
+	procGlobalMemoryStatusEx   = dllKernel32.NewProc("GlobalMemoryStatusEx")
 )
 
 func init() {
@@ -220,6 +224,35 @@ func getTreePids(rootPid uint32) ([]uint32, *errco.MshLog) {
 	}
 }
 
+func procSetAffinity(pid uint32, cpus []int) *errco.MshLog {
+	var mask uintptr
+	for _, cpu := range cpus {
+		mask |= 1 << uint(cpu)
+	}
+
+	h, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION|windows.PROCESS_QUERY_INFORMATION, false, pid)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_OPEN, err.Error())
+	}
+	defer windows.CloseHandle(h)
+
+	r1, _, err := procSetProcessAffinityMask.Call(uintptr(h), mask)
+	if r1 == 0 {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_AFFINITY, err.Error())
+	}
+
+	return nil
+}
+
+func procTreeIoThrottle(ppid uint32, throttle bool) *errco.MshLog {
+	return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PROCESS_IO_PRIORITY, "I/O throttle is not supported on this OS")
+}
+
+func procAlive(pid int) bool {
+	exists, err := process.PidExists(int32(pid))
+	return err == nil && exists
+}
+
 // fileId returns
 func fileId(filePath string) (uint64, error) {
 	// https://github.com/hymkor/go-windows-fileid/blob/master/main_windows.go
@@ -252,3 +285,43 @@ func fileId(filePath string) (uint64, error) {
 
 	return (uint64(data.FileIndexHigh) << 32) | uint64(data.FileIndexLow), nil
 }
+
+// memoryStatusEx is the MEMORYSTATUSEX structure used by GlobalMemoryStatusEx
+// https://learn.microsoft.com/en-us/windows/win32/api/sysinfoapi/ns-sysinfoapi-memorystatusex
+type memoryStatusEx struct {
+	cbSize                  uint32
+	dwMemoryLoad            uint32
+	ullTotalPhys            uint64
+	ullAvailPhys            uint64
+	ullTotalPageFile        uint64
+	ullAvailPageFile        uint64
+	ullTotalVirtual         uint64
+	ullAvailVirtual         uint64
+	ullAvailExtendedVirtual uint64
+}
+
+func sysMemPercent() (float64, *errco.MshLog) {
+	var memStatus memoryStatusEx
+	memStatus.cbSize = uint32(unsafe.Sizeof(memStatus))
+
+	r1, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&memStatus)))
+	if r1 == 0 {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SYSTEM_MEMORY, err.Error())
+	}
+
+	if memStatus.ullTotalPhys == 0 {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SYSTEM_MEMORY, "total physical memory is 0")
+	}
+
+	return float64(memStatus.ullTotalPhys-memStatus.ullAvailPhys) / float64(memStatus.ullTotalPhys) * 100, nil
+}
+
+func notifyReload(c chan<- os.Signal) {
+	// windows processes don't receive SIGHUP
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "config reload on SIGHUP is not supported on this OS")
+}
+
+func listenControl(network, address string, rc syscall.RawConn) error {
+	// on windows SO_REUSEADDR allows another process to bind the same port (TIME_WAIT does not prevent binding)
+	return nil
+}
@@ -1,6 +1,10 @@
 package opsys
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"os"
 	"runtime"
 	"syscall"
 
@@ -60,3 +64,67 @@ func ProcTreeKill(ppid uint32) *errco.MshLog {
 func FileId(filePath string) (uint64, error) {
 	return fileId(filePath)
 }
+
+// ProcAlive returns true if a process with the specified pid is running
+func ProcAlive(pid int) bool {
+	return procAlive(pid)
+}
+
+// ProcSetAffinity pins a process to the specified cpu cores.
+// Cpu core ids are validated against the available cpus.
+func ProcSetAffinity(pid uint32, cpus []int) *errco.MshLog {
+	for _, cpu := range cpus {
+		if cpu < 0 || cpu >= runtime.NumCPU() {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROCESS_AFFINITY, "cpu core %d is not available (available cores: 0-%d)", cpu, runtime.NumCPU()-1)
+		}
+	}
+
+	logMsh := procSetAffinity(pid, cpus)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "applied cpu affinity %s to process (pid: %d)", fmt.Sprint(cpus), pid)
+
+	return nil
+}
+
+// ProcTreeIoThrottle lowers (throttle = true) or restores (throttle = false) the disk I/O priority of a process tree by pid
+func ProcTreeIoThrottle(ppid uint32, throttle bool) *errco.MshLog {
+	logMsh := procTreeIoThrottle(ppid, throttle)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	if throttle {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "applied I/O throttle to proc tree (pid: %d)", ppid)
+	} else {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "released I/O throttle of proc tree (pid: %d)", ppid)
+	}
+
+	return nil
+}
+
+// SysMemPercent returns the system memory usage percentage (used / total)
+func SysMemPercent() (float64, *errco.MshLog) {
+	p, logMsh := sysMemPercent()
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+
+	return p, nil
+}
+
+// NotifyReload relays the config reload signal (SIGHUP) to c.
+// On OSes without SIGHUP this func does nothing.
+func NotifyReload(c chan<- os.Signal) {
+	notifyReload(c)
+}
+
+// ListenTCP opens a tcp listener on address.
+// SO_REUSEADDR is set where it's safe, so that the port can be bound again
+// while the connections of a previous msh instance are in TIME_WAIT.
+func ListenTCP(address string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: listenControl}
+	return lc.Listen(context.Background(), "tcp", address)
+}
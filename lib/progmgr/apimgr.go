@@ -0,0 +1,183 @@
+package progmgr
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+)
+
+// apiRedacted replaces secrets in the config returned by the api
+const apiRedacted = "<redacted>"
+
+var (
+	// apiSrv serves the msh control api (nil if ApiPort is not specified)
+	apiSrv *http.Server
+
+	// apiM serializes api stop requests
+	// (api start requests are serialized with all the other ms warms by servctrl.WarmMS)
+	apiM sync.Mutex
+)
+
+// startApiServer starts serving the msh control api on ApiPort.
+//
+// If ApiPort is not specified this func just returns.
+//
+// [non-blocking]
+func startApiServer() {
+	if config.ConfigRuntime().Msh.ApiPort == 0 {
+		return
+	}
+
+	// the api can start/stop ms: never serve it without authentication
+	if config.ConfigRuntime().Msh.ApiToken == "" {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_API_SERVE, "ApiToken is not set, api disabled")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", apiHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		apiWriteJson(w, http.StatusOK, buildStatsSnapshot())
+	}))
+	mux.HandleFunc("/start", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		servctrl.ClearCrashGiveUp()
+		if logMsh := servctrl.WarmMS(); logMsh != nil {
+			logMsh.Log(true)
+			apiWriteJson(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf(logMsh.Mex, logMsh.Arg...)})
+			return
+		}
+		apiWriteJson(w, http.StatusOK, map[string]string{"result": "minecraft server warm issued"})
+	}))
+	mux.HandleFunc("/stop", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		apiM.Lock()
+		defer apiM.Unlock()
+
+		// reject manual stop if minecraft server was started too recently
+		logMsh := servctrl.CheckMinUptime()
+		if logMsh == nil {
+			logMsh = servctrl.FreezeMS(true)
+		}
+		if logMsh != nil {
+			logMsh.Log(true)
+			apiWriteJson(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf(logMsh.Mex, logMsh.Arg...)})
+			return
+		}
+		apiWriteJson(w, http.StatusOK, map[string]string{"result": "minecraft server freeze issued"})
+	}))
+	mux.HandleFunc("/stats/reset", apiHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		toClients, toServer, peak := servstats.Stats.ResetCounters()
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "stats counters reset (%d bytes to clients, %d bytes to server, %d peak connections)", toClients, toServer, peak)
+		apiWriteJson(w, http.StatusOK, map[string]interface{}{"bytes-to-clients": toClients, "bytes-to-server": toServer, "conn-peak": peak})
+	}))
+	mux.HandleFunc("/config", apiHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		apiWriteJson(w, http.StatusOK, redactConfig(config.ConfigRuntime()))
+	}))
+
+	apiSrv = &http.Server{
+		Addr:              net.JoinHostPort(config.MshHost, strconv.Itoa(config.ConfigRuntime().Msh.ApiPort)),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "serving api on http://%s", apiSrv.Addr)
+
+	// [goroutine]
+	go func(srv *http.Server) {
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			// api server failure is not fatal
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_API_SERVE, err.Error())
+		}
+	}(apiSrv)
+}
+
+// stopApiServer shuts down the api server (waiting at most 1 second for active requests)
+func stopApiServer() {
+	if apiSrv == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := apiSrv.Shutdown(ctx); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_API_SERVE, err.Error())
+	}
+}
+
+// apiHandler returns a handler that checks the request method and the bearer token before calling h
+func apiHandler(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == auth || subtle.ConstantTimeCompare([]byte(token), []byte(config.ConfigRuntime().Msh.ApiToken)) != 1 {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_API_UNAUTHORIZED, "unauthorized api request from %s: %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+			apiWriteJson(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			apiWriteJson(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "api request from %s: %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+		h(w, r)
+	}
+}
+
+// apiWriteJson writes v as json response with the specified status code
+func apiWriteJson(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// redactConfig returns a copy of the config with secrets (passwords, tokens, webhook/proxy urls, console trigger actions) redacted
+func redactConfig(c *config.Configuration) *config.Configuration {
+	r := *c
+
+	// console trigger actions are webhook urls or commands
+	r.Msh.ConsoleTriggers = make([]model.ConsoleTrigger, len(c.Msh.ConsoleTriggers))
+	for i, ct := range c.Msh.ConsoleTriggers {
+		r.Msh.ConsoleTriggers[i] = model.ConsoleTrigger{Regex: ct.Regex, Action: apiRedacted, Cooldown: ct.Cooldown}
+	}
+
+	for _, s := range []*string{
+		&r.Server.RconPassword,
+		&r.Msh.ApiToken,
+		&r.Msh.DiscordWebhookUrl,
+		&r.Msh.OnPlayerJoin,
+		&r.Msh.OnPlayerLeave,
+		&r.Msh.PushgatewayUrl,
+		&r.Msh.HttpProxy,
+		&r.Msh.SocksProxy,
+	} {
+		if *s != "" {
+			*s = apiRedacted
+		}
+	}
+
+	return &r
+}
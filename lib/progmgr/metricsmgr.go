@@ -0,0 +1,172 @@
+package progmgr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+// metricsSrv serves msh metrics at /metrics (nil if MetricsPort is not specified)
+var metricsSrv *http.Server
+
+// startMetricsServer starts serving msh metrics at /metrics on MetricsPort.
+//
+// If MetricsPort is not specified this func just returns.
+//
+// [non-blocking]
+func startMetricsServer() {
+	if config.ConfigRuntime().Msh.MetricsPort == 0 {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(buildMetrics(buildStatsSnapshot())))
+	})
+
+	metricsSrv = &http.Server{
+		Addr:              net.JoinHostPort(config.MshHost, strconv.Itoa(config.ConfigRuntime().Msh.MetricsPort)),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "serving metrics on http://%s/metrics", metricsSrv.Addr)
+
+	// [goroutine]
+	go func(srv *http.Server) {
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			// metrics server failure is not fatal
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_METRICS_SERVE, err.Error())
+		}
+	}(metricsSrv)
+}
+
+// stopMetricsServer shuts down the metrics server (waiting at most 1 second for active requests)
+func stopMetricsServer() {
+	if metricsSrv == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := metricsSrv.Shutdown(ctx); err != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_METRICS_SERVE, err.Error())
+	}
+}
+
+// pushMgr periodically pushes msh metrics to PushgatewayUrl.
+//
+// If PushgatewayUrl is not specified this func just returns.
+//
+// [goroutine]
+func pushMgr() {
+	if config.ConfigRuntime().Msh.PushgatewayUrl == "" {
+		return
+	}
+
+	interval := config.ConfigRuntime().Msh.PushgatewayInterval
+	if interval <= 0 {
+		interval = 30
+	}
+
+	job := config.ConfigRuntime().Msh.PushgatewayJob
+	if job == "" {
+		job = "msh"
+	}
+
+	instance := config.ConfigRuntime().Msh.PushgatewayInstance
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+
+	pushAddr := fmt.Sprintf("%s/metrics/job/%s/instance/%s", strings.TrimSuffix(config.ConfigRuntime().Msh.PushgatewayUrl, "/"), url.PathEscape(job), url.PathEscape(instance))
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "pushing metrics to %s every %d seconds", pushAddr, interval)
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	for {
+		logMsh := pushMetrics(pushAddr, buildMetrics(buildStatsSnapshot()))
+		if logMsh != nil {
+			// push failures are not fatal, metrics will be pushed again at next tick
+			logMsh.Log(true)
+		}
+
+		<-ticker.C
+	}
+}
+
+// buildMetrics returns the stats snapshot formatted in prometheus text exposition format
+func buildMetrics(snap *model.StatsSnapshot) string {
+	var b strings.Builder
+
+	addMetric := func(name, typ, help, labels string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, typ)
+		fmt.Fprintf(&b, "%s%s %v\n", name, labels, value)
+	}
+
+	boolToInt := func(v bool) int {
+		if v {
+			return 1
+		}
+		return 0
+	}
+
+	addMetric("msh_server_status", "gauge", "Minecraft server status.", fmt.Sprintf("{status=%q}", snap.Status), 1)
+	addMetric("msh_server_suspended", "gauge", "Minecraft server process is suspended.", "", boolToInt(snap.Suspended))
+	addMetric("msh_server_major_error", "gauge", "Minecraft server has a major error.", "", boolToInt(snap.MajorError != ""))
+	addMetric("msh_players", "gauge", "Active client connections to minecraft server.", "", snap.Players)
+	addMetric("msh_uptime_seconds", "gauge", "Msh uptime in seconds.", "", snap.MshUptime)
+	addMetric("msh_server_uptime_seconds", "gauge", "Minecraft server terminal uptime in seconds (-1 if not running).", "", snap.TermUptime)
+	addMetric("msh_server_cpu_percent", "gauge", "Minecraft server process tree cpu percent.", "", snap.ServCpu)
+	addMetric("msh_server_memory_megabytes", "gauge", "Minecraft server process tree rss memory in MB.", "", snap.ServMem)
+	addMetric("msh_server_oom_total", "counter", "Minecraft server out of memory errors since msh start.", "", snap.OomCount)
+	addMetric("msh_notif_queue_depth", "gauge", "Webhook notifications waiting for a retry.", "", snap.NotifQueue)
+	addMetric("msh_hibernation_seconds_total", "counter", "Seconds in which minecraft server was hibernating since msh start.", "", snap.HibeDur)
+	addMetric("msh_wake_total", "counter", "Minecraft server warms since msh start.", "", snap.WakeCount)
+	addMetric("msh_connections_peak", "gauge", "Peak concurrent client connections to minecraft server since msh start or last counters reset.", "", snap.ConnPeak)
+	fmt.Fprintf(&b, "# HELP msh_proxied_bytes_total Bytes proxied between clients and minecraft server since msh start or last counters reset.\n")
+	fmt.Fprintf(&b, "# TYPE msh_proxied_bytes_total counter\n")
+	fmt.Fprintf(&b, "msh_proxied_bytes_total{direction=\"to_clients\"} %d\n", snap.BytesToClients)
+	fmt.Fprintf(&b, "msh_proxied_bytes_total{direction=\"to_server\"} %d\n", snap.BytesToServer)
+	addMetric("msh_seconds_until_hibernation", "gauge", "Seconds until the scheduled minecraft server hibernation (-1 if not scheduled).", "", snap.HibernateIn)
+
+	return b.String()
+}
+
+// pushMetrics sends metrics to the pushgateway address (replacing previously pushed metrics of the same group)
+func pushMetrics(pushAddr, metrics string) *errco.MshLog {
+	req, err := http.NewRequest(http.MethodPut, pushAddr, bytes.NewBufferString(metrics))
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_METRICS_PUSH, err.Error())
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := config.HttpClient(10 * time.Second)
+	res, err := client.Do(req)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_METRICS_PUSH, err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_METRICS_PUSH, "pushgateway returned status: %s", res.Status)
+	}
+
+	return nil
+}
@@ -6,9 +6,11 @@ import (
 	"syscall"
 	"time"
 
+	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/notif"
+	"msh/lib/opsys"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
 )
 
 /*
@@ -26,13 +28,16 @@ var (
 	msh *program = &program{
 		startTime: time.Now(),
 		sigExit:   make(chan os.Signal, 1),
+		sigReload: make(chan os.Signal, 1),
 		mgrActive: false,
 	}
 )
 
 type program struct {
 	startTime time.Time      // msh program start time
+	hibeDur   int            // seconds in which ms was hibernating since msh start
 	sigExit   chan os.Signal // channel through which OS termination signals are notified
+	sigReload chan os.Signal // channel through which OS config reload signals are notified
 	mgrActive bool           // indicates if msh manager is running
 }
 
@@ -43,8 +48,44 @@ func MshMgr() {
 	// start segment manager
 	go sgmMgr()
 
+	// start stats file manager
+	go statsMgr()
+
+	// start metrics push manager
+	go pushMgr()
+
+	// start metrics server
+	startMetricsServer()
+
+	// start control api server
+	startApiServer()
+
+	// load undelivered notifications
+	logMsh := notif.LoadQueue()
+	if logMsh != nil {
+		logMsh.Log(true)
+	}
+
+	// send minecraft server errors to discord
+	errco.SetLogHook(notif.DiscordLogHook)
+
+	// start config file watcher
+	go config.WatchConfig()
+
+	// start minecraft server version refresher
+	go versionRefresher()
+
+	// start hibernation schedule manager
+	go servctrl.ScheduleMgr()
+
+	// start memory pressure hibernation manager
+	go servctrl.MemoryMgr()
+
+	// reload config file on SIGHUP
+	go reloadOnSignal()
+
 	// set msh.sigExit to relay termination signals
-	signal.Notify(msh.sigExit, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(msh.sigExit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	msh.mgrActive = true
 
@@ -53,31 +94,23 @@ func MshMgr() {
 		sig := <-msh.sigExit
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "received signal: %s", sig.String())
 
-		// stop the minecraft server forcefully
-		logMsh := servctrl.FreezeMS(true)
-		if logMsh != nil {
+		// save pending config changes before stopping the minecraft server
+		if logMsh := config.SavePending(); logMsh != nil {
 			logMsh.Log(true)
 		}
 
 		// send last statistics before exiting
 		go sendApi2Req(updAddr, buildApi2Req(true))
 
-		// wait 1 second to let the server go into stopping mode
-		time.Sleep(1 * time.Second)
-
-		switch servstats.Stats.Status {
-		case errco.SERVER_STATUS_STOPPING:
-			// if server is correctly stopping, wait for minecraft server to exit
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "waiting for minecraft server terminal to exit (minecraft server is stopping)")
-			servctrl.ServTerm.Wg.Wait()
+		// stop the minecraft server and wait for it to exit (killing it after ShutdownTimeout)
+		servctrl.ShutdownMS(time.Duration(config.ConfigRuntime().Msh.ShutdownTimeout) * time.Second)
 
-		case errco.SERVER_STATUS_OFFLINE:
-			// if server is offline, then it's safe to continue
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server terminal already exited (minecraft server is offline)")
+		// stop metrics and api servers
+		stopMetricsServer()
+		stopApiServer()
 
-		default:
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "stop command does not seem to be stopping minecraft server during forceful shutdown")
-		}
+		// release msh lock file
+		config.ReleaseLock()
 
 		// exit
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "exiting msh")
@@ -93,6 +126,36 @@ func AutoTerminate() {
 		msh.sigExit <- syscall.SIGINT
 	} else {
 		// msh manager still not running, just exit with non 0 value
+		config.ReleaseLock()
 		os.Exit(1)
 	}
 }
+
+// versionRefresher periodically checks if the minecraft server JAR file was modified
+// and refreshes minecraft server version/protocol accordingly.
+// [goroutine]
+func versionRefresher() {
+	for range time.NewTicker(time.Minute).C {
+		logMsh := config.RefreshVersionInfo(false)
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+}
+
+// reloadOnSignal reloads the config file when a config reload signal (SIGHUP) is received.
+// (signals received during a reload are coalesced as msh.sigReload has a buffer of 1)
+// [goroutine]
+func reloadOnSignal() {
+	opsys.NotifyReload(msh.sigReload)
+
+	for sig := range msh.sigReload {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "received signal: %s", sig.String())
+
+		logMsh := config.ReloadConfig()
+		if logMsh != nil {
+			logMsh.Log(true)
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "config file could not be reloaded, keeping the running config")
+		}
+	}
+}
@@ -78,6 +78,7 @@ func sgmMgr() {
 			logMsh := servctrl.CheckMSWarm()
 			if logMsh != nil {
 				sgm.stats.hibeDur += 1
+				msh.hibeDur += 1
 			}
 
 			// increment play seconds sum
@@ -88,7 +89,7 @@ func sgmMgr() {
 			sgm.stats.usageCpu = (sgm.stats.usageCpu*float64(sgm.stats.dur-1) + float64(mshTreeCpu)) / float64(sgm.stats.dur) // sgm.stats.seconds-1 because the average is relative to 1 sec ago
 			sgm.stats.usageMem = (sgm.stats.usageMem*float64(sgm.stats.dur-1) + float64(mshTreeMem)) / float64(sgm.stats.dur)
 
-			if config.ConfigRuntime.Msh.ShowResourceUsage {
+			if config.ConfigRuntime().Msh.ShowResourceUsage {
 				memInfo, _ := mem.VirtualMemory()
 				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "cpu avg: %7.3f %% cpu now: %7.3f %%  -  mem avg: %7.3f %% mem now: %7.3f %% (of %4d MB) = %7.3f MB",
 					sgm.stats.usageCpu,
@@ -112,6 +113,13 @@ func sgmMgr() {
 				}
 			}
 
+			if servstats.Stats.PersistError != nil && servstats.Stats.ConnCount > 0 {
+				logMsh := servctrl.TellRaw("alert", "msh can't write its config/state files: check msh log", "sgmMgr")
+				if logMsh != nil {
+					logMsh.Log(true)
+				}
+			}
+
 			if len(sgm.push.messages) != 0 && servstats.Stats.ConnCount > 0 {
 				for _, m := range sgm.push.messages {
 					logMsh := servctrl.TellRaw("message", m, "sgmMgr")
@@ -166,45 +174,45 @@ func sgmMgr() {
 				sgm.push.verCheck = verCheck
 
 				// override ConfigRuntime variables to display deprecated error message in motd
-				config.ConfigRuntime.Msh.InfoHibernation = "                   §fserver status:\n                   §b§lHIBERNATING\n                   §b§cmsh version DEPRECATED"
-				config.ConfigRuntime.Msh.InfoStarting = "                   §fserver status:\n                    §6§lWARMING UP\n                   §b§cmsh version DEPRECATED"
+				config.ConfigRuntime().Msh.InfoHibernation = "                   §fserver status:\n                   §b§lHIBERNATING\n                   §b§cmsh version DEPRECATED"
+				config.ConfigRuntime().Msh.InfoStarting = "                   §fserver status:\n                    §6§lWARMING UP\n                   §b§cmsh version DEPRECATED"
 
 			case "upd": // local version to update
-				if config.ConfigRuntime.Msh.NotifyUpdate {
+				if config.ConfigRuntime().Msh.NotifyUpdate {
 					verCheck := fmt.Sprintf("msh (%s) can be updated: visit github to update to %s!", MshVersion, resJson.Official.V)
 					errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_VERSION, verCheck)
 					sgm.push.verCheck = verCheck
 				}
 
 			case "off": // local version is official
-				if config.ConfigRuntime.Msh.NotifyUpdate {
+				if config.ConfigRuntime().Msh.NotifyUpdate {
 					verCheck := fmt.Sprintf("msh (%s) is updated", MshVersion)
 					errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, verCheck)
 					sgm.push.verCheck = verCheck
 				}
 
 			case "dev": // local version is a developement version
-				if config.ConfigRuntime.Msh.NotifyUpdate {
+				if config.ConfigRuntime().Msh.NotifyUpdate {
 					verCheck := fmt.Sprintf("msh (%s) is running a dev release", MshVersion)
 					errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_VERSION, verCheck)
 					sgm.push.verCheck = verCheck
 				}
 
 			case "uno": // local version is unofficial
-				if config.ConfigRuntime.Msh.NotifyUpdate {
+				if config.ConfigRuntime().Msh.NotifyUpdate {
 					verCheck := fmt.Sprintf("msh (%s) is running an unofficial release", MshVersion)
 					errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_VERSION, verCheck)
 					sgm.push.verCheck = verCheck
 				}
 
 			default: // an error occurred
-				if config.ConfigRuntime.Msh.NotifyUpdate {
+				if config.ConfigRuntime().Msh.NotifyUpdate {
 					errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_VERSION, "invalid version result from server")
 				}
 			}
 
 			// log response messages
-			if config.ConfigRuntime.Msh.NotifyMessage {
+			if config.ConfigRuntime().Msh.NotifyMessage {
 				for _, m := range resJson.Messages {
 					errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "message from the moon: %s", m)
 				}
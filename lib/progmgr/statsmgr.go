@@ -0,0 +1,115 @@
+package progmgr
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/notif"
+	"msh/lib/servctrl"
+	"msh/lib/servstats"
+	"msh/lib/utility"
+)
+
+// statsMgr periodically writes a stats snapshot to StatsFile.
+//
+// If StatsFile is not specified this func just returns.
+//
+// [goroutine]
+func statsMgr() {
+	if config.ConfigRuntime().Msh.StatsFile == "" {
+		return
+	}
+
+	interval := config.ConfigRuntime().Msh.StatsFileInterval
+	if interval <= 0 {
+		interval = 60
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "writing stats snapshot to %s every %d seconds", config.ConfigRuntime().Msh.StatsFile, interval)
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	for {
+		logMsh := writeStatsFile(config.ConfigRuntime().Msh.StatsFile, buildStatsSnapshot())
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+
+		<-ticker.C
+	}
+}
+
+// buildStatsSnapshot returns StatsSnapshot struct containing current stats
+func buildStatsSnapshot() *model.StatsSnapshot {
+	snap := &model.StatsSnapshot{}
+
+	snap.Time = time.Now().Format(time.RFC3339)
+	snap.Status = servstats.Stats.StatusName()
+	snap.Suspended = servstats.Stats.Suspended
+	snap.Players, snap.ConnPeak = servstats.Stats.Conns()
+	snap.LoadProgress = servstats.Stats.LoadProgress
+	if servstats.Stats.MajorError != nil {
+		snap.MajorError = servstats.Stats.MajorError.Mex
+	}
+	if servstats.Stats.CrashError != nil {
+		snap.CrashError = servstats.Stats.CrashError.Mex
+	}
+	snap.MshUptime = utility.RoundSec(time.Since(msh.startTime))
+	snap.TermUptime = servctrl.TermUpTime()
+	snap.HibeDur = msh.hibeDur
+	snap.ServCpu, snap.ServMem, snap.ServCpuAvg, snap.ServMemAvg = servUsage.get()
+	snap.Handlers = int(atomic.LoadInt32(&servstats.Stats.Handlers))
+	snap.OomCount = int(atomic.LoadInt32(&servstats.Stats.OomCount))
+	snap.NotifQueue = notif.QueueDepth()
+	snap.MshPort = config.MshPort
+	snap.WakeCount = servstats.Stats.WakeCount
+	snap.BytesToClients = atomic.LoadInt64(&servstats.Stats.BytesToClientsTotal)
+	snap.BytesToServer = atomic.LoadInt64(&servstats.Stats.BytesToServerTotal)
+	_, snap.ActiveTarget = servstats.Stats.Target()
+	snap.HibernateIn = -1
+	if servstats.Stats.Status == errco.SERVER_STATUS_ONLINE && servstats.Stats.ConnCount == 0 && !servstats.Stats.Suspended && !servstats.Stats.SoftStopped && servstats.Stats.FreezeTime.After(time.Now()) {
+		snap.HibernateIn = utility.RoundSec(time.Until(servstats.Stats.FreezeTime))
+	}
+
+	return snap
+}
+
+// writeStatsFile writes the stats snapshot to file.
+// Data is written to a temporary file that then replaces the stats file,
+// so that readers never get a partially written snapshot.
+func writeStatsFile(path string, snap *model.StatsSnapshot) *errco.MshLog {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+	}
+
+	// temporary file must be in the same folder as stats file for the rename to be atomic
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_STATS_FILE, err.Error())
+	}
+	defer os.Remove(f.Name()) // does nothing if rename was successful
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_STATS_FILE, err.Error())
+	}
+
+	err = f.Close()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_STATS_FILE, err.Error())
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_STATS_FILE, err.Error())
+	}
+
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/cpu"
@@ -28,9 +29,9 @@ func buildApi2Req(preTerm bool) *model.Api2Req {
 	reqJson.ProtV = protv
 
 	reqJson.Msh.V = MshVersion
-	reqJson.Msh.ID = config.ConfigRuntime.Msh.ID
+	reqJson.Msh.ID = config.ConfigRuntime().Msh.ID
 	reqJson.Msh.Uptime = utility.RoundSec(time.Since(msh.startTime))
-	reqJson.Msh.SuspendAllow = config.ConfigRuntime.Msh.SuspendAllow
+	reqJson.Msh.SuspendAllow = config.ConfigRuntime().Msh.SuspendAllow
 	reqJson.Msh.Sgm.Dur = sgm.stats.dur
 	reqJson.Msh.Sgm.HibeDur = sgm.stats.hibeDur
 	reqJson.Msh.Sgm.UsageCpu = sgm.stats.usageCpu
@@ -77,8 +78,8 @@ func buildApi2Req(preTerm bool) *model.Api2Req {
 	}
 
 	reqJson.Server.Uptime = servctrl.WarmUpTime()
-	reqJson.Server.V = config.ConfigRuntime.Server.Version
-	reqJson.Server.Prot = config.ConfigRuntime.Server.Protocol
+	reqJson.Server.V = config.ConfigRuntime().Server.Version
+	reqJson.Server.Prot = config.ConfigRuntime().Server.Protocol
 
 	return reqJson
 }
@@ -113,7 +114,7 @@ func sendApi2Req(url string, api2req *model.Api2Req) (*http.Response, *errco.Msh
 
 	// execute http request
 	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> mshc%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, string(reqByte))
-	client := &http.Client{Timeout: 4 * time.Second}
+	client := config.HttpClient(4 * time.Second)
 	res, err := client.Do(req)
 	if err != nil {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_VERSION, err.Error())
@@ -146,8 +147,11 @@ func readApi2Res(res *http.Response) (*model.Api2Res, *errco.MshLog) {
 }
 
 // getMshTreeStats returns current msh tree cpu/mem usage percent
+//
+// Minecraft server process tree usage (cpu percent, rss memory) is sampled and stored in servUsage.
 func getMshTreeStats() (float64, float64) {
 	var mshTreeCpu, mshTreeMem float64 = 0, 0
+	var servTreeCpu, servTreeRss float64 = 0, 0
 
 	// get msh process
 	mshProc, err := process.NewProcess(int32(os.Getpid()))
@@ -161,6 +165,14 @@ func getMshTreeStats() (float64, float64) {
 
 	pTracker.clean(treeP)
 
+	// get ms process tree pids (ms process tree is part of msh process tree)
+	servPids := map[int32]bool{}
+	if pid := servctrl.TermPid(); pid != -1 {
+		for _, p := range treeProc(&process.Process{Pid: int32(pid)}) {
+			servPids[p.Pid] = true
+		}
+	}
+
 	for _, p := range treeP {
 		pCpu, logMsh := cpuPercent(p)
 		if logMsh != nil {
@@ -176,11 +188,59 @@ func getMshTreeStats() (float64, float64) {
 		}
 		mshTreeMem += float64(pMem)
 
+		if servPids[p.Pid] {
+			servTreeCpu += pCpu
+			if memInfo, err := p.MemoryInfo(); err == nil {
+				servTreeRss += float64(memInfo.RSS) / (1 << 20)
+			}
+		}
 	}
 
+	servUsage.add(servTreeCpu, servTreeRss)
+
 	return mshTreeCpu, mshTreeMem
 }
 
+// servUsageWindow is the number of samples used for ms usage rolling average
+const servUsageWindow int = 60
+
+// servUsage keeps track of ms process tree resource usage
+// (values are 0 when ms is not running)
+var servUsage *servUsageStats = &servUsageStats{}
+
+type servUsageStats struct {
+	m       sync.Mutex
+	cpu     float64      // last cpu percent sample
+	rss     float64      // last rss memory sample (MB)
+	samples [][2]float64 // last servUsageWindow samples of cpu percent and rss memory
+}
+
+// add stores a new ms usage sample
+func (u *servUsageStats) add(cpu, rss float64) {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	u.cpu, u.rss = cpu, rss
+	u.samples = append(u.samples, [2]float64{cpu, rss})
+	if len(u.samples) > servUsageWindow {
+		u.samples = u.samples[1:]
+	}
+}
+
+// get returns the last ms usage sample and the rolling average (cpu percent, rss memory MB)
+func (u *servUsageStats) get() (float64, float64, float64, float64) {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	var cpuAvg, rssAvg float64
+	for _, s := range u.samples {
+		cpuAvg += s[0] / float64(len(u.samples))
+		rssAvg += s[1] / float64(len(u.samples))
+	}
+
+	return u.cpu, u.rss, cpuAvg, rssAvg
+}
+
 // treeProc returns the list of tree pids (with ppid)
 func treeProc(proc *process.Process) []*process.Process {
 	children, err := proc.Children()
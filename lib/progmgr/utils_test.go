@@ -4,6 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"msh/lib/config"
+	"msh/lib/model"
+
 	"github.com/shirou/gopsutil/process"
 )
 
@@ -61,3 +64,33 @@ func Test_Clean(t *testing.T) {
 		}
 	}
 }
+
+func Test_redactConfig(t *testing.T) {
+	c := &config.Configuration{}
+	c.Server.RconPassword = "secret"
+	c.Msh.ApiToken = "token"
+	c.Msh.MshPort = 25555
+	c.Msh.ConsoleTriggers = []model.ConsoleTrigger{{Regex: "joined", Action: "https://discord.com/api/webhooks/1/x"}}
+
+	r := redactConfig(c)
+
+	if r.Msh.ConsoleTriggers[0].Action != apiRedacted || r.Msh.ConsoleTriggers[0].Regex != "joined" {
+		t.Errorf("console trigger action not redacted: %+v", r.Msh.ConsoleTriggers[0])
+	}
+	if c.Msh.ConsoleTriggers[0].Action == apiRedacted {
+		t.Errorf("original console triggers modified")
+	}
+
+	if r.Server.RconPassword != apiRedacted || r.Msh.ApiToken != apiRedacted {
+		t.Errorf("secrets not redacted: %s, %s", r.Server.RconPassword, r.Msh.ApiToken)
+	}
+	if r.Msh.DiscordWebhookUrl != "" {
+		t.Errorf("empty field should not be redacted")
+	}
+	if r.Msh.MshPort != 25555 {
+		t.Errorf("non secret field changed")
+	}
+	if c.Server.RconPassword != "secret" {
+		t.Errorf("original config modified")
+	}
+}
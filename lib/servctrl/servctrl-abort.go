@@ -0,0 +1,138 @@
+package servctrl
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+const (
+	abortStartTimeout  = 10 * time.Second // time the killed ms process has to exit after a start abort
+	heldClientsTimeout = 10 * time.Second // max time msh waits for held clients to be disconnected after a start abort
+)
+
+var (
+	// startCtx is the context of the current ms cold start (dependencies, ms process, ready probe).
+	// It's canceled by AbortStart and CancelStartIfEmpty (protected by onlineM).
+	startCtx context.Context = context.Background()
+	// startCancel cancels startCtx (protected by onlineM)
+	startCancel context.CancelFunc = func() {}
+	// startAborted prevents new ms starts after AbortStart (msh is exiting)
+	startAborted atomic.Bool
+	// heldClients is the number of JOIN clients held while ms is starting
+	heldClients atomic.Int32
+)
+
+// newStartCtx sets and returns a new cancelable context for a ms cold start
+func newStartCtx() context.Context {
+	onlineM.Lock()
+	defer onlineM.Unlock()
+
+	startCtx, startCancel = context.WithCancel(context.Background())
+
+	return startCtx
+}
+
+// getStartCtx returns the context of the current ms cold start
+func getStartCtx() context.Context {
+	onlineM.Lock()
+	defer onlineM.Unlock()
+
+	return startCtx
+}
+
+// AbortStart aborts an in-progress ms cold start and prevents new ones (msh is exiting).
+//
+// Returns true if ms was starting and was killed.
+//
+// [blocking]
+func AbortStart() bool {
+	startAborted.Store(true)
+	return cancelStart()
+}
+
+// StartAborted returns true if ms starts were aborted by AbortStart (msh is exiting)
+func StartAborted() bool {
+	return startAborted.Load()
+}
+
+// HoldClient registers a JOIN client held while ms is starting
+func HoldClient() {
+	heldClients.Add(1)
+}
+
+// ReleaseClient unregisters a held JOIN client and returns the number of clients still held
+func ReleaseClient() int32 {
+	return heldClients.Add(-1)
+}
+
+// waitHeldClients waits for held clients to be released (they are disconnected after AbortStart)
+// for at most timeout.
+//
+// [blocking]
+func waitHeldClients(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for heldClients.Load() > 0 {
+		if time.Now().After(deadline) {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_NIL, "%d held clients not disconnected within %s", heldClients.Load(), timeout)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// CancelStartIfEmpty cancels an in-progress ms cold start if CancelStartIfEmpty is enabled.
+// It should be called when the last client waiting for ms leaves.
+//
+// Returns true if ms was starting and was killed.
+//
+// [blocking]
+func CancelStartIfEmpty() bool {
+	if !config.ConfigRuntime().Msh.CancelStartIfEmpty || servstats.Stats.Status != errco.SERVER_STATUS_STARTING {
+		return false
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "all waiting clients left, canceling minecraft server start")
+
+	return cancelStart()
+}
+
+// cancelStart cancels the start context and, if ms is starting, kills the ms process tree.
+// ms is not killed once it's online: the start context is canceled only while ms is starting
+// so that setOnline can't set ms online after the cancellation.
+//
+// Returns true if ms was starting and was killed.
+//
+// [blocking]
+func cancelStart() bool {
+	onlineM.Lock()
+	starting := servstats.Stats.Status == errco.SERVER_STATUS_STARTING
+	if starting || startAborted.Load() {
+		startCancel()
+	}
+	onlineM.Unlock()
+
+	if !starting || !ServTerm.IsActive {
+		return false
+	}
+
+	errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_NIL, "aborting minecraft server start...")
+
+	logMsh := killMS()
+	if logMsh != nil {
+		logMsh.Log(true)
+		return false
+	}
+
+	// wait for ms terminal to exit
+	deadline := time.Now().Add(abortStartTimeout)
+	for servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return true
+}
@@ -22,13 +22,17 @@ var ServTerm *servTerminal = &servTerminal{IsActive: false}
 
 // servTerminal is the minecraft server terminal
 type servTerminal struct {
-	IsActive  bool
-	Wg        sync.WaitGroup // used to wait terminal StdoutPipe/StderrPipe
-	startTime time.Time      // time at which minecraft server terminal was started
-	cmd       *exec.Cmd
-	outPipe   io.ReadCloser
-	errPipe   io.ReadCloser
-	inPipe    io.WriteCloser
+	IsActive      bool
+	Wg            sync.WaitGroup // used to wait terminal StdoutPipe/StderrPipe
+	exitWg        sync.WaitGroup // used to wait terminal exit and its teardown (post-stop command, dependencies stop)
+	startTime     time.Time      // time at which minecraft server terminal was started
+	stopConfirmed bool           // minecraft server output confirmed a clean stop
+	stopM         sync.Mutex     // used to prevent concurrent stop commands
+	stopping      bool           // a stop command was issued during the current ms run (protected by stopM)
+	cmd           *exec.Cmd
+	outPipe       io.ReadCloser
+	errPipe       io.ReadCloser
+	inPipe        io.WriteCloser
 }
 
 // lastOut is a channel used to communicate the last line got from the printer function
@@ -103,6 +107,16 @@ func TellRaw(reason, text, origin string) *errco.MshLog {
 	return nil
 }
 
+// TermPid returns the pid of minecraft server terminal process.
+// If ms terminal is not running returns -1.
+func TermPid() int {
+	if !ServTerm.IsActive || ServTerm.cmd == nil || ServTerm.cmd.Process == nil {
+		return -1
+	}
+
+	return ServTerm.cmd.Process.Pid
+}
+
 // TermUpTime returns the current minecraft server terminal uptime.
 // If ms terminal is not running returns -1.
 func TermUpTime() int {
@@ -113,6 +127,34 @@ func TermUpTime() int {
 	return utility.RoundSec(time.Since(ServTerm.startTime))
 }
 
+// CheckMinUptime checks if minecraft server has been running long enough to allow a manual stop.
+//
+// If MinUptimeBeforeStop is disabled or minimum uptime is reached, returns nil
+func CheckMinUptime() *errco.MshLog {
+	tut := TermUpTime()
+	if tut == -1 || tut >= config.ConfigRuntime().Msh.MinUptimeBeforeStop {
+		return nil
+	}
+
+	return errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_MSH_MUST_WAIT, "minecraft server started %ds ago, minimum uptime (%ds) not reached", tut, config.ConfigRuntime().Msh.MinUptimeBeforeStop)
+}
+
+// HibernationCooldown returns the seconds left before minecraft server is allowed to be warmed again.
+//
+// If MinHibernationSeconds is disabled, ms is not offline or minimum hibernation is reached, returns 0
+func HibernationCooldown() int {
+	if servstats.Stats.Status != errco.SERVER_STATUS_OFFLINE {
+		return 0
+	}
+
+	left := config.ConfigRuntime().Msh.MinHibernationSeconds - utility.RoundSec(time.Since(servstats.Stats.HibernateTime))
+	if left < 0 {
+		return 0
+	}
+
+	return left
+}
+
 // WarmUpTime returns the current minecraft server warmed uptime.
 // If ms is not warm returns -1.
 func WarmUpTime() int {
@@ -125,7 +167,7 @@ func WarmUpTime() int {
 
 // CheckMSWarm checks if minecraft server is warm and it's possible to interact with it.
 //
-// Checks if there is no major error, terminal is active, ms status is online and ms process not suspended.
+// Checks if there is no major error, terminal is active, ms status is online and ms process not suspended/soft stopped.
 //
 // If ms is warm and interactable, returns nil
 func CheckMSWarm() *errco.MshLog {
@@ -138,6 +180,8 @@ func CheckMSWarm() *errco.MshLog {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server not online")
 	case servstats.Stats.Suspended:
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_SUSPENDED, "minecraft server is suspended")
+	case servstats.Stats.SoftStopped:
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_SOFT_STOPPED, "minecraft server is soft stopped")
 	}
 
 	return nil
@@ -164,20 +208,67 @@ func termStart() *errco.MshLog {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TERMINAL_START, err.Error())
 	}
 
+	// pin minecraft server process to the specified cpu cores
+	if len(config.ConfigRuntime().Server.CpuAffinity) > 0 {
+		logMsh := opsys.ProcSetAffinity(uint32(ServTerm.cmd.Process.Pid), config.ConfigRuntime().Server.CpuAffinity)
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+
+	// throttle minecraft server disk I/O during startup
+	if config.ConfigRuntime().Server.StartupIoThrottle > 0 {
+		logMsh := opsys.ProcTreeIoThrottle(uint32(ServTerm.cmd.Process.Pid), true)
+		if logMsh != nil {
+			logMsh.Log(true)
+		} else {
+			go ioThrottleRelease(uint32(ServTerm.cmd.Process.Pid))
+		}
+	}
+
+	// set synchronously so that a warm issued after termStart returns doesn't cold start ms again
+	ServTerm.IsActive = true
+	servstats.Stats.Status = errco.SERVER_STATUS_STARTING
+	servstats.Stats.CrashError = nil
+
+	ServTerm.exitWg.Add(1)
 	go waitForExit()
 
 	return nil
 }
 
+// ioThrottleRelease releases minecraft server disk I/O throttle
+// when minecraft server is online or StartupIoThrottle seconds have passed.
+// [goroutine]
+func ioThrottleRelease(pid uint32) {
+	deadline := time.Now().Add(time.Duration(config.ConfigRuntime().Server.StartupIoThrottle) * time.Second)
+
+	for servstats.Stats.Status != errco.SERVER_STATUS_ONLINE && time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+	}
+
+	// minecraft server terminal already exited
+	if !ServTerm.IsActive {
+		return
+	}
+
+	logMsh := opsys.ProcTreeIoThrottle(pid, false)
+	if logMsh != nil {
+		logMsh.Log(true)
+	}
+}
+
 // termLoad loads cmd/pipes into ServTerm
 func termLoad() *errco.MshLog {
 	// set terminal cmd
-	command, logMsh := config.ConfigRuntime.BuildCommandStartServer()
+	command, logMsh := config.ConfigRuntime().BuildCommandStartServer()
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
 	ServTerm.cmd = exec.Command(command[0], command[1:]...)
-	ServTerm.cmd.Dir = config.ConfigRuntime.Server.Folder
+	if config.ConfigRuntime().Server.Type != "docker" {
+		ServTerm.cmd.Dir = config.ConfigRuntime().Server.Folder
+	}
 
 	// launch as new process group so that signals (ex: SIGINT) are sent to msh
 	// (not relayed to the java server child process)
@@ -222,6 +313,7 @@ func printerOutErr() {
 			line = scanner.Text()
 
 			errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, line)
+			addOutTail(line)
 
 			// communicate to lastOut so that func Execute() can return the output of the command.
 			// must be a non-blocking select or it might cause hanging
@@ -230,26 +322,33 @@ func printerOutErr() {
 			default:
 			}
 
+			// fire console triggers matching the line
+			consoleTrigger(line)
+
+			// check for out of memory errors
+			searchOom(line)
+
 			switch servstats.Stats.Status {
 
 			case errco.SERVER_STATUS_STARTING:
 				// for modded server terminal compatibility, use separate check for "INFO" and flag-word
 				// using only "INFO" and not "[Server thread/INFO]"" because paper minecraft servers don't use "[Server thread/INFO]"
 
-				// "Preparing spawn area: " -> update ServStats.LoadProgress
-				if strings.Contains(line, "INFO") && strings.Contains(line, "Preparing spawn area: ") {
-					servstats.Stats.LoadProgress = strings.Split(strings.Split(line, "Preparing spawn area: ")[1], "\n")[0]
+				// recognizable loading stage -> update ServStats.LoadProgress
+				if strings.Contains(line, "INFO") {
+					if progress, ok := searchLoadProgress(line); ok {
+						servstats.Stats.LoadProgress = progress
+					}
 				}
 
-				// ": Done (" -> set ServStats.Status = ONLINE
-				// using ": Done (" instead of "Done" to avoid false positives (issue #112)
-				if strings.Contains(line, "INFO") && strings.Contains(line, ": Done (") {
-					servstats.Stats.Status = errco.SERVER_STATUS_ONLINE
-					errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS ONLINE!")
+				// StartupDoneRegex (default: ": Done (...)! For help") -> set ServStats.Status = ONLINE
+				if re := config.StartupDoneRegex(); re != nil && re.MatchString(line) {
+					setOnline()
+				}
 
-					// schedule soft freeze of ms
-					// (if no players connect the server will shutdown)
-					FreezeMSSchedule()
+				// bedrock server: "[2023-05-01 12:00:00:000 INFO] Server started." -> set ServStats.Status = ONLINE
+				if config.ConfigRuntime().Server.Edition == "bedrock" && strings.Contains(line, "INFO] Server started.") {
+					setOnline()
 				}
 
 			case errco.SERVER_STATUS_ONLINE:
@@ -280,6 +379,7 @@ func printerOutErr() {
 					switch {
 					// player leaves the server
 					case strings.Contains(lineContent, "lost connection:"): // "lost connection" is more general compared to "left the game" (even too much: player might write it in chat -> added ":")
+						resetPlayerCountCache()
 						FreezeMSSchedule()
 
 					// the server is stopping
@@ -287,6 +387,12 @@ func printerOutErr() {
 						servstats.Stats.Status = errco.SERVER_STATUS_STOPPING
 						errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STOPPING!")
 					}
+
+					// player joins/leaves the server
+					if player, join, ok := searchPlayerEvent(lineContent); ok {
+						resetPlayerCountCache()
+						playerEvent(player, join)
+					}
 				}
 
 				if strings.Contains(lineHeader, "ERROR") {
@@ -301,6 +407,13 @@ func printerOutErr() {
 						servstats.Stats.SetMajorError(LogMsh)
 					}
 				}
+
+			case errco.SERVER_STATUS_STOPPING:
+				// minecraft server output confirms that the stop is clean
+				if re := config.StopConfirmRegex(); !ServTerm.stopConfirmed && re != nil && re.MatchString(line) {
+					ServTerm.stopConfirmed = true
+					errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server stop confirmed")
+				}
 			}
 		}
 	}()
@@ -318,6 +431,10 @@ func printerOutErr() {
 			line = scanner.Text()
 
 			errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, line)
+			addOutTail(line)
+
+			// check for out of memory errors
+			searchOom(line)
 		}
 	}()
 }
@@ -334,11 +451,19 @@ func printerOutErr() {
 func waitForExit() {
 	ServTerm.IsActive = true
 	ServTerm.startTime = time.Now()
+	ServTerm.stopConfirmed = false
+	ServTerm.stopM.Lock()
+	ServTerm.stopping = false
+	ServTerm.stopM.Unlock()
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal started")
 
 	servstats.Stats.Status = errco.SERVER_STATUS_STARTING
 	servstats.Stats.Suspended = false
-	servstats.Stats.ConnCount = 0
+	servstats.Stats.SoftStopped = false
+	servstats.Stats.BackendInvalid = false
+	oomDetected.Store(false)
+	resetOutTail()
+	servstats.Stats.ConnReset()
 	servstats.Stats.LoadProgress = "0%"
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STARTING!")
 
@@ -346,10 +471,29 @@ func waitForExit() {
 	stopSuspendRefresherC := make(chan bool, 1)
 	go suspendRefresher(stopSuspendRefresherC)
 
+	// start stdin keepalive
+	stopStdinKeepAliveC := make(chan bool, 1)
+	go stdinKeepAlive(stopStdinKeepAliveC)
+
+	// start ready command probe
+	go readyProbe()
+
 	// wait for server process to finish
 	ServTerm.Wg.Wait()  // wait terminal StdoutPipe/StderrPipe to exit
 	ServTerm.cmd.Wait() // wait process (to avoid defunct java server process)
 
+	// the stop was requested if msh issued a stop command/aborted the start or ms logged that it's stopping
+	// (ex: "stop" executed in game)
+	ServTerm.stopM.Lock()
+	stopRequested := ServTerm.stopping || startAborted.Load() || getStartCtx().Err() != nil || servstats.Stats.Status == errco.SERVER_STATUS_STOPPING
+	ServTerm.stopping = false
+	ServTerm.stopM.Unlock()
+
+	// stop stdin keepalive before closing stdin pipe
+	stopStdinKeepAliveC <- true
+
+	// stdin pipe is closed only after the process exited
+	// (some minecraft servers stop when stdin reaches EOF)
 	ServTerm.outPipe.Close()
 	ServTerm.errPipe.Close()
 	ServTerm.inPipe.Close()
@@ -357,14 +501,76 @@ func waitForExit() {
 	// stop suspension refresher
 	stopSuspendRefresherC <- true
 
+	// no ms warm until post-stop command and dependencies stop are done
+	// (warms fail fast while postStopRunning is set)
+	postStopRunning.Store(true)
+	startM.Lock()
+
 	servstats.Stats.Status = errco.SERVER_STATUS_OFFLINE
 	servstats.Stats.Suspended = false
-	servstats.Stats.ConnCount = 0
+	servstats.Stats.SoftStopped = false
+	servstats.Stats.ConnReset()
 	servstats.Stats.LoadProgress = "0%"
+	servstats.Stats.HibernateTime = time.Now()
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS OFFLINE!")
 
 	ServTerm.IsActive = false
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal exited")
+
+	// the exited ms run is read before a new ms run can start (startM is released)
+	exitCode := ServTerm.cmd.ProcessState.ExitCode()
+	uptime := time.Since(ServTerm.startTime)
+	oom := oomDetected.Load()
+	tail := outTailString()
+
+	// run post-stop command and stop dependencies after ms
+	postStopHook()
+	stopDependencies()
+
+	postStopRunning.Store(false)
+	startM.Unlock()
+	ServTerm.exitWg.Done()
+
+	// handle out of memory error that occurred during this run
+	if oom {
+		go oomRestart()
+	}
+
+	// handle unexpected exit
+	handleExit(exitCode, stopRequested, uptime, oom, tail)
+}
+
+// stdinKeepAlive writes an empty line to ms terminal stdin every StdinKeepAlive seconds.
+//
+// If StdinKeepAlive is disabled this func just returns.
+//
+// [goroutine stoppable]
+func stdinKeepAlive(stop chan bool) {
+	if config.ConfigRuntime().Server.StdinKeepAlive <= 0 {
+		<-stop
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(config.ConfigRuntime().Server.StdinKeepAlive) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			// suspended ms process can't read stdin
+			if servstats.Stats.Suspended {
+				continue
+			}
+
+			_, err := ServTerm.inPipe.Write([]byte("\n"))
+			if err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PIPE_INPUT_WRITE, "stdin keepalive: %s", err.Error())
+			}
+		}
+	}
 }
 
 // suspendRefresher refreshes ms suspension by warming and freezing the server every set amount of time.
@@ -373,17 +579,17 @@ func waitForExit() {
 //
 // [goroutine stoppable]
 func suspendRefresher(stop chan bool) {
-	if !config.ConfigRuntime.Msh.SuspendAllow {
+	if !config.ConfigRuntime().Msh.SuspendAllow {
 		return
 	}
 
-	if config.ConfigRuntime.Msh.SuspendRefresh <= 0 {
+	if config.ConfigRuntime().Msh.SuspendRefresh <= 0 {
 		return
 	}
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "suspension refresher is starting")
 
-	ticker := time.NewTicker(time.Duration(config.ConfigRuntime.Msh.SuspendRefresh) * time.Second)
+	ticker := time.NewTicker(time.Duration(config.ConfigRuntime().Msh.SuspendRefresh) * time.Second)
 
 	for {
 		select {
@@ -407,6 +613,9 @@ func suspendRefresher(stop chan bool) {
 				continue
 			}
 
+			// the refresh does not reset the suspension time (SuspendStopAfter)
+			suspendTime := servstats.Stats.SuspendTime
+
 			// warm ms unsuspending process
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "suspension refresh will warm minecraft server...")
 			WarmMS()
@@ -417,6 +626,9 @@ func suspendRefresher(stop chan bool) {
 			// freeze ms suspending process (softly in case a player has joined in the meantime)
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "suspension refresh will freeze minecraft server...")
 			FreezeMS(false)
+			if servstats.Stats.Suspended {
+				servstats.Stats.SuspendTime = suspendTime
+			}
 		}
 	}
 }
@@ -0,0 +1,152 @@
+package servctrl
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+const (
+	outTailSize       = 10               // number of ms output lines kept to be reported on crash
+	crashStableUptime = 10 * time.Minute // ms uptime after which the crash restart attempts are reset
+	crashBackoffBase  = 5 * time.Second  // delay before the first crash restart attempt (doubled at each attempt)
+	crashBackoffMax   = 5 * time.Minute  // maximum delay before a crash restart attempt
+)
+
+var (
+	// outTail contains the last ms output lines (stdout and stderr) of the current ms run
+	outTail = struct {
+		m     sync.Mutex
+		lines []string
+	}{}
+
+	// crashM protects crashAttempts and crashGiveUp
+	crashM sync.Mutex
+
+	// crashAttempts is the number of consecutive crash restart attempts
+	// (reset when ms runs for crashStableUptime or when ms is started manually)
+	crashAttempts int = 0
+
+	// crashGiveUp is the major error set when crash restart attempts run out (nil if not set)
+	crashGiveUp *errco.MshLog
+)
+
+// addOutTail adds a ms output line to outTail
+func addOutTail(line string) {
+	outTail.m.Lock()
+	defer outTail.m.Unlock()
+
+	outTail.lines = append(outTail.lines, line)
+	if len(outTail.lines) > outTailSize {
+		outTail.lines = outTail.lines[len(outTail.lines)-outTailSize:]
+	}
+}
+
+// resetOutTail clears outTail (at the start of a new ms run)
+func resetOutTail() {
+	outTail.m.Lock()
+	defer outTail.m.Unlock()
+
+	outTail.lines = nil
+}
+
+// outTailString returns the last ms output lines separated by \n
+func outTailString() string {
+	outTail.m.Lock()
+	defer outTail.m.Unlock()
+
+	return strings.Join(outTail.lines, "\n")
+}
+
+// crashBackoff returns the delay before the crash restart attempt number n (starting from 1)
+func crashBackoff(n int) time.Duration {
+	d := crashBackoffBase
+	for i := 1; i < n && d < crashBackoffMax; i++ {
+		d *= 2
+	}
+	if d > crashBackoffMax {
+		d = crashBackoffMax
+	}
+	return d
+}
+
+// handleExit is called when the ms process exits: if msh did not request the stop and the exit code is not 0, the exit is a crash.
+// On crash, servstats.Stats.CrashError is set and, if RestartOnCrash is enabled, ms is restarted (with backoff)
+// up to MaxRestartAttempts times: when the attempts run out the crash is set as major error, with the last ms output lines
+// (cleared by ClearCrashGiveUp).
+//
+// The exited ms run is described by its exit code, uptime, out of memory error and last output lines
+// (a new ms run might have already started when handleExit is called).
+func handleExit(exitCode int, stopRequested bool, uptime time.Duration, oom bool, tail string) {
+	if stopRequested {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server stopped (exit code %d)", exitCode)
+		return
+	}
+
+	// ms stopped by itself (ex: stop command issued by a player)
+	if exitCode == 0 {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server stopped by itself (exit code 0)")
+		return
+	}
+
+	// out of memory errors are handled by OnServerOom
+	if oom && config.ConfigRuntime().Msh.OnServerOom != "alert" {
+		return
+	}
+
+	servstats.Stats.CrashError = errco.NewLogln(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_SERVER_CRASH, "MINECRAFT SERVER CRASHED! (exit code %d, uptime %s)\nlast output lines:\n%s", exitCode, uptime.Round(time.Second), tail)
+
+	if !config.ConfigRuntime().Msh.RestartOnCrash {
+		return
+	}
+
+	crashM.Lock()
+	defer crashM.Unlock()
+
+	// a ms run longer than crashStableUptime is not a rapid crash
+	if uptime >= crashStableUptime {
+		crashAttempts = 0
+	}
+
+	if crashAttempts >= config.ConfigRuntime().Msh.MaxRestartAttempts {
+		crashGiveUp = errco.NewLog(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_SERVER_CRASH, "minecraft server crashed %d times in a row (exit code %d): %s", crashAttempts+1, exitCode, tail)
+		servstats.Stats.SetMajorError(crashGiveUp)
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_SERVER_CRASH, "minecraft server keeps crashing, giving up after %d restart attempts", crashAttempts)
+		return
+	}
+	crashAttempts++
+
+	// [goroutine]
+	go func(attempt int) {
+		delay := crashBackoff(attempt)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "restarting minecraft server in %s (attempt %d/%d)...", delay, attempt, config.ConfigRuntime().Msh.MaxRestartAttempts)
+		time.Sleep(delay)
+
+		if logMsh := WarmMS(); logMsh != nil {
+			logMsh.Log(true)
+		}
+	}(crashAttempts)
+}
+
+// ClearCrashGiveUp clears the major error set when crash restart attempts ran out
+// and resets the crash restart attempts (called before a manual ms start).
+func ClearCrashGiveUp() {
+	crashM.Lock()
+	defer crashM.Unlock()
+
+	crashAttempts = 0
+
+	if crashGiveUp == nil {
+		return
+	}
+
+	if servstats.Stats.MajorError == crashGiveUp {
+		servstats.Stats.MajorError = nil
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server crash major error cleared by manual start")
+	}
+	crashGiveUp = nil
+}
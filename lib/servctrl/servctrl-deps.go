@@ -0,0 +1,136 @@
+package servctrl
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/shlex"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+)
+
+var (
+	// depsM protects depsStarted
+	depsM sync.Mutex
+
+	// depsStarted contains the dependencies started by msh (in start order).
+	// The dependencies are stored (not indexes of the config) as a config reload might change them.
+	depsStarted []model.Dependency
+)
+
+// startDependencies starts ms dependencies in config order and waits for each to be ready.
+// Dependencies still running from a previous start are not started again.
+// If a dependency fails or ctx is canceled, the dependencies already started are stopped.
+// [blocking]
+func startDependencies(ctx context.Context) *errco.MshLog {
+	depsM.Lock()
+	defer depsM.Unlock()
+
+	for _, dep := range config.ConfigRuntime().Msh.Dependencies {
+		if depStarted(dep) {
+			continue
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "starting dependency %s...", dep.Name)
+
+		logMsh := runDependencyCommand(ctx, dep.StartCommand)
+		if logMsh != nil {
+			stopDependenciesLocked()
+			return logMsh.AddTrace()
+		}
+		depsStarted = append(depsStarted, dep)
+
+		if dep.ReadyAddress == "" {
+			continue
+		}
+
+		// wait for dependency to accept connections
+		timeout := dep.ReadyTimeout
+		if timeout <= 0 {
+			timeout = 30
+		}
+		deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+		for {
+			conn, err := net.DialTimeout("tcp", dep.ReadyAddress, time.Second)
+			if err == nil {
+				conn.Close()
+				break
+			}
+
+			if time.Now().After(deadline) {
+				stopDependenciesLocked()
+				return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_DEPENDENCY, "dependency %s not ready after %d seconds (%s)", dep.Name, timeout, err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				stopDependenciesLocked()
+				return errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_DEPENDENCY, "dependency %s start aborted", dep.Name)
+			case <-time.After(time.Second):
+			}
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "dependency %s is ready", dep.Name)
+	}
+
+	return nil
+}
+
+// stopDependencies stops the dependencies started by msh in reverse start order
+// [blocking]
+func stopDependencies() {
+	depsM.Lock()
+	defer depsM.Unlock()
+
+	stopDependenciesLocked()
+}
+
+// stopDependenciesLocked stops the dependencies started by msh in reverse start order (depsM must be held)
+func stopDependenciesLocked() {
+	for ; len(depsStarted) > 0; depsStarted = depsStarted[:len(depsStarted)-1] {
+		dep := depsStarted[len(depsStarted)-1]
+
+		if dep.StopCommand == "" {
+			continue
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "stopping dependency %s...", dep.Name)
+
+		logMsh := runDependencyCommand(context.Background(), dep.StopCommand)
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+}
+
+// depStarted returns true if dep was started by msh and is still running (depsM must be held)
+func depStarted(dep model.Dependency) bool {
+	for _, d := range depsStarted {
+		if d == dep {
+			return true
+		}
+	}
+	return false
+}
+
+// runDependencyCommand executes a dependency start/stop command and waits for it to exit
+// (the command is killed if ctx is canceled)
+func runDependencyCommand(ctx context.Context, command string) *errco.MshLog {
+	args, err := shlex.Split(command)
+	if err != nil || len(args) == 0 {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_DEPENDENCY, "dependency command is invalid: %s", command)
+	}
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_DEPENDENCY, "dependency command failed: %s (%s)", err.Error(), strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package servctrl
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// dockerStop stops the ms docker container (docker kills it if it does not stop within the stop timeout).
+// [non-blocking]
+func dockerStop() *errco.MshLog {
+	timeout := 60
+	if config.ConfigRuntime().Commands.StopServerAllowKill > 0 {
+		// msh kills the container after StopServerAllowKill seconds (and a world save), let docker wait longer
+		timeout = config.ConfigRuntime().Commands.StopServerAllowKill + 30
+	}
+
+	cmd := exec.Command("docker", "stop", "--time", strconv.Itoa(timeout), config.ConfigRuntime().Server.Container)
+	err := cmd.Start()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, "docker stop: %s", err.Error())
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "stopping docker container %s", config.ConfigRuntime().Server.Container)
+
+	// [goroutine]
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, "docker stop: %s", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// dockerKill kills the ms docker container
+func dockerKill() *errco.MshLog {
+	out, err := exec.Command("docker", "kill", config.ConfigRuntime().Server.Container).CombinedOutput()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_DOCKER, "docker kill: %s (%s)", err.Error(), strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
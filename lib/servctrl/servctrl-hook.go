@@ -0,0 +1,94 @@
+package servctrl
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// hookM serializes the pre-start and post-stop commands
+// (ms is not started while the post-stop command of the previous run is executing)
+var hookM sync.Mutex
+
+// preStartHook executes the PreStart command.
+// If PreStart is not specified this func just returns.
+//
+// [blocking]
+func preStartHook() *errco.MshLog {
+	hookM.Lock()
+	defer hookM.Unlock()
+
+	if config.ConfigRuntime().Commands.PreStart == "" {
+		return nil
+	}
+
+	logMsh := runHookCommand("pre-start", config.ConfigRuntime().Commands.PreStart)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// postStopHook executes the PostStop command (a failure is just logged).
+// If PostStop is not specified this func just returns.
+//
+// [blocking]
+func postStopHook() {
+	hookM.Lock()
+	defer hookM.Unlock()
+
+	if config.ConfigRuntime().Commands.PostStop == "" {
+		return
+	}
+
+	logMsh := runHookCommand("post-stop", config.ConfigRuntime().Commands.PostStop)
+	if logMsh != nil {
+		logMsh.Log(true)
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_HOOK_COMMAND, "post-stop command failed, check its output")
+	}
+}
+
+// runHookCommand executes a hook command in the server folder and waits for it to exit.
+// The command output is written to msh log.
+func runHookCommand(name, command string) *errco.MshLog {
+	args := config.ConfigRuntime().BuildCommand(command)
+	if len(args) == 0 {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_HOOK_COMMAND, "%s command is invalid: %s", name, command)
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "executing %s command: %s", name, strings.Join(args, " "))
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = config.ConfigRuntime().Server.Folder
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_HOOK_COMMAND, "%s command: %s", name, err.Error())
+	}
+	cmd.Stderr = cmd.Stdout
+
+	err = cmd.Start()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_HOOK_COMMAND, "%s command could not start: %s", name, err.Error())
+	}
+
+	// stream command output to msh log
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "%s: %s", name, scanner.Text())
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_HOOK_COMMAND, "%s command failed: %s", name, err.Error())
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%s command completed", name)
+
+	return nil
+}
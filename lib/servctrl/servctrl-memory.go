@@ -0,0 +1,57 @@
+package servctrl
+
+import (
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/opsys"
+	"msh/lib/servstats"
+)
+
+const (
+	memCheckInterval = 20 * time.Second // interval at which system memory usage is checked
+	memCheckCount    = 3                // consecutive checks above HibernateOnMemPercent after which empty ms is hibernated
+)
+
+// MemoryMgr hibernates empty ms early when system memory usage stays above HibernateOnMemPercent
+// for memCheckCount consecutive checks.
+// (the TimeBeforeStoppingEmptyServer freeze is still scheduled: whichever fires first hibernates ms)
+//
+// [goroutine]
+func MemoryMgr() {
+	var above int // consecutive checks above HibernateOnMemPercent
+
+	for range time.NewTicker(memCheckInterval).C {
+		if config.ConfigRuntime().Msh.HibernateOnMemPercent <= 0 ||
+			servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.Suspended || servstats.Stats.SoftStopped {
+			above = 0
+			continue
+		}
+
+		memPercent, logMsh := opsys.SysMemPercent()
+		if logMsh != nil {
+			logMsh.Log(true)
+			above = 0
+			continue
+		}
+
+		if memPercent < float64(config.ConfigRuntime().Msh.HibernateOnMemPercent) {
+			above = 0
+			continue
+		}
+
+		above++
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "system memory usage %.1f%% is above %d%% (%d/%d)", memPercent, config.ConfigRuntime().Msh.HibernateOnMemPercent, above, memCheckCount)
+
+		if above < memCheckCount || countPlayerSafe() != 0 {
+			continue
+		}
+
+		above = 0
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "system memory usage is above %d%% and minecraft server is empty, hibernating it", config.ConfigRuntime().Msh.HibernateOnMemPercent)
+		if logMsh := FreezeMS(false); logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+}
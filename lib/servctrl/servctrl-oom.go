@@ -0,0 +1,142 @@
+package servctrl
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shirou/gopsutil/mem"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/notif"
+	"msh/lib/servstats"
+)
+
+// minXmxMB is the minimum -Xmx (in MB) set by "lowermem" out of memory action
+const minXmxMB = 512
+
+var (
+	// oomRegex matches minecraft server output lines reporting an out of memory error
+	oomRegex = regexp.MustCompile(`java\.lang\.OutOfMemoryError`)
+
+	// xmxRegex matches the java maximum heap size parameter (ex: -Xmx1024M, -Xmx2G)
+	xmxRegex = regexp.MustCompile(`-Xmx(\d+)([kKmMgG]?)\b`)
+	// xmRegex matches a java heap size parameter (-Xmx or -Xms)
+	xmRegex = regexp.MustCompile(`^-Xm([xs])(\d+)([kKmMgG]?)$`)
+
+	// oomDetected is true if an out of memory error occurred during the current ms run
+	oomDetected atomic.Bool
+)
+
+// searchOom checks if a ms output line reports an out of memory error.
+// At the first out of memory error of a ms run, the error is logged and
+// (if OnServerOom is "restart" or "lowermem") ms is stopped so that it can be restarted when it exits.
+func searchOom(line string) {
+	if !oomRegex.MatchString(line) || oomDetected.Swap(true) {
+		return
+	}
+
+	atomic.AddInt32(&servstats.Stats.OomCount, 1)
+	errco.NewLogln(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_SERVER_OOM, "MINECRAFT SERVER RAN OUT OF MEMORY! (action: %s)", config.ConfigRuntime().Msh.OnServerOom)
+	notif.Discord("minecraft server ran out of memory (action: %s)", config.ConfigRuntime().Msh.OnServerOom)
+
+	if config.ConfigRuntime().Msh.OnServerOom == "alert" {
+		return
+	}
+
+	// the java process might survive the error in a broken state: stop it
+	if servstats.Stats.Status == errco.SERVER_STATUS_ONLINE {
+		go func() {
+			if logMsh := resumeStopMS(); logMsh != nil {
+				logMsh.Log(true)
+			}
+		}()
+	}
+}
+
+// oomRestart restarts ms after it exited because of an out of memory error.
+// If OnServerOom is "lowermem", -Xmx is lowered before the restart.
+//
+// If OnServerOom is "alert" this func does nothing.
+//
+// [goroutine]
+func oomRestart() {
+	switch config.ConfigRuntime().Msh.OnServerOom {
+	case "restart":
+	case "lowermem":
+		memInfo, err := mem.VirtualMemory()
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_SERVER_OOM, "could not read available memory: %s", err.Error())
+			break
+		}
+
+		param, ok := lowerXmx(config.ConfigRuntime().Commands.StartServerParam, memInfo.Available/1024/1024)
+		if ok {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SERVER_OOM, "lowering minecraft server memory: \"%s\" -> \"%s\"", config.ConfigRuntime().Commands.StartServerParam, param)
+			config.ConfigRuntime().Commands.StartServerParam = param
+		}
+	default:
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "restarting minecraft server after out of memory error...")
+	if logMsh := WarmMS(); logMsh != nil {
+		logMsh.Log(true)
+	}
+}
+
+// lowerXmx returns the start server parameters with a lower -Xmx, derived from the current -Xmx and
+// the available memory (in MB): the new value is 3/4 of the lower of the two, but not less than minXmxMB.
+// -Xms is capped to the new -Xmx.
+//
+// Returns false if -Xmx is not specified or can't be lowered.
+func lowerXmx(param string, availableMB uint64) (string, bool) {
+	match := xmxRegex.FindStringSubmatch(param)
+	if match == nil {
+		return param, false
+	}
+	xmx := memSizeMB(match[1], match[2])
+
+	newXmx := xmx
+	if availableMB < newXmx {
+		newXmx = availableMB
+	}
+	newXmx = newXmx * 3 / 4
+	if newXmx < minXmxMB {
+		newXmx = minXmxMB
+	}
+	if newXmx >= xmx {
+		return param, false
+	}
+
+	fields := strings.Fields(param)
+	for i, f := range fields {
+		if m := xmRegex.FindStringSubmatch(f); m != nil && (m[1] == "x" || memSizeMB(m[2], m[3]) > newXmx) {
+			fields[i] = fmt.Sprintf("-Xm%s%dM", m[1], newXmx)
+		}
+	}
+
+	return strings.Join(fields, " "), true
+}
+
+// memSizeMB converts a java memory size (ex: "1024", "M") to MB
+func memSizeMB(num, unit string) uint64 {
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	switch strings.ToLower(unit) {
+	case "k":
+		return n / 1024
+	case "m":
+		return n
+	case "g":
+		return n * 1024
+	default: // bytes
+		return n / 1024 / 1024
+	}
+}
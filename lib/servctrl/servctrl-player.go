@@ -0,0 +1,98 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/shlex"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/notif"
+	"msh/lib/servstats"
+)
+
+// playerLeaveDebounce is the time for which a player leave event is held back.
+// If the player joins again in the meantime, both leave and join events are dropped.
+const playerLeaveDebounce time.Duration = 10 * time.Second
+
+// pendingLeaves contains the held back player leave events
+var pendingLeaves = struct {
+	m sync.Mutex
+	t map[string]*time.Timer
+}{t: map[string]*time.Timer{}}
+
+// playerEvent handles a player join/leave event detected in the minecraft server output.
+// Leave events are debounced to ignore rapid reconnections.
+func playerEvent(player string, join bool) {
+	pendingLeaves.m.Lock()
+	defer pendingLeaves.m.Unlock()
+
+	if join {
+		// player reconnected before its leave event was fired
+		if t, ok := pendingLeaves.t[player]; ok && t.Stop() {
+			delete(pendingLeaves.t, player)
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "player %s reconnected, join/leave events ignored", player)
+			return
+		}
+
+		go runPlayerHook(config.ConfigRuntime().Msh.OnPlayerJoin, "join", player)
+		return
+	}
+
+	pendingLeaves.t[player] = time.AfterFunc(playerLeaveDebounce, func() {
+		pendingLeaves.m.Lock()
+		delete(pendingLeaves.t, player)
+		pendingLeaves.m.Unlock()
+
+		runPlayerHook(config.ConfigRuntime().Msh.OnPlayerLeave, "leave", player)
+	})
+}
+
+// runPlayerHook delivers a player event to the specified hook.
+//
+// If hook is a http(s) url, the event is posted as json.
+// Otherwise hook is executed as a command where <player>, <count> placeholders are replaced.
+func runPlayerHook(hook, event, player string) {
+	if hook == "" {
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "player %s event: %s", event, player)
+
+	count := servstats.Stats.ConnCount
+
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		body, err := json.Marshal(&model.PlayerEvent{Event: event, Player: player, Count: count})
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PLAYER_HOOK, err.Error())
+			return
+		}
+
+		logMsh := notif.PostJson(hook, body)
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+
+		return
+	}
+
+	hook = strings.ReplaceAll(hook, "<player>", player)
+	hook = strings.ReplaceAll(hook, "<count>", strconv.Itoa(count))
+
+	command, err := shlex.Split(hook)
+	if err != nil || len(command) == 0 {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PLAYER_HOOK, "player %s command is invalid: %s", event, hook)
+		return
+	}
+
+	out, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PLAYER_HOOK, "player %s command failed: %s (%s)", event, err.Error(), strings.TrimSpace(string(out)))
+	}
+}
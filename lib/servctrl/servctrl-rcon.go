@@ -0,0 +1,210 @@
+package servctrl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// source rcon packet types
+const (
+	rconTypeResponse int32 = 0
+	rconTypeCommand  int32 = 2
+	rconTypeAuth     int32 = 3
+)
+
+// rconTimeout is the timeout for rcon connection and each rcon exchange
+const rconTimeout = 5 * time.Second
+
+// joinWelcomeDelay is the time waited before executing JoinWelcome, so that the player is in game
+const joinWelcomeDelay = 3 * time.Second
+
+// welcomePlayerRegex matches the player names that can be used in JoinWelcome command
+// (a name is written to minecraft server console: it must not contain spaces or new lines)
+var welcomePlayerRegex = regexp.MustCompile(`^\w{3,16}$`)
+
+// whitelistListRegex matches the "whitelist list" command output
+// ex: "There are 2 whitelisted player(s): alice, bob", "There are 2 (out of 3 seen) whitelisted players:\nalice, bob"
+var whitelistListRegex = regexp.MustCompile(`(?s)whitelisted players?(?:\(s\))?:(.*)$`)
+
+// rconEnabled returns true if rcon port and password are set (by msh config or server.properties)
+func rconEnabled() bool {
+	return config.ConfigRuntime().Server.RconPort > 0 && config.ConfigRuntime().Server.RconPassword != ""
+}
+
+// rconCommand executes a command on ms through rcon and returns the ms response
+//
+// [blocking]
+func rconCommand(command string) (string, *errco.MshLog) {
+	addr := net.JoinHostPort(config.ServHost, strconv.Itoa(config.ConfigRuntime().Server.RconPort))
+
+	c, err := net.DialTimeout("tcp", addr, rconTimeout)
+	if err != nil {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "rcon connection to %s failed: %s", addr, err.Error())
+	}
+	defer c.Close()
+
+	// authenticate
+	c.SetDeadline(time.Now().Add(rconTimeout))
+	_, err = c.Write(buildRconPacket(1, rconTypeAuth, config.ConfigRuntime().Server.RconPassword))
+	if err != nil {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "rcon auth write: %s", err.Error())
+	}
+	// ms might send an empty response packet before the auth response
+	for {
+		id, typ, _, err := readRconPacket(c)
+		if err != nil {
+			return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "rcon auth read: %s", err.Error())
+		}
+		if typ == rconTypeResponse {
+			continue
+		}
+		if id == -1 {
+			return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "rcon auth failed: wrong password")
+		}
+		break
+	}
+
+	// execute command
+	c.SetDeadline(time.Now().Add(rconTimeout))
+	_, err = c.Write(buildRconPacket(2, rconTypeCommand, command))
+	if err != nil {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "rcon command write: %s", err.Error())
+	}
+	_, _, body, err := readRconPacket(c)
+	if err != nil {
+		// ms might close the connection before responding (ex: stop command)
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_RCON, "rcon command response read: %s", err.Error())
+		return "", nil
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "rcon command executed: %s", command)
+
+	return body, nil
+}
+
+// JoinWelcome executes JoinWelcome command on ms for a player that was held while ms was starting
+// (ex: a welcome title or boss bar), through rcon if enabled or ms console otherwise.
+// The <player> placeholder is replaced with the player name.
+//
+// If JoinWelcome is not set or the player name is unknown, this func does nothing.
+//
+// [goroutine]
+func JoinWelcome(player string) {
+	command := config.ConfigRuntime().Commands.JoinWelcome
+	if command == "" {
+		return
+	}
+
+	if !welcomePlayerRegex.MatchString(player) {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "join welcome command not executed: player name \"%s\" is not valid", player)
+		return
+	}
+
+	time.Sleep(joinWelcomeDelay)
+
+	command = strings.ReplaceAll(command, "<player>", player)
+
+	var logMsh *errco.MshLog
+	if rconEnabled() {
+		if _, logMsh = rconCommand(command); logMsh == nil {
+			return
+		}
+		logMsh.Log(true)
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_RCON, "rcon join welcome failed, falling back to minecraft server console")
+	}
+
+	if _, logMsh = Execute(command); logMsh != nil {
+		logMsh.Log(true)
+	}
+}
+
+// refreshWhitelist refreshes the minecraft server whitelist cache through rcon "whitelist list"
+// (players whitelisted while ms is online must be able to warm ms after hibernation).
+// If WhitelistRconRefresh is disabled or rcon is not enabled, this func does nothing.
+func refreshWhitelist() {
+	if !config.ConfigRuntime().Msh.WhitelistRconRefresh || !rconEnabled() {
+		return
+	}
+
+	out, logMsh := rconCommand("whitelist list")
+	if logMsh != nil {
+		logMsh.Log(true)
+		return
+	}
+
+	names, ok := parseWhitelistList(out)
+	if !ok {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_RCON, "could not parse whitelist list output: %s", out)
+		return
+	}
+
+	config.SetRconWhitelist(names)
+}
+
+// parseWhitelistList returns the player names in the "whitelist list" command output
+func parseWhitelistList(out string) ([]string, bool) {
+	if strings.Contains(out, "no whitelisted players") {
+		return []string{}, true
+	}
+
+	match := whitelistListRegex.FindStringSubmatch(out)
+	if match == nil {
+		return nil, false
+	}
+
+	names := []string{}
+	for _, n := range strings.FieldsFunc(match[1], func(r rune) bool { return r == ',' || r == '\n' }) {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+
+	return names, true
+}
+
+// buildRconPacket returns a source rcon packet:
+// [int32 length] [int32 id] [int32 type] [body] [0x00] [0x00] (little-endian)
+func buildRconPacket(id, typ int32, body string) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, int32(4+4+len(body)+2))
+	binary.Write(buf, binary.LittleEndian, id)
+	binary.Write(buf, binary.LittleEndian, typ)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+	return buf.Bytes()
+}
+
+// readRconPacket reads a source rcon packet and returns its id, type and body
+func readRconPacket(r io.Reader) (int32, int32, string, error) {
+	var length int32
+	err := binary.Read(r, binary.LittleEndian, &length)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	// max response packet size is 4096 (body) + 10 bytes
+	if length < 10 || length > 4096+10 {
+		return 0, 0, "", fmt.Errorf("invalid rcon packet length %d", length)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	id := int32(binary.LittleEndian.Uint32(data[0:4]))
+	typ := int32(binary.LittleEndian.Uint32(data[4:8]))
+	body := string(bytes.TrimRight(data[8:], "\x00"))
+
+	return id, typ, body, nil
+}
@@ -0,0 +1,113 @@
+package servctrl
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/google/shlex"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/notif"
+	"msh/lib/servstats"
+)
+
+// readyProbeInterval is the interval at which ReadyCommand is run (and its maximum run time)
+const readyProbeInterval = 2 * time.Second
+
+// onlineM prevents log parsing and ready probe from setting ms online at the same time
+// (and a start cancellation from happening while ms is set online)
+var onlineM sync.Mutex
+
+// setOnline sets ms status to online and schedules a soft freeze.
+// If ms is not starting (or its start was canceled) this func does nothing.
+func setOnline() {
+	onlineM.Lock()
+	defer onlineM.Unlock()
+
+	if servstats.Stats.Status != errco.SERVER_STATUS_STARTING || startCtx.Err() != nil {
+		return
+	}
+
+	servstats.Stats.Status = errco.SERVER_STATUS_ONLINE
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS ONLINE!")
+	notif.Discord("minecraft server is online")
+
+	// check that ms port is the minecraft server
+	go verifyBackend()
+
+	// schedule soft freeze of ms
+	// (if no players connect the server will shutdown)
+	FreezeMSSchedule()
+}
+
+// readyProbe runs ReadyCommand every readyProbeInterval while ms is starting and sets ms online when it succeeds.
+//
+// If StartupTimeout is reached before ReadyCommand succeeds, ms is set online anyway.
+//
+// If ReadyCommand and StartupTimeout are disabled this func just returns.
+//
+// [goroutine]
+func readyProbe() {
+	command := config.ConfigRuntime().Server.ReadyCommand
+	timeout := time.Duration(config.ConfigRuntime().Msh.StartupTimeout) * time.Second
+
+	if command == "" && timeout <= 0 {
+		return
+	}
+
+	startTime := time.Now()
+	ctx := getStartCtx()
+
+	ticker := time.NewTicker(readyProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if servstats.Stats.Status != errco.SERVER_STATUS_STARTING {
+			return
+		}
+
+		if command != "" {
+			logMsh := runReadyCommand(command)
+			if logMsh == nil {
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ready command succeeded")
+				setOnline()
+				return
+			}
+			logMsh.Log(true)
+		}
+
+		if timeout > 0 && time.Since(startTime) >= timeout {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_READY_COMMAND, "minecraft server not ready after %d seconds, considering it online", config.ConfigRuntime().Msh.StartupTimeout)
+			setOnline()
+			return
+		}
+	}
+}
+
+// runReadyCommand runs ReadyCommand and returns nil if its exit code is 0.
+// The command is killed if it runs longer than readyProbeInterval.
+func runReadyCommand(command string) *errco.MshLog {
+	args, err := shlex.Split(command)
+	if err != nil || len(args) == 0 {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_READY_COMMAND, "ready command is invalid: %s", command)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readyProbeInterval)
+	defer cancel()
+
+	err = exec.CommandContext(ctx, args[0], args[1:]...).Run()
+	if err != nil {
+		return errco.NewLog(errco.TYPE_INF, errco.LVL_3, errco.ERROR_READY_COMMAND, "minecraft server not ready (%s)", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/servstats"
+)
+
+const (
+	scheduleCheckInterval = 15 * time.Second // interval at which the schedule windows are checked
+	scheduleWarnAdvance   = time.Minute      // time before the scheduled hibernation at which online players are warned
+)
+
+// ScheduleMgr hibernates ms when it's online outside the schedule windows.
+// Online players are warned scheduleWarnAdvance before ms is stopped.
+//
+// [goroutine]
+func ScheduleMgr() {
+	var closeTime time.Time // time at which ms is stopped with players online (zero if not scheduled)
+
+	for range time.NewTicker(scheduleCheckInterval).C {
+		if config.ConfigRuntime().ScheduleAllowed(time.Now()) ||
+			servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.Suspended || servstats.Stats.SoftStopped {
+			closeTime = time.Time{}
+			continue
+		}
+
+		switch {
+		case countPlayerSafe() == 0:
+			// ms is empty: hibernate it
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server is online outside schedule windows, hibernating it")
+			if logMsh := FreezeMS(false); logMsh != nil {
+				logMsh.Log(true)
+			}
+
+		case closeTime.IsZero():
+			// warn online players
+			closeTime = time.Now().Add(scheduleWarnAdvance)
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server is online outside schedule windows, stopping it in %s", scheduleWarnAdvance)
+			if logMsh := scheduleWarn(scheduleWarnAdvance); logMsh != nil {
+				logMsh.Log(true)
+			}
+
+		case time.Now().After(closeTime):
+			// stop ms with players online
+			closeTime = time.Time{}
+			if logMsh := FreezeMS(true); logMsh != nil {
+				logMsh.Log(true)
+			}
+		}
+	}
+}
+
+// scheduleWarn notifies online players in game of the upcoming scheduled hibernation
+func scheduleWarn(left time.Duration) *errco.MshLog {
+	gameMessage, err := json.Marshal(&model.GameRawMessage{Text: "[MSH] the server is closing in " + left.String(), Color: "aqua", Bold: false})
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+	}
+
+	_, logMsh := Execute("tellraw @a " + string(gameMessage))
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package servctrl
+
+import (
+	"time"
+
+	"msh/lib/errco"
+)
+
+// shutdownKillTimeout is the time msh waits for ms process to exit after killing it during shutdown
+const shutdownKillTimeout = 5 * time.Second
+
+// ShutdownMS stops ms before msh exits and waits for ms process to exit
+// and for its teardown (post-stop command, dependencies stop) to be done.
+//
+// An in-progress cold start is aborted, otherwise ms is force frozen
+// (StopServer command, with StopServerAllowKill fallback).
+// If ms process is still running after timeout, it's killed.
+// Clients held while ms is starting are disconnected before ShutdownMS returns.
+//
+// [blocking]
+func ShutdownMS(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	// held clients are disconnected once the start is aborted
+	defer waitHeldClients(heldClientsTimeout)
+
+	// [goroutine]
+	exited := make(chan struct{})
+	go func() {
+		ServTerm.exitWg.Wait()
+		close(exited)
+	}()
+
+	if ServTerm.IsActive {
+		// force freeze might wait for a starting ms to go online: don't block the deadline
+		// [goroutine]
+		go func() {
+			// abort an in-progress cold start (avoids leaving a half-started minecraft server)
+			// or stop the minecraft server forcefully
+			if AbortStart() {
+				return
+			}
+			if logMsh := FreezeMS(true); logMsh != nil {
+				logMsh.Log(true)
+			}
+		}()
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "waiting for minecraft server to exit (max %s)...", timeout)
+	} else {
+		// prevent a cold start in progress (ex: pre-start command) from starting ms
+		AbortStart()
+	}
+
+	select {
+	case <-exited:
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server exited")
+		return
+	case <-time.After(time.Until(deadline)):
+	}
+
+	// ms exited but its teardown is taking too long
+	if !ServTerm.IsActive {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_HOOK_COMMAND, "post-stop command/dependencies stop not done within %s", timeout)
+		return
+	}
+
+	// ms is hung: kill it
+	errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_SERVER_KILL, "minecraft server did not exit within %s, killing it", timeout)
+	if logMsh := killMS(); logMsh != nil {
+		logMsh.Log(true)
+		return
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(shutdownKillTimeout):
+	}
+}
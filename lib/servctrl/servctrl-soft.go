@@ -0,0 +1,80 @@
+package servctrl
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// softStartTimeout is the time ms has to bind its port after SoftStart command is executed
+const softStartTimeout = 10 * time.Second
+
+// softStopMS executes SoftStop command on ms: the ms process keeps running but the ms port is unbound.
+// If ms is already soft stopped this func does nothing.
+func softStopMS() *errco.MshLog {
+	if servstats.Stats.SoftStopped {
+		return nil
+	}
+
+	_, logMsh := Execute(config.ConfigRuntime().Commands.SoftStop)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	servstats.Stats.SoftStopped = true
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS SOFT STOPPED!")
+
+	return nil
+}
+
+// softStartMS executes SoftStart command on ms and waits for the ms port to accept connections.
+// If the ms port is not bound within softStartTimeout, ms is fully stopped.
+//
+// [blocking]
+func softStartMS() *errco.MshLog {
+	// ms must not be soft stopped for Execute to run the command
+	servstats.Stats.SoftStopped = false
+
+	_, logMsh := Execute(config.ConfigRuntime().Commands.SoftStart)
+	if logMsh == nil {
+		logMsh = waitServPort(softStartTimeout)
+	}
+
+	if logMsh != nil {
+		logMsh.Log(true)
+
+		// fallback: stop ms (the next WarmMS will start it again)
+		if logStop := resumeStopMS(); logStop != nil {
+			logStop.Log(true)
+		}
+
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_SERVER_SOFT_START, "minecraft server soft start failed, stopping minecraft server")
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS SOFT STARTED!")
+
+	return nil
+}
+
+// waitServPort waits for the ms port to accept connections
+//
+// [blocking]
+func waitServPort(timeout time.Duration) *errco.MshLog {
+	addr := net.JoinHostPort(config.ServHost, strconv.Itoa(config.ServPort))
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		c, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			c.Close()
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_SOFT_START, "minecraft server port not bound after %s", timeout)
+}
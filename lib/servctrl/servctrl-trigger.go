@@ -0,0 +1,86 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/shlex"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/notif"
+)
+
+// triggerLast contains the last time each console trigger fired (by regex and action)
+var triggerLast = struct {
+	m sync.Mutex
+	t map[string]time.Time
+}{t: map[string]time.Time{}}
+
+// consoleTrigger fires the console triggers matching a minecraft server output line
+func consoleTrigger(line string) {
+	for _, ct := range config.ConsoleTriggers() {
+		if match := ct.Regex.FindString(line); match != "" && !triggerCooling(ct, time.Now()) {
+			go runConsoleTrigger(ct, line, match)
+		}
+	}
+}
+
+// triggerCooling returns true if the console trigger fired less than its cooldown ago.
+// Otherwise the trigger is marked as fired at now.
+func triggerCooling(ct *config.ConsoleTrigger, now time.Time) bool {
+	triggerLast.m.Lock()
+	defer triggerLast.m.Unlock()
+
+	key := ct.Regex.String() + "\x00" + ct.Action
+	if last, ok := triggerLast.t[key]; ok && now.Sub(last) < ct.Cooldown {
+		return true
+	}
+	triggerLast.t[key] = now
+
+	return false
+}
+
+// runConsoleTrigger executes the action of a console trigger.
+//
+// If action is a http(s) url, the console event is posted as json.
+// Otherwise action is executed as a command where <line>, <match> placeholders are replaced.
+func runConsoleTrigger(ct *config.ConsoleTrigger, line, match string) {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "console trigger fired: %s", ct.Regex.String())
+
+	if strings.HasPrefix(ct.Action, "http://") || strings.HasPrefix(ct.Action, "https://") {
+		body, err := json.Marshal(&model.ConsoleEvent{Regex: ct.Regex.String(), Line: line, Match: match})
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONSOLE_TRIGGER, err.Error())
+			return
+		}
+
+		logMsh := notif.PostJson(ct.Action, body)
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+
+		return
+	}
+
+	command, err := shlex.Split(ct.Action)
+	if err != nil || len(command) == 0 {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONSOLE_TRIGGER, "console trigger command is invalid: %s", ct.Action)
+		return
+	}
+
+	// placeholders are replaced after splitting so that console output can't add arguments
+	for i := range command {
+		command[i] = strings.ReplaceAll(command[i], "<line>", line)
+		command[i] = strings.ReplaceAll(command[i], "<match>", match)
+	}
+
+	out, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONSOLE_TRIGGER, "console trigger command failed: %s (%s)", err.Error(), strings.TrimSpace(string(out)))
+	}
+}
@@ -3,23 +3,35 @@ package servctrl
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"math/big"
 	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/model"
 	"msh/lib/servstats"
+	"msh/lib/utility"
 )
 
+// playerCountCacheTTL is the time for which the player count retrieved by QueryPlayerCount is reused
+const playerCountCacheTTL = 5 * time.Second
+
+// playerCountCache caches the last player count retrieved by QueryPlayerCount
+var playerCountCache struct {
+	m     sync.Mutex
+	count int
+	time  time.Time
+}
+
 // countPlayerSafe returns the number of players on the server.
 //
-// Players are retrived by (in order): server info, list command, internal connection count.
+// Players are retrived by (in order): server list ping, list command, internal connection count
+// (joins/leaves tracked by msh and by the minecraft server output).
 //
 // Internal connection count is reset if a more reliable method is used.
 //
@@ -32,8 +44,8 @@ func countPlayerSafe() int {
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "retrieving player count...")
 
-	if playerCount, logMsh = getPlayersByServInfo(); logMsh.Log(true) == nil {
-		method = "server info"
+	if playerCount, logMsh = QueryPlayerCount(); logMsh.Log(true) == nil {
+		method = "server list ping"
 		if playerCount != servstats.Stats.ConnCount {
 			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", servstats.Stats.ConnCount, method, playerCount)
 		}
@@ -92,17 +104,99 @@ func searchListCom(s string) (int, *errco.MshLog) {
 	return players, nil
 }
 
-// getPlayersByServInfo returns the number of players using server info request
-func getPlayersByServInfo() (int, *errco.MshLog) {
+// searchLoadProgress analyzes a line of the minecraft server output to extract the loading stage.
+// Returns false if the line does not contain a recognizable loading stage.
+func searchLoadProgress(line string) (string, bool) {
+	// "Preparing spawn area: 40%" reports the actual percentage and has priority over loading stages
+	if strings.Contains(line, "Preparing spawn area: ") {
+		return strings.TrimSpace(strings.Split(strings.Split(line, "Preparing spawn area: ")[1], "\n")[0]), true
+	}
+
+	// loading stages are ordered as they appear in the minecraft server output
+	stages := []struct {
+		flag  string
+		stage string
+	}{
+		{"Loading libraries", "loading libraries"},
+		{"Starting minecraft server version", "starting server"},
+		{"Loading properties", "loading properties"},
+		{"Preparing level", "preparing level"},
+		{"Preparing start region", "preparing spawn area"},
+	}
+
+	for _, s := range stages {
+		if strings.Contains(line, s.flag) {
+			return s.stage, true
+		}
+	}
+
+	return "", false
+}
+
+// searchPlayerEvent analyzes the content of a minecraft server output line (header excluded)
+// to extract a player join/leave event.
+// Returns the player name, true if the player joined (false if left) and false if the line does not contain a player event.
+func searchPlayerEvent(lineContent string) (string, bool, bool) {
+	// player names are 3-16 characters long (letters, numbers and underscore)
+	// anchoring to the line start avoids matching chat messages ("<player> someone joined the game")
+	match := regexp.MustCompile(`^(\w{3,16}) (joined|left) the game$`).FindStringSubmatch(strings.TrimSpace(lineContent))
+	if match == nil {
+		return "", false, false
+	}
+
+	return match[1], match[2] == "joined", true
+}
+
+// QueryPlayerCount returns the number of online players reported by ms in the server list ping response.
+// The result is cached for playerCountCacheTTL to avoid pinging ms at every check.
+// (the primary backend is pinged: the players of a failover standby backend are not counted)
+func QueryPlayerCount() (int, *errco.MshLog) {
+	playerCountCache.m.Lock()
+	defer playerCountCache.m.Unlock()
+
+	if time.Since(playerCountCache.time) < playerCountCacheTTL {
+		return playerCountCache.count, nil
+	}
+
 	servInfo, logMsh := getServInfo()
 	if logMsh != nil {
 		return -1, logMsh.AddTrace()
 	}
 
+	playerCountCache.count = servInfo.Players.Online
+	playerCountCache.time = time.Now()
+
 	return servInfo.Players.Online, nil
 }
 
+// LastPlayerCount returns the last player count retrieved by QueryPlayerCount (also if expired)
+func LastPlayerCount() int {
+	playerCountCache.m.Lock()
+	defer playerCountCache.m.Unlock()
+
+	return playerCountCache.count
+}
+
+// resetPlayerCountCache makes the next QueryPlayerCount ping ms
+func resetPlayerCountCache() {
+	playerCountCache.m.Lock()
+	defer playerCountCache.m.Unlock()
+
+	playerCountCache.time = time.Time{}
+}
+
+// ServReady returns true if ms is warm and responds to a server info request
+func ServReady() bool {
+	if CheckMSWarm() != nil {
+		return false
+	}
+
+	_, logMsh := getServInfo()
+	return logMsh == nil
+}
+
 // getServInfo returns server info after emulating a server info request to the minecraft server
+// (always the primary backend ServHost:ServPort, it doesn't follow Server.Targets failover)
 func getServInfo() (*model.DataInfo, *errco.MshLog) {
 	var recInfoData []byte = []byte{}
 	var recInfo *model.DataInfo = &model.DataInfo{}
@@ -115,12 +209,17 @@ func getServInfo() (*model.DataInfo, *errco.MshLog) {
 	}
 
 	// open connection to minecraft server
-	serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", config.ServHost, config.ServPort))
+	serverSocket, err := net.Dial("tcp", net.JoinHostPort(config.ServHost, strconv.Itoa(config.ServPort)))
 	if err != nil {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
 	}
 	defer serverSocket.Close()
 
+	// ms expects a PROXY header: msh connection is LOCAL
+	if config.ConfigRuntime().Msh.SendProxyProtocol {
+		serverSocket.Write(utility.ProxyHeader(nil, nil))
+	}
+
 	// building byte array to request minecraft server info
 	// [16 0 244 5 9 49 50 55 46 48 46 48 46 49 99 211 1 1 0 ]
 	//                                          └port┘ └info┘
@@ -169,19 +268,19 @@ func getServInfo() (*model.DataInfo, *errco.MshLog) {
 	}
 
 	// update server version and protocol in config
-	if recInfo.Version.Name != config.ConfigRuntime.Server.Version || recInfo.Version.Protocol != config.ConfigRuntime.Server.Protocol {
+	if recInfo.Version.Name != config.ConfigRuntime().Server.Version || recInfo.Version.Protocol != config.ConfigRuntime().Server.Protocol {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "server version found! serverVersion: %s serverProtocol: %d", recInfo.Version.Name, recInfo.Version.Protocol)
 
 		// update runtime config if version is not specified
-		if config.ConfigRuntime.Server.Version == "" {
-			config.ConfigRuntime.Server.Version = recInfo.Version.Name
-			config.ConfigRuntime.Server.Protocol = recInfo.Version.Protocol
+		if config.ConfigRuntime().Server.Version == "" {
+			config.ConfigRuntime().Server.Version = recInfo.Version.Name
+			config.ConfigRuntime().Server.Protocol = recInfo.Version.Protocol
 		}
 
 		// update and save default config
-		config.ConfigDefault.Server.Version = recInfo.Version.Name
-		config.ConfigDefault.Server.Protocol = recInfo.Version.Protocol
-		logMsh := config.ConfigDefault.Save()
+		config.ConfigDefault().Server.Version = recInfo.Version.Name
+		config.ConfigDefault().Server.Protocol = recInfo.Version.Protocol
+		logMsh := config.ConfigDefault().Save()
 		if logMsh != nil {
 			return nil, logMsh.AddTrace()
 		}
@@ -1,7 +1,16 @@
 package servctrl
 
 import (
+	"bytes"
+	"reflect"
+	"regexp"
 	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/servstats"
 )
 
 func Test_searchListCom(t *testing.T) {
@@ -80,3 +89,252 @@ func Test_searchListCom(t *testing.T) {
 		}
 	}
 }
+
+func Test_searchLoadProgress(t *testing.T) {
+	type test struct {
+		line     string
+		expStage string
+		expOk    bool
+	}
+
+	var tests []test = []test{
+		// positive cases [vanilla]
+		{
+			"[12:34:56] [Server thread/INFO]: Starting minecraft server version 1.19.2",
+			"starting server",
+			true,
+		},
+		{
+			"[12:34:56] [Server thread/INFO]: Preparing level \"world\"",
+			"preparing level",
+			true,
+		},
+		{
+			"[12:34:56] [Worker-Main-2/INFO]: Preparing spawn area: 40%",
+			"40%",
+			true,
+		},
+
+		// positive cases [paper]
+		{
+			"[12:34:56 INFO]: Preparing start region for dimension minecraft:overworld",
+			"preparing spawn area",
+			true,
+		},
+
+		// negative cases [example]
+		{
+			"[12:34:56] [Server thread/INFO]: Done (12.345s)! For help, type \"help\"",
+			"",
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		stage, ok := searchLoadProgress(tt.line)
+		if ok != tt.expOk {
+			t.Errorf("function returned unexpected result for: %s", tt.line)
+		}
+
+		if stage != tt.expStage {
+			t.Errorf("function returned unexpected stage (%s) for: %s", stage, tt.line)
+		}
+	}
+}
+
+func Test_searchPlayerEvent(t *testing.T) {
+	type test struct {
+		lineContent string
+		expPlayer   string
+		expJoin     bool
+		expOk       bool
+	}
+
+	var tests []test = []test{
+		// positive cases
+		{"Steve joined the game", "Steve", true, true},
+		{"Alex_01 left the game", "Alex_01", false, true},
+
+		// negative cases
+		{"<Steve> Alex joined the game", "", false, false},
+		{"Steve lost connection: Disconnected", "", false, false},
+		{"Starting minecraft server version 1.19.2", "", false, false},
+	}
+
+	for _, tt := range tests {
+		player, join, ok := searchPlayerEvent(tt.lineContent)
+		if player != tt.expPlayer || join != tt.expJoin || ok != tt.expOk {
+			t.Errorf("for %q expected (%s, %t, %t) but got (%s, %t, %t)", tt.lineContent, tt.expPlayer, tt.expJoin, tt.expOk, player, join, ok)
+		}
+	}
+}
+
+func Test_lowerXmx(t *testing.T) {
+	type test struct {
+		param       string
+		availableMB uint64
+		expParam    string
+		expOk       bool
+	}
+
+	var tests []test = []test{
+		{"-Xmx4G -Xms4G", 8192, "-Xmx3072M -Xms3072M", true},
+		{"-Xmx4096M -Xms1024M", 2048, "-Xmx1536M -Xms1024M", true},
+		{"-Xms1G -Xmx2048m -XX:+UseG1GC", 1000, "-Xms750M -Xmx750M -XX:+UseG1GC", true},
+		{"-Xmx512M -Xms512M", 4096, "-Xmx512M -Xms512M", false},
+		{"-Xms1024M", 4096, "-Xms1024M", false},
+	}
+
+	for _, tt := range tests {
+		param, ok := lowerXmx(tt.param, tt.availableMB)
+		if param != tt.expParam || ok != tt.expOk {
+			t.Errorf("lowerXmx(%q, %d) = (%q, %v), want (%q, %v)", tt.param, tt.availableMB, param, ok, tt.expParam, tt.expOk)
+		}
+	}
+}
+
+func Test_rconPacket(t *testing.T) {
+	type test struct {
+		id   int32
+		typ  int32
+		body string
+	}
+
+	var tests []test = []test{
+		{1, rconTypeAuth, "password"},
+		{2, rconTypeCommand, "stop"},
+		{-1, rconTypeCommand, ""},
+	}
+
+	for _, tt := range tests {
+		packet := buildRconPacket(tt.id, tt.typ, tt.body)
+		if len(packet) != 4+4+4+len(tt.body)+2 {
+			t.Errorf("buildRconPacket(%d, %d, %q) has length %d", tt.id, tt.typ, tt.body, len(packet))
+		}
+
+		id, typ, body, err := readRconPacket(bytes.NewReader(packet))
+		if err != nil || id != tt.id || typ != tt.typ || body != tt.body {
+			t.Errorf("readRconPacket returned (%d, %d, %q, %v), want (%d, %d, %q, nil)", id, typ, body, err, tt.id, tt.typ, tt.body)
+		}
+	}
+
+	// truncated packet
+	if _, _, _, err := readRconPacket(bytes.NewReader(buildRconPacket(1, rconTypeAuth, "password")[:10])); err == nil {
+		t.Errorf("readRconPacket on truncated packet expected error")
+	}
+}
+
+func Test_parseWhitelistList(t *testing.T) {
+	type test struct {
+		out      string
+		expNames []string
+		expOk    bool
+	}
+
+	var tests []test = []test{
+		{"There are 2 whitelisted player(s): alice, bob", []string{"alice", "bob"}, true},
+		{"There are 1 whitelisted players: gekigek99", []string{"gekigek99"}, true},
+		{"There are 2 (out of 3 seen) whitelisted players:\nalice, bob", []string{"alice", "bob"}, true},
+		{"There are no whitelisted players", []string{}, true},
+		{"Unknown command", nil, false},
+	}
+
+	for _, tt := range tests {
+		names, ok := parseWhitelistList(tt.out)
+		if !reflect.DeepEqual(names, tt.expNames) || ok != tt.expOk {
+			t.Errorf("parseWhitelistList(%q) = (%v, %v), want (%v, %v)", tt.out, names, ok, tt.expNames, tt.expOk)
+		}
+	}
+}
+
+func Test_crashBackoff(t *testing.T) {
+	for n, expect := range map[int]time.Duration{
+		1:  5 * time.Second,
+		2:  10 * time.Second,
+		4:  40 * time.Second,
+		10: 5 * time.Minute,
+	} {
+		if got := crashBackoff(n); got != expect {
+			t.Errorf("crashBackoff(%d): got %s, expected %s", n, got, expect)
+		}
+	}
+}
+
+func Test_handleExit(t *testing.T) {
+	defer func() {
+		config.ConfigRuntime().Msh.RestartOnCrash, config.ConfigRuntime().Msh.MaxRestartAttempts = false, 0
+		servstats.Stats.CrashError, servstats.Stats.MajorError = nil, nil
+	}()
+
+	// stop requested or ms stopped by itself: not a crash
+	handleExit(1, true, time.Minute, false, "")
+	handleExit(0, false, time.Minute, false, "")
+	if servstats.Stats.CrashError != nil {
+		t.Errorf("handleExit: clean exit reported as crash")
+	}
+
+	// crash without restart: crash error is set, not the major error
+	config.ConfigRuntime().Msh.RestartOnCrash = false
+	handleExit(1, false, time.Minute, false, "")
+	if servstats.Stats.CrashError == nil || servstats.Stats.MajorError != nil {
+		t.Errorf("handleExit: crash without restart: crash error %v, major error %v", servstats.Stats.CrashError, servstats.Stats.MajorError)
+	}
+
+	// crash with restart attempts run out: major error is set until a manual start
+	config.ConfigRuntime().Msh.RestartOnCrash, config.ConfigRuntime().Msh.MaxRestartAttempts = true, 0
+	handleExit(137, false, time.Minute, false, "")
+	if servstats.Stats.MajorError == nil || servstats.Stats.MajorError != crashGiveUp {
+		t.Fatalf("handleExit: give up major error not set")
+	}
+	ClearCrashGiveUp()
+	if servstats.Stats.MajorError != nil || crashGiveUp != nil || crashAttempts != 0 {
+		t.Errorf("ClearCrashGiveUp: major error %v, attempts %d", servstats.Stats.MajorError, crashAttempts)
+	}
+
+	// other major errors are not cleared
+	other := &errco.MshLog{Mex: "other"}
+	servstats.Stats.MajorError = other
+	ClearCrashGiveUp()
+	if servstats.Stats.MajorError != other {
+		t.Errorf("ClearCrashGiveUp: cleared a major error not set by a crash")
+	}
+}
+
+func Test_triggerCooling(t *testing.T) {
+	ct := &config.ConsoleTrigger{Regex: regexp.MustCompile("was slain by"), Action: "echo <line>", Cooldown: 10 * time.Second}
+	now := time.Now()
+
+	if triggerCooling(ct, now) {
+		t.Errorf("triggerCooling: first match is cooling")
+	}
+	if !triggerCooling(ct, now.Add(5*time.Second)) {
+		t.Errorf("triggerCooling: match within cooldown is not cooling")
+	}
+	if triggerCooling(ct, now.Add(11*time.Second)) {
+		t.Errorf("triggerCooling: match after cooldown is cooling")
+	}
+
+	// cooldown is per trigger
+	other := &config.ConsoleTrigger{Regex: regexp.MustCompile("was slain by"), Action: "echo other", Cooldown: 10 * time.Second}
+	if triggerCooling(other, now.Add(12*time.Second)) {
+		t.Errorf("triggerCooling: cooldown shared between triggers")
+	}
+}
+
+func Test_stopDependencies(t *testing.T) {
+	db := model.Dependency{Name: "db", StartCommand: "db start"}
+	cache := model.Dependency{Name: "cache", StartCommand: "cache start"}
+	depsStarted = []model.Dependency{db, cache}
+
+	depsM.Lock()
+	if !depStarted(db) || depStarted(model.Dependency{Name: "db", StartCommand: "db2 start"}) {
+		t.Errorf("depStarted: started dependency not recognized")
+	}
+	depsM.Unlock()
+
+	// dependencies without stop command are just forgotten
+	stopDependencies()
+	if len(depsStarted) != 0 {
+		t.Errorf("stopDependencies: %d dependencies left, expected 0", len(depsStarted))
+	}
+}
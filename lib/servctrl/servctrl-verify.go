@@ -0,0 +1,53 @@
+package servctrl
+
+import (
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+const (
+	verifyBackendAttempts = 3               // number of server info requests before considering the backend invalid
+	verifyBackendInterval = 2 * time.Second // interval between server info requests
+)
+
+// verifyBackend checks that ms port responds to a server info request with valid data.
+// If it doesn't, a configuration error is logged and the backend is flagged as invalid
+// (players are not forwarded to ms until the next ms start).
+//
+// If VerifyBackend is disabled this func just returns.
+//
+// [goroutine]
+func verifyBackend() {
+	if !config.ConfigRuntime().Msh.VerifyBackend {
+		return
+	}
+
+	var logMsh *errco.MshLog
+
+	for i := 0; i < verifyBackendAttempts; i++ {
+		// ms was stopped/suspended/soft stopped in the meantime: verification is not possible
+		if CheckMSWarm() != nil {
+			return
+		}
+
+		servInfo, logInfo := getServInfo()
+		switch {
+		case logInfo != nil:
+			logMsh = logInfo.AddTrace()
+		case servInfo.Version.Name == "" || servInfo.Version.Protocol <= 0:
+			logMsh = errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_BACKEND_INVALID, "server info response has no version")
+		default:
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "backend verified: %s (protocol %d)", servInfo.Version.Name, servInfo.Version.Protocol)
+			return
+		}
+
+		logMsh.Log(true)
+		time.Sleep(verifyBackendInterval)
+	}
+
+	servstats.Stats.BackendInvalid = true
+	errco.NewLogln(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_BACKEND_INVALID, "%s:%d does not respond as a minecraft server: check ServPort/server.properties (players will not be forwarded)", config.ServHost, config.ServPort)
+}
@@ -1,24 +1,86 @@
 package servctrl
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"msh/lib/config"
 	"msh/lib/errco"
+	"msh/lib/notif"
 	"msh/lib/opsys"
 	"msh/lib/servstats"
 )
 
-// WarmMS warms the minecraft server
+var (
+	// startM serializes ms warms and the teardown of an exited ms (post-stop command, dependencies stop):
+	// a single cold start at a time runs dependencies, pre-start command and terminal start
+	startM sync.Mutex
+
+	// coldStarting is true while a cold start is running dependencies, pre-start command and terminal start
+	coldStarting atomic.Bool
+
+	// postStopRunning is true while the teardown of an exited ms (post-stop command, dependencies stop) is running
+	postStopRunning atomic.Bool
+)
+
+// PostStopRunning returns true while the post-stop command and dependencies stop of an exited ms are running
+// (ms can't be warmed meanwhile)
+func PostStopRunning() bool {
+	return postStopRunning.Load()
+}
+
+// WarmMS warms the minecraft server.
+// If a cold start is already in progress, it returns without doing anything.
 // [non-blocking]
 func WarmMS() *errco.MshLog {
+	_, logMsh := warmMS()
+	return logMsh
+}
+
+// WarmMSBy warms the minecraft server for a client (player name or address).
+// If ms is woken up by this warm (cold start, resume or soft start), a "waking up" notification is sent.
+// [non-blocking]
+func WarmMSBy(client string) *errco.MshLog {
+	woke, logMsh := warmMS()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	if woke {
+		notif.Discord("minecraft server is waking up (%s)", client)
+	}
+
+	return nil
+}
+
+// warmMS warms the minecraft server.
+// Returns true if ms is woken up by this warm (cold start, resume or soft start).
+func warmMS() (bool, *errco.MshLog) {
 	var logMsh *errco.MshLog
+	var woke bool
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "issued minecraft server warm...")
 
+	// don't wait for the cold start in progress (ex: a long pre-start command)
+	if coldStarting.Load() {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server cold start already in progress")
+		return false, nil
+	}
+
+	// don't wait for the teardown of the exited ms (ex: a long post-stop command)
+	if postStopRunning.Load() {
+		return false, errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft server post-stop command is running, warm it again later")
+	}
+
+	// ms status is checked after acquiring startM:
+	// the warm that was holding it might have started ms
+	startM.Lock()
+	defer startM.Unlock()
+
 	// don't try to warm ms if it has encountered major errors
 	if servstats.Stats.MajorError != nil {
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft server has encountered major problems")
+		return false, errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft server has encountered major problems")
 	}
 
 	switch servstats.Stats.Status {
@@ -31,17 +93,68 @@ func WarmMS() *errco.MshLog {
 			servstats.Stats.Suspended = false // if ms is offline it's process can't be suspended
 		}
 
+		// don't start ms if msh is exiting
+		if startAborted.Load() {
+			return false, errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft server start aborted (msh is exiting)")
+		}
+
+		// new cold start (can be aborted by AbortStart)
+		coldStarting.Store(true)
+		defer coldStarting.Store(false)
+		ctx := newStartCtx()
+
+		// clients must be proxied to the ms that is starting, not to a standby backend
+		// (players would end up on diverging copies of the world)
+		if len(config.ServTargets) > 1 && servstats.Stats.SetTarget(0, config.ServTargets[0]) != 0 {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "FAILBACK: minecraft server is starting, proxying clients to %s", config.ServTargets[0])
+		}
+
+		// start dependencies before ms
+		logMsh = startDependencies(ctx)
+		if logMsh != nil {
+			return false, logMsh.AddTrace()
+		}
+
+		// start was aborted while starting dependencies
+		if ctx.Err() != nil {
+			stopDependencies()
+			return false, errco.NewLog(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft server start aborted")
+		}
+
+		// run pre-start command (ms start is aborted if it fails)
+		logMsh = preStartHook()
+		if logMsh != nil {
+			stopDependencies()
+			servstats.Stats.SetMajorError(errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "pre-start command failed (check logs)"))
+			return false, logMsh.AddTrace()
+		}
+
 		logMsh = termStart()
 		if logMsh != nil {
 			servstats.Stats.SetMajorError(errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "error starting minecraft server (check logs)"))
-			return logMsh.AddTrace()
+			return false, logMsh.AddTrace()
 		}
 
+		servstats.Stats.WakeCount++
+		woke = true
+
 	default:
-		if config.ConfigRuntime.Msh.SuspendAllow {
+		if servstats.Stats.Suspended || servstats.Stats.SoftStopped {
+			servstats.Stats.WakeCount++
+			woke = true
+		}
+
+		if config.ConfigRuntime().Msh.SuspendAllow {
 			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
 			if logMsh != nil {
-				return logMsh.AddTrace()
+				return false, logMsh.AddTrace()
+			}
+		}
+
+		if servstats.Stats.SoftStopped {
+			logMsh = softStartMS()
+			if logMsh != nil {
+				return false, logMsh.AddTrace()
 			}
 		}
 	}
@@ -52,7 +165,7 @@ func WarmMS() *errco.MshLog {
 	// schedule soft freeze of ms
 	FreezeMSSchedule()
 
-	return nil
+	return woke, nil
 }
 
 // FreezeMS executes "stop" command on the minecraft server.
@@ -75,7 +188,7 @@ func FreezeMS(force bool) *errco.MshLog {
 
 		// resume ms process (un/suspended)
 		// to be sure that ms process is running to allow ms start
-		if config.ConfigRuntime.Msh.SuspendAllow {
+		if config.ConfigRuntime().Msh.SuspendAllow {
 			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
 			if logMsh != nil {
 				return logMsh.AddTrace()
@@ -114,6 +227,10 @@ func FreezeMS(force bool) *errco.MshLog {
 
 		// if force freeze, resume and stop ms
 		if force {
+			// a suspended ms can't answer rcon (whitelist was refreshed before suspension)
+			if !servstats.Stats.Suspended {
+				refreshWhitelist()
+			}
 			logMsh = resumeStopMS()
 			if logMsh != nil {
 				return logMsh.AddTrace()
@@ -121,17 +238,32 @@ func FreezeMS(force bool) *errco.MshLog {
 			return nil
 		}
 
+		// ms is already soft stopped
+		if servstats.Stats.SoftStopped {
+			return nil
+		}
+
 		// check how many players are on the server
 		if countPlayerSafe() > 0 {
 			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_EMPTY, "server is not empty")
 		}
 
-		// suspend/stop ms
-		if config.ConfigRuntime.Msh.SuspendAllow {
+		// refresh whitelist before hibernation
+		refreshWhitelist()
+
+		// suspend/soft stop/stop ms
+		if config.ConfigRuntime().Msh.SuspendAllow {
 			servstats.Stats.Suspended, logMsh = opsys.ProcTreeSuspend(uint32(ServTerm.cmd.Process.Pid))
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
+			servstats.Stats.SuspendTime = time.Now()
+			suspendStopSchedule()
+		} else if config.ConfigRuntime().Msh.HibernationMode == "soft" {
+			logMsh = softStopMS()
+			if logMsh != nil {
+				return logMsh.AddTrace()
+			}
 		} else {
 			// resume and stop ms
 			logMsh = resumeStopMS()
@@ -140,13 +272,15 @@ func FreezeMS(force bool) *errco.MshLog {
 			}
 		}
 
+		notif.Discord("minecraft server is hibernating")
+
 		return nil
 
 	case errco.SERVER_STATUS_STOPPING:
 		// is ms is stopping, resume the process and let it stop
 
 		// resume ms process (un/suspended)
-		if config.ConfigRuntime.Msh.SuspendAllow {
+		if config.ConfigRuntime().Msh.SuspendAllow {
 			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
 			if logMsh != nil {
 				return logMsh.AddTrace()
@@ -182,7 +316,7 @@ func FreezeMS(force bool) *errco.MshLog {
 
 // FreezeMSSchedule stops freeze timer and schedules a soft freeze of ms
 func FreezeMSSchedule() {
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "scheduling ms soft freeze in %d seconds", config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "scheduling ms soft freeze in %d seconds", config.ConfigRuntime().Msh.TimeBeforeStoppingEmptyServer)
 
 	// stop freeze timer so that it can be reset
 	// don't use drain channel procedure described in Stop() as it might happen
@@ -191,11 +325,20 @@ func FreezeMSSchedule() {
 	_ = servstats.Stats.FreezeTimer.Stop()
 
 	// schedule soft freeze of ms in TimeBeforeStoppingEmptyServer seconds
+	// (the timer fires HibernationWarnSeconds earlier to double-check that ms is empty)
+	freezeTime := time.Now().Add(time.Duration(config.ConfigRuntime().Msh.TimeBeforeStoppingEmptyServer) * time.Second)
+	warn := time.Duration(config.ConfigRuntime().Msh.HibernationWarnSeconds) * time.Second
+	servstats.Stats.FreezeTime = freezeTime
 	// [goroutine]
 	servstats.Stats.FreezeTimer = time.AfterFunc(
-		time.Duration(config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer)*time.Second,
+		time.Until(freezeTime.Add(-warn)),
 		func() {
+			if warn > 0 && !hibernationWarn(freezeTime) {
+				return
+			}
+
 			// perform soft freeze of ms
+			// (FreezeMS verifies again that ms is empty before stopping it)
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "performing scheduled ms soft freeze")
 			logMsh := FreezeMS(false)
 			if logMsh != nil {
@@ -205,25 +348,107 @@ func FreezeMSSchedule() {
 	)
 }
 
+// suspendStopSchedule schedules the full stop of ms after it has been suspended for SuspendStopAfter seconds.
+// The stop is performed only if ms is still suspended since Stats.SuspendTime.
+func suspendStopSchedule() {
+	after := time.Duration(config.ConfigRuntime().Msh.SuspendStopAfter) * time.Second
+	if after <= 0 {
+		return
+	}
+
+	// [goroutine]
+	time.AfterFunc(after, func() {
+		// ms was resumed (or suspended again) meanwhile
+		if !servstats.Stats.Suspended || servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || time.Since(servstats.Stats.SuspendTime) < after {
+			return
+		}
+
+		// ms process is resumed before the stop command so that it can save the world
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server suspended for %s, stopping it", after)
+		if logMsh := resumeStopMS(); logMsh != nil {
+			logMsh.Log(true)
+		}
+	})
+}
+
+// hibernationWarn double-checks that ms is still empty before the scheduled soft freeze at freezeTime
+// and waits until freezeTime.
+// Returns false if the scheduled soft freeze must not be performed
+// (players online or soft freeze rescheduled meanwhile).
+//
+// [blocking]
+func hibernationWarn(freezeTime time.Time) bool {
+	// FreezeMS handles the other ms statuses
+	if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.Suspended || servstats.Stats.SoftStopped {
+		return true
+	}
+
+	if playerCount := countPlayerSafe(); playerCount > 0 {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SERVER_NOT_EMPTY, "scheduled ms soft freeze cancelled: %d players online", playerCount)
+		if config.ConfigRuntime().Msh.WarnOnlinePlayers {
+			if logMsh := TellRaw("hibernation", "msh detected online players, the server stays online", "hibernationWarn"); logMsh != nil {
+				logMsh.Log(true)
+			}
+		}
+		return false
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server is empty, soft freeze in %.0f seconds", time.Until(freezeTime).Seconds())
+	time.Sleep(time.Until(freezeTime))
+
+	// a newer soft freeze was scheduled while waiting
+	if !servstats.Stats.FreezeTime.Equal(freezeTime) {
+		return false
+	}
+
+	return true
+}
+
 // resumeStopMS resumes ms process and executes a stop command in ms terminal.
 //
+// If ms is already stopping (stop command issued by msh or stop logged by ms), this func does nothing:
+// a single stop command and kill timer are issued per ms run.
+//
 // Should be called only when servstats.Stats.Status == ONLINE
 func resumeStopMS() *errco.MshLog {
 	var logMsh *errco.MshLog
 
+	ServTerm.stopM.Lock()
+	defer ServTerm.stopM.Unlock()
+
+	// join the stop in progress (ms status changes to STOPPING only when ms logs it)
+	if ServTerm.stopping || servstats.Stats.Status == errco.SERVER_STATUS_STOPPING {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server is already stopping, waiting for it to stop")
+		return nil
+	}
+
 	// resume ms process (un/suspended)
-	if config.ConfigRuntime.Msh.SuspendAllow {
+	if config.ConfigRuntime().Msh.SuspendAllow {
 		servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
 		if logMsh != nil {
 			return logMsh.AddTrace()
 		}
 	}
 
-	// execute stop command
-	_, logMsh = Execute(config.ConfigRuntime.Commands.StopServer)
+	// execute stop command (docker container is stopped by docker)
+	// (rcon is preferred to stdin when enabled, stdin is used as fallback)
+	switch {
+	case config.ConfigRuntime().Server.Type == "docker":
+		logMsh = dockerStop()
+	case rconEnabled():
+		_, logMsh = rconCommand(config.ConfigRuntime().Commands.StopServer)
+		if logMsh != nil {
+			logMsh.Log(true)
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_RCON, "rcon stop failed, falling back to minecraft server console")
+			_, logMsh = Execute(config.ConfigRuntime().Commands.StopServer)
+		}
+	default:
+		_, logMsh = Execute(config.ConfigRuntime().Commands.StopServer)
+	}
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
+	ServTerm.stopping = true
 
 	// launch a function to check the shutdown of minecraft server
 	go killMSifOnlineAfterTimeout()
@@ -231,30 +456,46 @@ func resumeStopMS() *errco.MshLog {
 	return nil
 }
 
+// killMS kills the ms process tree (or the ms docker container)
+func killMS() *errco.MshLog {
+	if config.ConfigRuntime().Server.Type == "docker" {
+		return dockerKill()
+	}
+
+	return opsys.ProcTreeKill(uint32(ServTerm.cmd.Process.Pid))
+}
+
+// stopConfirmedExitTimeout is the max time (seconds) the minecraft server process is given
+// to exit once its output confirmed a clean stop
+const stopConfirmedExitTimeout int = 15
+
 // killMSifOnlineAfterTimeout waits for the specified time and then
 // if the server is still online, kills the server process.
 //
+// If the minecraft server output confirms a clean stop, the countdown is canceled
+// and the server process is given stopConfirmedExitTimeout seconds to exit before being killed.
+//
 // if StopServerAllowKill is disabled this function does nothing.
 func killMSifOnlineAfterTimeout() {
 	var logMsh *errco.MshLog
 
 	// if StopServerAllowKill is disabled in config, do nothing
-	if config.ConfigRuntime.Commands.StopServerAllowKill <= 0 {
+	if config.ConfigRuntime().Commands.StopServerAllowKill <= 0 {
 		return
 	}
 
-	countdown := config.ConfigRuntime.Commands.StopServerAllowKill
+	countdown := config.ConfigRuntime().Commands.StopServerAllowKill
 
 	// resume ms process (un/suspended)
 	// to be sure that ms is running to stop itself
-	if config.ConfigRuntime.Msh.SuspendAllow {
+	if config.ConfigRuntime().Msh.SuspendAllow {
 		servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
 		if logMsh != nil {
 			logMsh.Log(true)
 		}
 	}
 
-	for countdown > 0 {
+	for countdown > 0 && !ServTerm.stopConfirmed {
 		// if server goes offline it's the correct behaviour -> return
 		if servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE {
 			return
@@ -264,16 +505,27 @@ func killMSifOnlineAfterTimeout() {
 		time.Sleep(1 * time.Second)
 	}
 
-	// save world before killing the server, do not check for errors
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "saving word before killing the minecraft server process")
-	_, _ = Execute("save-all")
+	if ServTerm.stopConfirmed {
+		// server confirmed a clean stop: the world is already saved, wait for the process to exit
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server stop confirmed, waiting up to %d seconds for the process to exit", stopConfirmedExitTimeout)
+		for countdown = stopConfirmedExitTimeout; countdown > 0; countdown-- {
+			if servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE {
+				return
+			}
+			time.Sleep(1 * time.Second)
+		}
+	} else {
+		// save world before killing the server, do not check for errors
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "saving word before killing the minecraft server process")
+		_, _ = Execute("save-all")
 
-	// give time to save word
-	time.Sleep(10 * time.Second)
+		// give time to save word
+		time.Sleep(10 * time.Second)
+	}
 
 	// send kill signal to server
 	errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_KILL, "minecraft server process won't stop normally: sending kill signal")
-	LogMsh := opsys.ProcTreeKill(uint32(ServTerm.cmd.Process.Pid))
+	LogMsh := killMS()
 	if LogMsh != nil {
 		LogMsh.Log(true)
 	}
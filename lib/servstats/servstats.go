@@ -2,6 +2,7 @@ package servstats
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"msh/lib/errco"
@@ -12,26 +13,135 @@ var Stats *serverStats = &serverStats{
 	M:              &sync.Mutex{},
 	Status:         errco.SERVER_STATUS_OFFLINE,
 	Suspended:      false,
+	SoftStopped:    false,
+	BackendInvalid: false,
 	MajorError:     nil,
 	ConnCount:      0,
 	FreezeTimer:    time.NewTimer(5 * time.Minute),
 	WarmUpTime:     time.Unix(0, 0), // use 1970-01-01 00:00:00 as init value
+	HibernateTime:  time.Unix(0, 0), // use 1970-01-01 00:00:00 as init value
 	LoadProgress:   "0%",
 	BytesToClients: 0,
 	BytesToServer:  0,
+	PersistError:   nil,
+	CrashError:     nil,
+	OomCount:       0,
+	WakeCount:      0,
+	FreezeTime:     time.Unix(0, 0), // use 1970-01-01 00:00:00 as init value
+	SuspendTime:    time.Unix(0, 0), // use 1970-01-01 00:00:00 as init value
 }
 
 type serverStats struct {
 	M              *sync.Mutex
 	Status         int           // represent the status of the minecraft server
 	Suspended      bool          // status of minecraft server process (if ms is offline, should be set to false)
+	SoftStopped    bool          // minecraft server is soft stopped: process running but port unbound (if ms is offline, should be set to false)
+	BackendInvalid bool          // minecraft server port does not speak the minecraft protocol (reset at each ms start)
 	MajorError     *errco.MshLog // if !nil the server is having some major problems
 	ConnCount      int           // tracks active client connections to ms (only clients that are playing on ms)
 	FreezeTimer    *time.Timer   // timer to freeze minecraft server
 	WarmUpTime     time.Time     // time at which minecraft server was warmed up
+	HibernateTime  time.Time     // time at which minecraft server last went offline
 	LoadProgress   string        // tracks loading percentage of starting server
 	BytesToClients float64       // tracks bytes/s server->clients
 	BytesToServer  float64       // tracks bytes/s clients->server
+	PersistError   *errco.MshLog // if !nil msh could not write config/state files
+	CrashError     *errco.MshLog // if !nil the last ms run ended with a crash (reset at each ms start)
+	Handlers       int32         // tracks active connection handlers (atomic)
+	OomCount       int32         // tracks minecraft server out of memory errors since msh start (atomic)
+	WakeCount      int           // tracks minecraft server warms (cold starts, resumes, soft starts) since msh start
+	FreezeTime     time.Time     // time at which the scheduled freeze of minecraft server is performed
+	SuspendTime    time.Time     // time at which minecraft server process was suspended
+	ActiveTarget   string        // address of the backend to which clients are proxied (changes on failover, use Target/SetTarget)
+
+	BytesToClientsTotal int64 // tracks bytes server->clients since msh start or last ResetCounters (atomic)
+	BytesToServerTotal  int64 // tracks bytes clients->server since msh start or last ResetCounters (atomic)
+	ConnPeak            int   // tracks peak concurrent client connections to ms since msh start or last ResetCounters (use ConnAdd/Conns)
+}
+
+// targetM protects ActiveTarget and activeTargetIdx
+var targetM sync.Mutex
+
+// activeTargetIdx is the index of ActiveTarget in the backend list (0: primary backend)
+var activeTargetIdx int
+
+// Target returns the index in the backend list and the address of the backend to which clients are proxied
+func (s *serverStats) Target() (int, string) {
+	targetM.Lock()
+	defer targetM.Unlock()
+
+	return activeTargetIdx, s.ActiveTarget
+}
+
+// SetTarget sets the backend to which clients are proxied and returns the index of the previous one
+func (s *serverStats) SetTarget(i int, addr string) int {
+	targetM.Lock()
+	defer targetM.Unlock()
+
+	old := activeTargetIdx
+	activeTargetIdx, s.ActiveTarget = i, addr
+
+	return old
+}
+
+// SwapTarget sets the backend to which clients are proxied only if the current backend index is old.
+// Returns false if the backend was changed in the meantime.
+func (s *serverStats) SwapTarget(old, i int, addr string) bool {
+	targetM.Lock()
+	defer targetM.Unlock()
+
+	if activeTargetIdx != old {
+		return false
+	}
+	activeTargetIdx, s.ActiveTarget = i, addr
+
+	return true
+}
+
+// connM protects ConnCount and ConnPeak (multiple connection goroutines update them)
+var connM sync.Mutex
+
+// ConnAdd adds delta to ConnCount, updates ConnPeak and returns the new connection count
+func (s *serverStats) ConnAdd(delta int) int {
+	connM.Lock()
+	defer connM.Unlock()
+
+	s.ConnCount += delta
+	if s.ConnCount > s.ConnPeak {
+		s.ConnPeak = s.ConnCount
+	}
+
+	return s.ConnCount
+}
+
+// ConnReset sets ConnCount to 0 (ms is starting or offline: no client is connected)
+func (s *serverStats) ConnReset() {
+	connM.Lock()
+	defer connM.Unlock()
+
+	s.ConnCount = 0
+}
+
+// Conns returns ConnCount and ConnPeak
+func (s *serverStats) Conns() (count, peak int) {
+	connM.Lock()
+	defer connM.Unlock()
+
+	return s.ConnCount, s.ConnPeak
+}
+
+// ResetCounters resets the proxied bytes totals and sets ConnPeak to the active connections.
+// The values before the reset are returned, so that per-interval deltas can be computed.
+func (s *serverStats) ResetCounters() (toClients, toServer int64, peak int) {
+	connM.Lock()
+	peak = s.ConnPeak
+	s.ConnPeak = s.ConnCount
+	connM.Unlock()
+
+	toClients = atomic.SwapInt64(&s.BytesToClientsTotal, 0)
+	toServer = atomic.SwapInt64(&s.BytesToServerTotal, 0)
+
+	return toClients, toServer, peak
 }
 
 // SetMajorError sets *serverStats.MajorError only if nil
@@ -40,3 +150,24 @@ func (s *serverStats) SetMajorError(e *errco.MshLog) {
 		s.MajorError = e
 	}
 }
+
+// StatusName returns the name of the minecraft server status
+// ("suspended" if ms is online and its process is suspended)
+func (s *serverStats) StatusName() string {
+	if s.Status == errco.SERVER_STATUS_ONLINE && s.Suspended {
+		return "suspended"
+	}
+
+	switch s.Status {
+	case errco.SERVER_STATUS_OFFLINE:
+		return "offline"
+	case errco.SERVER_STATUS_STARTING:
+		return "starting"
+	case errco.SERVER_STATUS_ONLINE:
+		return "online"
+	case errco.SERVER_STATUS_STOPPING:
+		return "stopping"
+	default:
+		return "unknown"
+	}
+}
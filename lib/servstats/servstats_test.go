@@ -0,0 +1,55 @@
+package servstats
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_ConnAdd(t *testing.T) {
+	s := &serverStats{}
+
+	// concurrent connections: no update must be lost
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.ConnAdd(1)
+		}()
+	}
+	wg.Wait()
+
+	if count, peak := s.Conns(); count != 100 || peak != 100 {
+		t.Errorf("ConnAdd: count %d, peak %d, want 100, 100", count, peak)
+	}
+
+	s.ConnAdd(-60)
+	if count, peak := s.Conns(); count != 40 || peak != 100 {
+		t.Errorf("ConnAdd: count %d, peak %d, want 40, 100", count, peak)
+	}
+
+	s.ConnReset()
+	if count, peak := s.Conns(); count != 0 || peak != 100 {
+		t.Errorf("ConnReset: count %d, peak %d, want 0, 100", count, peak)
+	}
+}
+
+func Test_ResetCounters(t *testing.T) {
+	s := &serverStats{}
+	s.ConnAdd(5)
+	s.ConnAdd(-3)
+	atomic.AddInt64(&s.BytesToClientsTotal, 1000)
+	atomic.AddInt64(&s.BytesToServerTotal, 200)
+
+	toClients, toServer, peak := s.ResetCounters()
+	if toClients != 1000 || toServer != 200 || peak != 5 {
+		t.Errorf("ResetCounters: got (%d, %d, %d), want (1000, 200, 5)", toClients, toServer, peak)
+	}
+
+	// after the reset the peak is the active connections count
+	toClients, toServer, peak = s.ResetCounters()
+	if toClients != 0 || toServer != 0 || peak != 2 {
+		t.Errorf("ResetCounters: got (%d, %d, %d), want (0, 0, 2)", toClients, toServer, peak)
+	}
+}
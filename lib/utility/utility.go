@@ -2,6 +2,7 @@ package utility
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"math"
@@ -181,3 +182,36 @@ func GetOutboundIP4() string {
 
 	return conn.LocalAddr().(*net.UDPAddr).IP.To4().String()
 }
+
+// ProxyHeaderSig is the PROXY protocol v2 header signature
+var ProxyHeaderSig = []byte{0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a}
+
+// ProxyHeader returns a PROXY protocol v2 header for a tcp connection from src to dst.
+// If src or dst is not a tcp address, a LOCAL header is returned (connection opened by msh itself).
+func ProxyHeader(src, dst net.Addr) []byte {
+	buf := bytes.NewBuffer(append([]byte{}, ProxyHeaderSig...))
+
+	srcTCP, okSrc := src.(*net.TCPAddr)
+	dstTCP, okDst := dst.(*net.TCPAddr)
+	if !okSrc || !okDst {
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00}) // version 2, LOCAL command, UNSPEC family, no address
+		return buf.Bytes()
+	}
+
+	buf.WriteByte(0x21) // version 2, PROXY command
+	if src4, dst4 := srcTCP.IP.To4(), dstTCP.IP.To4(); src4 != nil && dst4 != nil {
+		buf.WriteByte(0x11) // TCP over IPv4
+		binary.Write(buf, binary.BigEndian, uint16(12))
+		buf.Write(src4)
+		buf.Write(dst4)
+	} else {
+		buf.WriteByte(0x21) // TCP over IPv6
+		binary.Write(buf, binary.BigEndian, uint16(36))
+		buf.Write(srcTCP.IP.To16())
+		buf.Write(dstTCP.IP.To16())
+	}
+	binary.Write(buf, binary.BigEndian, uint16(srcTCP.Port))
+	binary.Write(buf, binary.BigEndian, uint16(dstTCP.Port))
+
+	return buf.Bytes()
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"net"
+	"os"
 
 	"msh/lib/config"
 	"msh/lib/conn"
@@ -31,6 +31,11 @@ func main() {
 
 	// load configuration from msh config file
 	logMsh := config.LoadConfig()
+	if config.CheckOnly {
+		// config check: print found problems and exit
+		logMsh.Log(true)
+		os.Exit(config.CheckSummary())
+	}
 	if logMsh != nil {
 		logMsh.Log(true)
 		progmgr.AutoTerminate()
@@ -42,7 +47,7 @@ func main() {
 	<-progmgr.ReqSent
 
 	// if ms suspension is allowed, pre-warm the server
-	if config.ConfigRuntime.Msh.SuspendAllow {
+	if config.ConfigRuntime().Msh.SuspendAllow {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server will now pre-warm (SuspendAllow is enabled)...")
 		logMsh = servctrl.WarmMS()
 		if logMsh != nil {
@@ -55,18 +60,26 @@ func main() {
 
 	// ---------------- connections ---------------- //
 
-	// launch query handler
-	if config.ConfigRuntime.Msh.EnableQuery {
-		go conn.HandlerQuery()
+	// bedrock clients use raknet over udp
+	if config.ConfigRuntime().Server.Edition == "bedrock" {
+		logMsh = conn.HandlerBedrock()
+		logMsh.Log(true)
+		progmgr.AutoTerminate()
 	}
 
-	// open a tcp listener
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", config.MshHost, config.MshPort))
-	if err != nil {
-		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
+	// open a tcp listener (or use the inherited one)
+	listener, logMsh := conn.Listen()
+	if logMsh != nil {
+		logMsh.Log(true)
 		progmgr.AutoTerminate()
 	}
 
+	// launch query handler
+	// (after the listener is opened as query port might follow the msh port chosen from MshPortRange)
+	if config.ConfigRuntime().Msh.EnableQuery {
+		go conn.HandlerQuery()
+	}
+
 	// infinite cycle to handle new clients.
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new clients connections on", config.MshHost, config.MshPort)
 	for {
@@ -76,6 +89,14 @@ func main() {
 			continue
 		}
 
-		go conn.HandlerClientConn(clientConn)
+		// limit concurrent connection handlers
+		handlerConn, ok := conn.AcquireHandler(clientConn)
+		if !ok {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CLIENT_ACCEPT, "connection from %s rejected: max connection handlers (%d) reached", clientConn.RemoteAddr().String(), config.ConfigRuntime().Msh.MaxHandlers)
+			clientConn.Close()
+			continue
+		}
+
+		go conn.HandlerClientConn(handlerConn)
 	}
 }